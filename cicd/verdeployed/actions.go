@@ -0,0 +1,76 @@
+package main
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/codepipeline"
+)
+
+// actionDetails describes the latest execution of a single action of a
+// stage.
+type actionDetails struct {
+	Name   string `json:"actionName" yaml:"actionName"`
+	Status string `json:"status" yaml:"status"`
+
+	LastStatusChange *time.Time `json:"lastStatusChange,omitempty" yaml:"lastStatusChange,omitempty"`
+
+	// ExternalExecutionID and ExternalExecutionURL identify the execution
+	// in the service running the action, e.g. a CodeBuild build.
+	ExternalExecutionID  string `json:"externalExecutionId,omitempty" yaml:"externalExecutionId,omitempty"`
+	ExternalExecutionURL string `json:"externalExecutionUrl,omitempty" yaml:"externalExecutionUrl,omitempty"`
+}
+
+// actionTableColumns is the default table column set of --actions, it
+// shows when every action last changed.
+var actionTableColumns = []string{"stage", "status", "version", "executionId", "lastStatusChange"}
+
+// getActionDetails converts the action states of a stage, in pipeline
+// order. Actions that never ran have an empty status.
+func getActionDetails(states []*codepipeline.ActionState) []actionDetails {
+	actions := make([]actionDetails, 0, len(states))
+
+	for _, astate := range states {
+		action := actionDetails{Name: aws.StringValue(astate.ActionName)}
+		if exec := astate.LatestExecution; exec != nil {
+			action.Status = aws.StringValue(exec.Status)
+			action.LastStatusChange = exec.LastStatusChange
+			action.ExternalExecutionID = aws.StringValue(exec.ExternalExecutionId)
+			action.ExternalExecutionURL = aws.StringValue(exec.ExternalExecutionUrl)
+		}
+		actions = append(actions, action)
+	}
+
+	return actions
+}
+
+// actionCells returns the cells of the table row of an action. Only the
+// columns with an action counterpart are filled, the action name goes to
+// the stage column, indented below its stage. display selects the human
+// readable rendering of timestamps.
+func actionCells(cols []column, opts renderOptions, r report, action actionDetails, display bool) []string {
+	cells := make([]string, len(cols))
+
+	for i, c := range cols {
+		switch c.Name {
+		case "pipeline":
+			cells[i] = r.Pipeline
+		case "stage":
+			cells[i] = "  " + action.Name
+		case "status":
+			cells[i] = action.Status
+		case "executionId":
+			cells[i] = action.ExternalExecutionID
+		case "executionUrl":
+			cells[i] = action.ExternalExecutionURL
+		case "lastStatusChange", "age":
+			if display {
+				cells[i] = opts.Times.format(action.LastStatusChange, r.QueriedAt, c.Name == "age")
+			} else {
+				cells[i] = formatTime(action.LastStatusChange)
+			}
+		}
+	}
+
+	return cells
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/codepipeline"
+)
+
+// Values of approvalDetails.Status besides the raw action status.
+const (
+	approvalPending  = "Pending"
+	approvalApproved = "Approved"
+	approvalRejected = "Rejected"
+)
+
+// approvalDetails describes the latest manual approval of a stage.
+type approvalDetails struct {
+	Action string `json:"actionName" yaml:"actionName"`
+	Status string `json:"status" yaml:"status"`
+
+	// Summary is the message shown to reviewers and URL the link they are
+	// asked to review, both from the action configuration.
+	Summary string `json:"summary,omitempty" yaml:"summary,omitempty"`
+	URL     string `json:"url,omitempty" yaml:"url,omitempty"`
+
+	// Since is when the approval was requested or, once reviewed, decided.
+	Since *time.Time `json:"since,omitempty" yaml:"since,omitempty"`
+
+	// ReviewedBy is the principal that approved or rejected, Comment the
+	// comment they left.
+	ReviewedBy string `json:"reviewedBy,omitempty" yaml:"reviewedBy,omitempty"`
+	Comment    string `json:"comment,omitempty" yaml:"comment,omitempty"`
+}
+
+// getApproval returns the manual approval of the named stage, nil if the
+// stage has none or none of them ran. A pending approval wins over earlier
+// reviewed ones.
+func getApproval(pipeline *codepipeline.PipelineDeclaration, stageName string, states []*codepipeline.ActionState) *approvalDetails {
+	approvals := make(map[string]*codepipeline.ActionDeclaration)
+	for _, stage := range pipeline.Stages {
+		if aws.StringValue(stage.Name) != stageName {
+			continue
+		}
+		for _, action := range stage.Actions {
+			if action.ActionTypeId != nil && aws.StringValue(action.ActionTypeId.Category) == codepipeline.ActionCategoryApproval {
+				approvals[aws.StringValue(action.Name)] = action
+			}
+		}
+	}
+
+	var latest *approvalDetails
+	for _, astate := range states {
+		action, ok := approvals[aws.StringValue(astate.ActionName)]
+		exec := astate.LatestExecution
+		if !ok || exec == nil {
+			continue
+		}
+
+		a := &approvalDetails{
+			Action:  aws.StringValue(astate.ActionName),
+			Status:  approvalStatus(aws.StringValue(exec.Status)),
+			Summary: aws.StringValue(action.Configuration["CustomData"]),
+			URL:     aws.StringValue(action.Configuration["ExternalEntityLink"]),
+			Since:   exec.LastStatusChange,
+		}
+		if a.Status != approvalPending {
+			a.ReviewedBy = aws.StringValue(exec.LastUpdatedBy)
+			a.Comment = aws.StringValue(exec.Summary)
+		}
+
+		switch {
+		case latest == nil:
+			latest = a
+		case latest.Status == approvalPending:
+		case a.Status == approvalPending:
+			latest = a
+		case a.Since != nil && (latest.Since == nil || a.Since.After(*latest.Since)):
+			latest = a
+		}
+	}
+
+	return latest
+}
+
+// approvalStatus maps the status of an approval action execution.
+func approvalStatus(status string) string {
+	switch status {
+	case codepipeline.ActionExecutionStatusInProgress:
+		return approvalPending
+	case codepipeline.ActionExecutionStatusSucceeded:
+		return approvalApproved
+	case codepipeline.ActionExecutionStatusFailed:
+		return approvalRejected
+	}
+	return status
+}
+
+// principalName shortens the ARN of a reviewer to its last path element,
+// e.g. the session name of an assumed role.
+func principalName(arn string) string {
+	if i := strings.LastIndex(arn, "/"); i >= 0 {
+		return arn[i+1:]
+	}
+	return arn
+}
+
+// String renders the approval on a single line, e.g.
+//
+//	Approved by alice: LGTM
+func (a approvalDetails) String() string {
+	var s string
+	switch a.Status {
+	case approvalPending:
+		s = "Awaiting approval"
+		if a.Summary != "" {
+			s += ": " + a.Summary
+		}
+		return s
+	case approvalApproved, approvalRejected:
+		s = a.Status
+		if a.ReviewedBy != "" {
+			s += " by " + principalName(a.ReviewedBy)
+		}
+	default:
+		s = a.Status
+	}
+	if a.Comment != "" {
+		s += ": " + a.Comment
+	}
+	return s
+}
+
+// pendingApproval is a manual approval waiting for a decision, Token
+// identifies the request when approving or rejecting it.
+type pendingApproval struct {
+	Stage  string
+	Action string
+	Token  string
+}
+
+// String names the approval as stage/action.
+func (p pendingApproval) String() string {
+	return p.Stage + "/" + p.Action
+}
+
+// validApproval reports whether cfg can approve or reject.
+func validApproval(cmd string, cfg Cfg) error {
+	switch {
+	case cfg.Action != "" && cfg.Stage == "":
+		return fmt.Errorf("%s --action requires --stage", cmd)
+	case cfg.Watch || cfg.History > 0 || cfg.Quiet:
+		return fmt.Errorf("%s can't be combined with --watch, --history or --quiet", cmd)
+	}
+	return nil
+}
+
+// pendingApprovals lists the approvals of the named pipeline waiting for a
+// decision, narrowed down to stage and action when they are not empty.
+func pendingApprovals(pipelnsvc *codepipeline.CodePipeline, pipeline, stage, action string) ([]pendingApproval, error) {
+	state, err := pipelnsvc.GetPipelineState(&codepipeline.GetPipelineStateInput{
+		Name: aws.String(pipeline),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			switch aerr.Code() {
+			default:
+				return nil, fmt.Errorf("failed to get pipeline state: %s", aerr.Message())
+			}
+		}
+		return nil, err
+	}
+
+	var pending []pendingApproval
+	for _, s := range state.StageStates {
+		if stage != "" && aws.StringValue(s.StageName) != stage {
+			continue
+		}
+		for _, astate := range s.ActionStates {
+			if action != "" && aws.StringValue(astate.ActionName) != action {
+				continue
+			}
+			// only approval actions waiting for a decision carry a token
+			exec := astate.LatestExecution
+			if exec == nil || exec.Token == nil || aws.StringValue(exec.Status) != codepipeline.ActionExecutionStatusInProgress {
+				continue
+			}
+			pending = append(pending, pendingApproval{
+				Stage:  aws.StringValue(s.StageName),
+				Action: aws.StringValue(astate.ActionName),
+				Token:  aws.StringValue(exec.Token),
+			})
+		}
+	}
+
+	return pending, nil
+}
+
+// selectApproval picks the single pending approval matching cfg.Stage and
+// cfg.Action. Unless both were given the choice has to be confirmed.
+func selectApproval(pipelnsvc *codepipeline.CodePipeline, cfg Cfg) (pendingApproval, bool, error) {
+	pending, err := pendingApprovals(pipelnsvc, cfg.PipelineName, cfg.Stage, cfg.Action)
+	if err != nil {
+		return pendingApproval{}, false, err
+	}
+
+	switch len(pending) {
+	case 0:
+		where := "pipeline " + cfg.PipelineName
+		if cfg.Stage != "" {
+			where = "stage " + cfg.Stage
+		}
+		return pendingApproval{}, false, fmt.Errorf("no approval is pending in %s", where)
+	case 1:
+		return pending[0], cfg.Stage == "" || cfg.Action == "", nil
+	}
+
+	names := make([]string, len(pending))
+	for i, p := range pending {
+		names[i] = p.String()
+	}
+	return pendingApproval{}, false, fmt.Errorf("%d approvals are pending, pick one with --stage and --action: %s", len(pending), strings.Join(names, ", "))
+}
+
+// putApproval approves or rejects a pending approval, status is one of
+// approvalApproved and approvalRejected.
+func putApproval(pipelnsvc *codepipeline.CodePipeline, pipeline string, p pendingApproval, status, comment string) error {
+	_, err := pipelnsvc.PutApprovalResult(&codepipeline.PutApprovalResultInput{
+		PipelineName: aws.String(pipeline),
+		StageName:    aws.String(p.Stage),
+		ActionName:   aws.String(p.Action),
+		Token:        aws.String(p.Token),
+		Result: &codepipeline.ApprovalResult{
+			Status:  aws.String(status),
+			Summary: aws.String(comment),
+		},
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			switch aerr.Code() {
+			case codepipeline.ErrCodeApprovalAlreadyCompletedException:
+				return fmt.Errorf("approval %s was already decided: %s", p, aerr.Message())
+			case codepipeline.ErrCodeInvalidApprovalTokenException:
+				return fmt.Errorf("approval %s expired or was superseded: %s", p, aerr.Message())
+			default:
+				return fmt.Errorf("failed to put approval result: %s", aerr.Message())
+			}
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// archiveVersion is the version file found inside older artifacts, which
+// were uploaded without version metadata.
+type archiveVersion struct {
+	Version    string `json:"version"`
+	Release    string `json:"release"`
+	Commit     string `json:"commit"`
+	ReleaseURL string `json:"releaseUrl"`
+	Branch     string `json:"branch"`
+}
+
+// lacksVersion reports whether the object metadata carries neither version
+// nor commit.
+func lacksVersion(cfg Cfg, meta map[string]*string) bool {
+	return metaValue(meta, versionKeys(cfg)) == "" && metaValue(meta, commitKeys(cfg)) == ""
+}
+
+// readArchiveMetadata downloads the artifact version ver and reads the
+// configured version file from the zip. The fields are returned under the
+// keys of the object metadata, so the rest can't tell where they came from.
+// Archives larger than cfg.ArchiveMaxSize MiB aren't downloaded, head is
+// what HeadObject reported of the version.
+func readArchiveMetadata(svc s3iface.S3API, cfg Cfg, ver string, head *s3.HeadObjectOutput) (map[string]*string, error) {
+	limit := int64(cfg.ArchiveMaxSize) << 20
+	if size := aws.Int64Value(head.ContentLength); size > limit {
+		return nil, fmt.Errorf("archive is %d MiB, larger than the %d MiB --archive-max-size", size>>20, cfg.ArchiveMaxSize)
+	}
+
+	input := &s3.GetObjectInput{
+		Bucket:    aws.String(cfg.Bucket),
+		Key:       aws.String(cfg.Key),
+		VersionId: aws.String(ver),
+	}
+	withSSECustomerKey(cfg, &input.SSECustomerAlgorithm, &input.SSECustomerKey)
+
+	out, err := svc.GetObject(input)
+	if err != nil {
+		// unlike HeadObject, downloading SSE-KMS objects needs kms:Decrypt
+		if err := encryptionError(svc, cfg, err, aws.StringValue(head.SSEKMSKeyId)); err != nil {
+			return nil, err
+		}
+		if aerr, ok := err.(awserr.Error); ok {
+			switch aerr.Code() {
+			default:
+				return nil, fmt.Errorf("failed to download archive: %s", aerr.Message())
+			}
+		}
+		return nil, err
+	}
+	defer out.Body.Close()
+
+	// the size may have been wrong, never read past the limit
+	data, err := io.ReadAll(io.LimitReader(out.Body, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to download archive: %w", err)
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("archive is larger than the %d MiB --archive-max-size", cfg.ArchiveMaxSize)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open archive: %w", err)
+	}
+	f, err := zr.Open(cfg.ArchiveMember)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s in archive: %w", cfg.ArchiveMember, err)
+	}
+	defer f.Close()
+
+	var v archiveVersion
+	if err := json.NewDecoder(f).Decode(&v); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", cfg.ArchiveMember, err)
+	}
+	if v.Version == "" {
+		v.Version = v.Release
+	}
+
+	meta := make(map[string]*string)
+	for key, value := range map[string]string{
+		builtinVersionKey: v.Version,
+		builtinCommitKey:  v.Commit,
+		"Release-Url":     v.ReleaseURL,
+		"Branch":          v.Branch,
+	} {
+		if value != "" {
+			meta[key] = aws.String(value)
+		}
+	}
+	return meta, nil
+}
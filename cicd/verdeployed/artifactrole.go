@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// artifactCreds remembers the credentials of every artifact role assumed.
+// The SDK assumes the role again shortly before they expire, so --watch
+// keeps reading the bucket for as long as it runs.
+var artifactCreds = struct {
+	sync.Mutex
+	m map[string]*credentials.Credentials
+}{m: make(map[string]*credentials.Credentials)}
+
+// artifactSession returns the session the artifact bucket is read with,
+// sess itself unless cfg.ArtifactRoleArn names a role to assume for it, as
+// for buckets owned by another account than the pipeline. CodePipeline is
+// always read with sess.
+func artifactSession(sess *session.Session, cfg Cfg) (*session.Session, error) {
+	if cfg.ArtifactRoleArn == "" {
+		return sess, nil
+	}
+
+	cacheKey := cfg.ArtifactRoleArn + "|" + cfg.ArtifactSession + "|" + cfg.ExternalID
+	artifactCreds.Lock()
+	creds, ok := artifactCreds.m[cacheKey]
+	if !ok {
+		creds = stscreds.NewCredentials(sess, cfg.ArtifactRoleArn, func(p *stscreds.AssumeRoleProvider) {
+			p.RoleSessionName = cfg.ArtifactSession
+			if cfg.ExternalID != "" {
+				p.ExternalID = aws.String(cfg.ExternalID)
+			}
+			// requests in flight mustn't outlive the credentials
+			p.ExpiryWindow = time.Minute
+		})
+		artifactCreds.m[cacheKey] = creds
+	}
+	artifactCreds.Unlock()
+
+	// assume the role now, rather than on the first request, so failing
+	// to do so isn't mistaken for the bucket refusing access
+	if _, err := creds.Get(); err != nil {
+		if _, derr := sess.Config.Credentials.Get(); derr != nil {
+			return nil, fmt.Errorf("failed to assume artifact role %s: the default credentials it is assumed with are unavailable: %s", cfg.ArtifactRoleArn, errorMessage(derr))
+		}
+		return nil, fmt.Errorf("failed to assume artifact role %s with the default credentials: %s", cfg.ArtifactRoleArn, errorMessage(err))
+	}
+	return sess.Copy(&aws.Config{Credentials: creds}), nil
+}
+
+// errorMessage returns the message of an AWS error without its code.
+func errorMessage(err error) string {
+	if aerr, ok := err.(awserr.Error); ok {
+		return aerr.Message()
+	}
+	return err.Error()
+}
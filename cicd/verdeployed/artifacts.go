@@ -0,0 +1,218 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/codepipeline"
+)
+
+// artifactDetails is one of the source artifacts of an execution whose
+// pipeline has several sources.
+type artifactDetails struct {
+	Name       string `json:"name" yaml:"name"`
+	RevisionID string `json:"revisionId" yaml:"revisionId"`
+
+	// Version, Commit and ReleaseURL are read from the metadata of S3
+	// artifacts, Git and ECR artifacts are versioned by their commit or
+	// image. Other sources leave them empty.
+	Version    string `json:"version,omitempty" yaml:"version,omitempty"`
+	Commit     string `json:"commit,omitempty" yaml:"commit,omitempty"`
+	ReleaseURL string `json:"releaseUrl,omitempty" yaml:"releaseUrl,omitempty"`
+	// VersionSource tells where the version was read from, see
+	// stageDetails.
+	VersionSource string `json:"versionSource,omitempty" yaml:"versionSource,omitempty"`
+
+	// Error describes why the metadata couldn't be read.
+	Error string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// field returns the version or commit of the artifact. Artifacts without
+// metadata, e.g. from an S3 object lacking it, are identified by their
+// revision.
+func (a artifactDetails) field(name string) string {
+	v := a.Version
+	if name == driftFieldCommit {
+		v = a.Commit
+	}
+	if v == "" {
+		return a.RevisionID
+	}
+	return v
+}
+
+// s3Location is where an S3 source action reads its artifact from.
+type s3Location struct {
+	Bucket string
+	Key    string
+}
+
+// s3Artifacts maps the output artifacts of the S3 source actions of a
+// pipeline to their location.
+func s3Artifacts(pipeline *codepipeline.PipelineDeclaration) map[string]s3Location {
+	locations := make(map[string]s3Location)
+	for _, stage := range pipeline.Stages {
+		for _, action := range stage.Actions {
+			id := action.ActionTypeId
+			if id == nil || aws.StringValue(id.Category) != codepipeline.ActionCategorySource || aws.StringValue(id.Provider) != "S3" {
+				continue
+			}
+			loc := s3Location{
+				Bucket: aws.StringValue(action.Configuration["S3Bucket"]),
+				Key:    aws.StringValue(action.Configuration["S3ObjectKey"]),
+			}
+			for _, out := range action.OutputArtifacts {
+				locations[aws.StringValue(out.Name)] = loc
+			}
+		}
+	}
+	return locations
+}
+
+// parseArtifactLocations parses NAME=BUCKET/KEY artifact locations, as
+// given by --artifact.
+func parseArtifactLocations(specs []string) (map[string]s3Location, error) {
+	locations := make(map[string]s3Location)
+	for _, spec := range specs {
+		if spec == "" {
+			continue
+		}
+		name, path, _ := strings.Cut(spec, "=")
+		bucket, key, _ := strings.Cut(path, "/")
+		if name == "" || bucket == "" || key == "" {
+			return nil, fmt.Errorf("invalid artifact %q, want NAME=BUCKET/KEY", spec)
+		}
+		locations[name] = s3Location{Bucket: bucket, Key: key}
+	}
+	return locations, nil
+}
+
+// explicitArtifactLocation returns the location --artifact sets for the
+// named artifact, if any.
+func explicitArtifactLocation(cfg Cfg, name string) (s3Location, bool) {
+	// validated on startup
+	explicit, _ := parseArtifactLocations(cfg.Artifact)
+	loc, ok := explicit[name]
+	return loc, ok
+}
+
+// artifactLocations maps the output artifacts of the S3 source actions of
+// a pipeline to their location, the ones set by --artifact taking
+// precedence over the configuration of the actions.
+func artifactLocations(pipeline *codepipeline.PipelineDeclaration, cfg Cfg) map[string]s3Location {
+	locations := s3Artifacts(pipeline)
+	// validated on startup
+	explicit, _ := parseArtifactLocations(cfg.Artifact)
+	for name, loc := range explicit {
+		locations[name] = loc
+	}
+	return locations
+}
+
+// getArtifacts resolves every artifact revision of an execution, reading
+// the metadata of those stored on S3 and describing the commits and images
+// of the others. Executions with a single artifact return nil, their
+// version is all there is to tell.
+func getArtifacts(sess *session.Session, cfg Cfg, locations map[string]s3Location, sources map[string]versionSource, revisions []*codepipeline.ArtifactRevision) []artifactDetails {
+	if len(revisions) < 2 {
+		return nil
+	}
+
+	artifacts := make([]artifactDetails, 0, len(revisions))
+	for _, revision := range revisions {
+		a := artifactDetails{
+			Name:       aws.StringValue(revision.Name),
+			RevisionID: aws.StringValue(revision.RevisionId),
+		}
+
+		if loc, ok := locations[a.Name]; ok {
+			acfg := cfg
+			acfg.Bucket, acfg.Key = loc.Bucket, loc.Key
+			meta, source, _, err := getMetadataFromRevision(sess, acfg, a.RevisionID)
+			if version, _, ok := unavailableVersion(err); ok {
+				a.Version = version
+			} else if err != nil {
+				a.Error = fmt.Sprintf("get metadata from file revision: %v", err)
+			} else {
+				if a.Version = metaValue(meta, versionKeys(cfg)); a.Version == "" {
+					a.Version = noVersionMetadata
+				}
+				a.Commit = metaValue(meta, commitKeys(cfg))
+				a.ReleaseURL = aws.StringValue(meta["Release-Url"])
+				a.VersionSource = source
+			}
+		}
+		if src, ok := sources[a.Name]; ok {
+			meta, err := readVersion(sess, cfg, src, a.RevisionID)
+			if err != nil {
+				a.Error = err.Error()
+			}
+			a.Version, a.Commit = meta.Version, meta.Commit
+		}
+
+		artifacts = append(artifacts, a)
+	}
+	return artifacts
+}
+
+// artifact returns the named artifact of the stage, found is false when the
+// stage execution didn't use it.
+func (d stageDetails) artifact(name string) (a artifactDetails, found bool) {
+	for _, a := range d.Artifacts {
+		if a.Name == name {
+			return a, true
+		}
+	}
+	return artifactDetails{}, false
+}
+
+// stageArtifactNames returns the names of the artifacts of the stages in
+// order of appearance, nil for pipelines with a single source.
+func stageArtifactNames(stages []stageDetails) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, details := range stages {
+		for _, a := range details.Artifacts {
+			if !seen[a.Name] {
+				seen[a.Name] = true
+				names = append(names, a.Name)
+			}
+		}
+	}
+	return names
+}
+
+// artifactNames returns the names of the artifacts of all the reports.
+func artifactNames(reports ...report) []string {
+	var stages []stageDetails
+	for _, r := range reports {
+		stages = append(stages, r.Stages...)
+	}
+	return stageArtifactNames(stages)
+}
+
+// artifactColumn returns the column showing the version of the named
+// artifact, or its revision if it has no version metadata.
+func artifactColumn(name string) column {
+	return column{
+		Name:  name,
+		Title: name,
+		Wide:  true,
+		Value: func(_ report, d stageDetails) string {
+			if a, ok := d.artifact(name); ok {
+				return a.field(driftFieldVersion)
+			}
+			return ""
+		},
+	}
+}
+
+// withArtifacts appends a column per artifact to cols.
+func (o renderOptions) withArtifacts(cols []column) []column {
+	for _, name := range o.Artifacts {
+		cols = append(cols[:len(cols):len(cols)], artifactColumn(name))
+	}
+	return cols
+}
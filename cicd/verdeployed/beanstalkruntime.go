@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/elasticbeanstalk"
+)
+
+// providerBeanstalk is the provider of Elastic Beanstalk deploy actions.
+const providerBeanstalk = "ElasticBeanstalk"
+
+// beanstalkEnv is an Elastic Beanstalk environment a stage deploys to.
+type beanstalkEnv struct {
+	Application string
+	Environment string
+}
+
+// environmentRuntime is the application version an Elastic Beanstalk
+// environment of a stage actually runs, checked against the version of the
+// stage.
+type environmentRuntime struct {
+	Application string `json:"application" yaml:"application"`
+	Environment string `json:"environment" yaml:"environment"`
+	Status      string `json:"status" yaml:"status"`
+	// Label is the version label of the environment, Health its health
+	// color and State e.g. Ready or Updating.
+	Label  string `json:"label,omitempty" yaml:"label,omitempty"`
+	Health string `json:"health,omitempty" yaml:"health,omitempty"`
+	State  string `json:"state,omitempty" yaml:"state,omitempty"`
+	// Reason tells why the environment couldn't be verified.
+	Reason string `json:"reason,omitempty" yaml:"reason,omitempty"`
+}
+
+// String renders the outcome along with the health, e.g.
+// "MISMATCH (live app-1.4.1, Red)".
+func (e environmentRuntime) String() string {
+	health := e.Health
+	if e.State != "" && e.State != elasticbeanstalk.EnvironmentStatusReady {
+		health += ", " + strings.ToLower(e.State)
+	}
+	switch e.Status {
+	case runtimeOK:
+		return fmt.Sprintf("OK (%s)", health)
+	case runtimeDrifted:
+		return fmt.Sprintf("MISMATCH (live %s, %s)", e.Label, health)
+	}
+	return e.Status
+}
+
+// parseBeanstalkEnvs parses STAGE=APPLICATION/ENVIRONMENT mappings, as
+// given by --beanstalk-env. A stage may be mapped to several environments.
+func parseBeanstalkEnvs(specs []string) (map[string][]beanstalkEnv, error) {
+	envs := make(map[string][]beanstalkEnv)
+	for _, spec := range specs {
+		if spec == "" {
+			continue
+		}
+		stage, path, _ := strings.Cut(spec, "=")
+		app, env, _ := strings.Cut(path, "/")
+		if stage == "" || app == "" || env == "" {
+			return nil, fmt.Errorf("invalid Beanstalk environment %q, want STAGE=APPLICATION/ENVIRONMENT", spec)
+		}
+		envs[stage] = append(envs[stage], beanstalkEnv{Application: app, Environment: env})
+	}
+	return envs, nil
+}
+
+// stageEnvironments returns the Elastic Beanstalk environments of the
+// stage, those --beanstalk-env maps it to or else the ones its Elastic
+// Beanstalk deploy actions deploy to.
+func stageEnvironments(cfg Cfg, details stageDetails) []beanstalkEnv {
+	// validated on startup
+	explicit, _ := parseBeanstalkEnvs(cfg.BeanstalkEnv)
+	if envs, ok := explicit[details.Name]; ok {
+		return envs
+	}
+	var envs []beanstalkEnv
+	for _, t := range details.Targets {
+		if t.Provider != providerBeanstalk {
+			continue
+		}
+		if app, env, ok := strings.Cut(t.Target, "/"); ok && app != "" && env != "" {
+			envs = append(envs, beanstalkEnv{Application: app, Environment: env})
+		}
+	}
+	return envs
+}
+
+// verifyEnvironments checks the version labels of the Elastic Beanstalk
+// environments of the stage against its version. nil if it deploys to
+// none. Environments that can't be read are left unverified with a
+// warning.
+func verifyEnvironments(sess *session.Session, cfg Cfg, details stageDetails) []environmentRuntime {
+	envs := stageEnvironments(cfg, details)
+	if len(envs) == 0 {
+		return nil
+	}
+
+	expected := expectedImages(details)
+	runtimes := make([]environmentRuntime, len(envs))
+	for i, e := range envs {
+		rt := environmentRuntime{Application: e.Application, Environment: e.Environment}
+		if len(expected) == 0 {
+			rt.Status, rt.Reason = runtimeUnverified, "the stage has no version to compare"
+		} else if err := checkEnvironment(sess, e, expected, &rt); err != nil {
+			rt.Status, rt.Reason = runtimeUnverified, err.Error()
+			warnUnverified(fmt.Sprintf("Elastic Beanstalk environment %s/%s", e.Application, e.Environment), err)
+		}
+		runtimes[i] = rt
+	}
+	return runtimes
+}
+
+// checkEnvironment reads the version label and health of the environment,
+// the label matches when it embeds any of the expected versions.
+func checkEnvironment(sess *session.Session, e beanstalkEnv, expected map[string]bool, rt *environmentRuntime) error {
+	out, err := elasticbeanstalk.New(sess).DescribeEnvironments(&elasticbeanstalk.DescribeEnvironmentsInput{
+		ApplicationName:  aws.String(e.Application),
+		EnvironmentNames: []*string{aws.String(e.Environment)},
+		IncludeDeleted:   aws.Bool(false),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			switch aerr.Code() {
+			default:
+				return fmt.Errorf("failed to describe environment %s/%s: %s", e.Application, e.Environment, aerr.Message())
+			}
+		}
+		return err
+	}
+	if len(out.Environments) == 0 {
+		return fmt.Errorf("environment %s/%s not found", e.Application, e.Environment)
+	}
+
+	env := out.Environments[0]
+	rt.Label = aws.StringValue(env.VersionLabel)
+	rt.Health = aws.StringValue(env.Health)
+	rt.State = aws.StringValue(env.Status)
+	rt.Status = runtimeDrifted
+	for v := range expected {
+		if embedsVersion(rt.Label, v) {
+			rt.Status = runtimeOK
+		}
+	}
+	return nil
+}
+
+// embedsVersion reports whether label contains version as a whole, e.g.
+// app-1.4.2-a1b2c3d embeds 1.4.2 but app-1.4.21 doesn't.
+func embedsVersion(label, version string) bool {
+	for i := 0; ; {
+		j := strings.Index(label[i:], version)
+		if j < 0 {
+			return false
+		}
+		start, end := i+j, i+j+len(version)
+		if !versionChar(label, start-1) && !versionChar(label, end) {
+			return true
+		}
+		i = start + 1
+	}
+}
+
+// versionChar reports whether the byte at i of s continues a version, a
+// letter, a digit or a dot followed by a digit. The dot of app-1.4.2.zip
+// doesn't.
+func versionChar(s string, i int) bool {
+	if i < 0 || i >= len(s) {
+		return false
+	}
+	c := rune(s[i])
+	if c == '.' {
+		return i+1 < len(s) && unicode.IsDigit(rune(s[i+1]))
+	}
+	return unicode.IsLetter(c) || unicode.IsDigit(c)
+}
+
+// environmentsSummary renders the outcome for every environment of a stage
+// on a single line, naming the environments when there are several.
+func environmentsSummary(runtimes []environmentRuntime) string {
+	if len(runtimes) == 1 {
+		return runtimes[0].String()
+	}
+	s := make([]string, len(runtimes))
+	for i, rt := range runtimes {
+		s[i] = rt.Environment + " " + rt.String()
+	}
+	return strings.Join(s, "; ")
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/codepipeline"
+)
+
+// behindCount is how many releases started after the execution a stage
+// reflects.
+type behindCount struct {
+	Count int `json:"count" yaml:"count"`
+	// AtLeast is set when the execution of the stage is older than the
+	// lookback, Count is then a lower bound.
+	AtLeast bool `json:"atLeast,omitempty" yaml:"atLeast,omitempty"`
+}
+
+// String renders the count, e.g. "3" or "50+".
+func (b *behindCount) String() string {
+	if b == nil {
+		return ""
+	}
+	s := strconv.Itoa(b.Count)
+	if b.AtLeast {
+		s += "+"
+	}
+	return s
+}
+
+// getBehind counts the executions started after execID among the lookback
+// latest ones. Rollbacks start no release and don't count.
+func getBehind(execs *executionCache, execID string, lookback int) (*behindCount, error) {
+	history, err := execs.summaries(lookback)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &behindCount{}
+	for _, summary := range history {
+		if aws.StringValue(summary.PipelineExecutionId) == execID {
+			return b, nil
+		}
+		if aws.StringValue(summary.ExecutionType) != codepipeline.ExecutionTypeRollback {
+			b.Count++
+		}
+	}
+
+	// the execution aged out of the lookback, it is at least this far behind
+	b.AtLeast = true
+	return b, nil
+}
+
+// behindColumn shows how many releases a stage is behind.
+var behindColumn = column{
+	Name:  "behind",
+	Title: "Behind",
+	Value: func(_ report, d stageDetails) string { return d.Behind.String() },
+}
+
+// withBehind appends the behind column to the default columns of --behind,
+// a --columns selection places it itself.
+func (o renderOptions) withBehind(cols []column) []column {
+	if !o.Behind || o.Columns != nil {
+		return cols
+	}
+	return append(cols[:len(cols):len(cols)], behindColumn)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// bucketRegions remembers the region of every bucket looked up, buckets
+// don't move.
+var bucketRegions = struct {
+	sync.Mutex
+	m map[string]string
+}{m: make(map[string]string)}
+
+// bucketRegion returns the region of the named bucket, which may differ from
+// the region of the pipeline.
+func bucketRegion(sess *session.Session, bucket string) (string, error) {
+	bucketRegions.Lock()
+	region, ok := bucketRegions.m[bucket]
+	bucketRegions.Unlock()
+	if ok {
+		return region, nil
+	}
+
+	region, err := s3manager.GetBucketRegion(aws.BackgroundContext(), sess, bucket, aws.StringValue(sess.Config.Region))
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			switch aerr.Code() {
+			case "NotFound":
+				return "", fmt.Errorf("bucket %s not found", bucket)
+			default:
+				return "", fmt.Errorf("failed to find the region of bucket %s: %s", bucket, aerr.Message())
+			}
+		}
+		return "", err
+	}
+
+	bucketRegions.Lock()
+	bucketRegions.m[bucket] = region
+	bucketRegions.Unlock()
+	return region, nil
+}
+
+// newS3 creates the clients s3Client returns, tests replace it.
+var newS3 = func(sess *session.Session, config *aws.Config) s3iface.S3API {
+	return s3.New(sess, config)
+}
+
+// s3Client returns an S3 client for the region of the configured bucket,
+// cfg.BucketRegion unless it is to be detected, with the credentials of
+// the artifact role if one is set. Its requests are retried as
+// s3Retryer tells.
+func s3Client(sess *session.Session, cfg Cfg) (s3iface.S3API, error) {
+	sess, err := artifactSession(sess, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	region := cfg.BucketRegion
+	if region == "" {
+		if region, err = bucketRegion(sess, cfg.Bucket); err != nil {
+			return nil, err
+		}
+	}
+	config := request.WithRetryer(aws.NewConfig().WithRegion(region), newS3Retryer(cfg.S3Attempts, cfg.Verbose))
+	return newS3(sess, config), nil
+}
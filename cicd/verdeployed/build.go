@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/codebuild"
+	"github.com/aws/aws-sdk-go/service/codepipeline"
+)
+
+// providerCodeBuild is the provider of CodeBuild build actions.
+const providerCodeBuild = "CodeBuild"
+
+// buildDetails describes the CodeBuild build that produced the artifact a
+// stage runs.
+type buildDetails struct {
+	ID      string     `json:"id" yaml:"id"`
+	Project string     `json:"project" yaml:"project"`
+	Number  int64      `json:"number" yaml:"number"`
+	Status  string     `json:"status" yaml:"status"`
+	Started *time.Time `json:"started,omitempty" yaml:"started,omitempty"`
+	URL     string     `json:"url" yaml:"url"`
+	LogsURL string     `json:"logsUrl,omitempty" yaml:"logsUrl,omitempty"`
+}
+
+// buildCache remembers every finished build looked up, stages usually run
+// the artifact of the same build.
+var buildCache = struct {
+	sync.Mutex
+	m map[string]*buildDetails
+}{m: make(map[string]*buildDetails)}
+
+// getBuild returns the CodeBuild build of the build action of the pipeline
+// execution execID, nil if it has none, e.g. because the pipeline builds
+// with something else.
+func getBuild(execs *executionCache, sess *session.Session, region, execID string) (*buildDetails, error) {
+	actions, err := execs.actionExecutions(execID)
+	if err != nil {
+		return nil, err
+	}
+
+	var buildID string
+	for _, action := range actions {
+		in := action.Input
+		if in == nil || in.ActionTypeId == nil || aws.StringValue(in.ActionTypeId.Category) != codepipeline.ActionCategoryBuild || aws.StringValue(in.ActionTypeId.Provider) != providerCodeBuild {
+			continue
+		}
+		if out := action.Output; out != nil && out.ExecutionResult != nil {
+			if buildID = aws.StringValue(out.ExecutionResult.ExternalExecutionId); buildID != "" {
+				break
+			}
+		}
+	}
+	if buildID == "" {
+		return nil, nil
+	}
+
+	buildCache.Lock()
+	build, ok := buildCache.m[buildID]
+	buildCache.Unlock()
+	if ok {
+		return build, nil
+	}
+
+	out, err := codebuild.New(sess).BatchGetBuilds(&codebuild.BatchGetBuildsInput{Ids: []*string{aws.String(buildID)}})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			switch aerr.Code() {
+			default:
+				return nil, fmt.Errorf("failed to get build: %s", aerr.Message())
+			}
+		}
+		return nil, err
+	}
+	// builds age out after a year
+	if len(out.Builds) == 0 {
+		return nil, nil
+	}
+
+	b := out.Builds[0]
+	build = &buildDetails{
+		ID:      buildID,
+		Project: aws.StringValue(b.ProjectName),
+		Number:  aws.Int64Value(b.BuildNumber),
+		Status:  aws.StringValue(b.BuildStatus),
+		Started: b.StartTime,
+		URL:     buildConsoleURL(region, aws.StringValue(b.ProjectName), buildID),
+	}
+	if b.Logs != nil {
+		build.LogsURL = aws.StringValue(b.Logs.DeepLink)
+	}
+
+	// running builds still change
+	if aws.BoolValue(b.BuildComplete) {
+		buildCache.Lock()
+		buildCache.m[buildID] = build
+		buildCache.Unlock()
+	}
+	return build, nil
+}
+
+// buildConsoleURL returns the CodeBuild console page of a build.
+func buildConsoleURL(region, project, buildID string) string {
+	return fmt.Sprintf("%s/codesuite/codebuild/projects/%s/build/%s/?region=%s",
+		consoleBaseURL(region), url.PathEscape(project), url.PathEscape(buildID), url.QueryEscape(region))
+}
+
+// buildColumn shows the build that produced the artifact of the stage.
+var buildColumn = column{
+	Name:  "build",
+	Title: "Build",
+	Wide:  true,
+	Value: func(_ report, d stageDetails) string {
+		if d.Build == nil {
+			return ""
+		}
+		return d.Build.URL
+	},
+	Display: func(_ renderOptions, _ report, d stageDetails) string {
+		if d.Build == nil {
+			return "-"
+		}
+		return fmt.Sprintf("%s #%d (%s)", d.Build.Project, d.Build.Number, d.Build.Status)
+	},
+}
+
+// hasBuilds reports whether any stage of the reports has a build, pipelines
+// building with something else than CodeBuild have none.
+func hasBuilds(reports ...report) bool {
+	for _, r := range reports {
+		for _, details := range r.Stages {
+			if details.Build != nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// withBuild appends the build column to the default columns of
+// --show-build, a --columns selection places it itself.
+func (o renderOptions) withBuild(cols []column) []column {
+	if !o.ShowBuild || o.Columns != nil {
+		return cols
+	}
+	return append(cols[:len(cols):len(cols)], buildColumn)
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// checksumKey is the metadata key the publisher records the SHA-256 of
+// the artifact under.
+const checksumKey = "Sha256"
+
+// Outcomes of --verify-checksum.
+const (
+	checksumVerified   = "verified"
+	checksumMismatch   = "mismatch"
+	checksumMissing    = "missing"
+	checksumUnverified = "unverified"
+)
+
+// checksumDetails is the outcome of verifying the checksum of an artifact
+// version against the one recorded in its metadata. Checksums are hex.
+type checksumDetails struct {
+	Status   string `json:"status" yaml:"status"`
+	Expected string `json:"expected,omitempty" yaml:"expected,omitempty"`
+	Actual   string `json:"actual,omitempty" yaml:"actual,omitempty"`
+	// Reason tells why the checksum couldn't be verified.
+	Reason string `json:"reason,omitempty" yaml:"reason,omitempty"`
+}
+
+// checksumCache remembers the outcome for every artifact version verified.
+var checksumCache = struct {
+	sync.Mutex
+	m map[string]*checksumDetails
+}{m: make(map[string]*checksumDetails)}
+
+// verifyChecksum compares the checksum recorded in meta, the metadata of
+// the artifact version ver, to the SHA-256 S3 stored along with the object
+// or, without one, to the hash of the downloaded object. Objects larger
+// than cfg.ChecksumMaxSize MiB are left unverified.
+func verifyChecksum(sess *session.Session, cfg Cfg, ver string, meta map[string]*string) *checksumDetails {
+	recorded := metaValue(meta, []string{checksumKey})
+	if recorded == "" {
+		return &checksumDetails{Status: checksumMissing}
+	}
+	expected, ok := decodeChecksum(recorded)
+	if !ok {
+		return &checksumDetails{Status: checksumUnverified, Expected: recorded, Reason: "the recorded checksum is neither hex nor base64 SHA-256"}
+	}
+
+	cacheKey := cfg.Bucket + "/" + cfg.Key + "?versionId=" + ver
+	checksumCache.Lock()
+	cached, ok := checksumCache.m[cacheKey]
+	checksumCache.Unlock()
+	if ok {
+		return cached
+	}
+
+	c := &checksumDetails{Expected: expected}
+	actual, err := objectChecksum(sess, cfg, ver)
+	switch {
+	case err != nil:
+		c.Status, c.Reason = checksumUnverified, err.Error()
+		// the next refresh may succeed
+		return c
+	case actual == expected:
+		c.Status, c.Actual = checksumVerified, actual
+	default:
+		c.Status, c.Actual = checksumMismatch, actual
+	}
+
+	checksumCache.Lock()
+	checksumCache.m[cacheKey] = c
+	checksumCache.Unlock()
+	return c
+}
+
+// decodeChecksum returns a SHA-256 given as hex or base64 in hex.
+func decodeChecksum(s string) (string, bool) {
+	if b, err := hex.DecodeString(s); err == nil && len(b) == sha256.Size {
+		return hex.EncodeToString(b), true
+	}
+	if b, err := base64.StdEncoding.DecodeString(s); err == nil && len(b) == sha256.Size {
+		return hex.EncodeToString(b), true
+	}
+	return "", false
+}
+
+// objectChecksum returns the hex SHA-256 of the artifact version ver. The
+// one S3 stored is taken if the object was uploaded with it in one part,
+// the checksum of multipart uploads being one of the parts.
+func objectChecksum(sess *session.Session, cfg Cfg, ver string) (string, error) {
+	svc, err := s3Client(sess, cfg)
+	if err != nil {
+		return "", err
+	}
+
+	head := &s3.HeadObjectInput{
+		Bucket:       aws.String(cfg.Bucket),
+		Key:          aws.String(cfg.Key),
+		ChecksumMode: aws.String(s3.ChecksumModeEnabled),
+	}
+	get := &s3.GetObjectInput{
+		Bucket: aws.String(cfg.Bucket),
+		Key:    aws.String(cfg.Key),
+	}
+	// unversioned buckets only have the current object, which must still be
+	// the one deployed
+	if isETag(ver) {
+		head.IfMatch, get.IfMatch = aws.String(ver), aws.String(ver)
+	} else {
+		head.VersionId, get.VersionId = aws.String(ver), aws.String(ver)
+	}
+	withSSECustomerKey(cfg, &head.SSECustomerAlgorithm, &head.SSECustomerKey)
+	withSSECustomerKey(cfg, &get.SSECustomerAlgorithm, &get.SSECustomerKey)
+
+	result, err := svc.HeadObject(head)
+	if err != nil {
+		return "", checksumError(err)
+	}
+	if sum, ok := decodeChecksum(aws.StringValue(result.ChecksumSHA256)); ok {
+		return sum, nil
+	}
+
+	limit := int64(cfg.ChecksumMaxSize) << 20
+	if size := aws.Int64Value(result.ContentLength); size > limit {
+		return "", fmt.Errorf("artifact is %d MiB, larger than the %d MiB --checksum-max-size", size>>20, cfg.ChecksumMaxSize)
+	}
+	out, err := svc.GetObject(get)
+	if err != nil {
+		if err := encryptionError(svc, cfg, err, aws.StringValue(result.SSEKMSKeyId)); err != nil {
+			return "", err
+		}
+		return "", checksumError(err)
+	}
+	defer out.Body.Close()
+
+	// the size may have been wrong, never read past the limit
+	h := sha256.New()
+	n, err := io.Copy(h, io.LimitReader(out.Body, limit+1))
+	if err != nil {
+		return "", fmt.Errorf("failed to download artifact: %w", err)
+	}
+	if n > limit {
+		return "", fmt.Errorf("artifact is larger than the %d MiB --checksum-max-size", cfg.ChecksumMaxSize)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// checksumError describes a failure reading the artifact to checksum.
+func checksumError(err error) error {
+	if aerr, ok := err.(awserr.Error); ok {
+		switch aerr.Code() {
+		case "PreconditionFailed":
+			return errObjectReplaced
+		default:
+			return fmt.Errorf("failed to read artifact: %s", aerr.Message())
+		}
+	}
+	return err
+}
+
+// checksumLine describes a checksum mismatch below the row of its stage.
+func checksumLine(c *checksumDetails) string {
+	return fmt.Sprintf("    ✗ checksum mismatch: metadata records %s, artifact hashes to %s", shortChecksum(c.Expected), shortChecksum(c.Actual))
+}
+
+// shortChecksum abbreviates a hex checksum for people.
+func shortChecksum(sum string) string {
+	if len(sum) > 16 {
+		return sum[:16] + "…"
+	}
+	return sum
+}
+
+// exitIfChecksumMismatch reports the stages whose artifact doesn't match
+// the checksum recorded in its metadata on stderr and exits with
+// exitChecksum if there are any.
+func exitIfChecksumMismatch(reports ...report) {
+	var mismatch bool
+	for _, r := range reports {
+		for _, details := range r.Stages {
+			if c := details.Checksum; c != nil && c.Status == checksumMismatch {
+				mismatch = true
+				fmt.Fprintf(os.Stderr, "%s: stage %s: artifact checksum mismatch: metadata records %s, artifact hashes to %s\n", r.Pipeline, details.Name, c.Expected, c.Actual)
+			}
+		}
+	}
+	if mismatch {
+		os.Exit(exitChecksum)
+	}
+}
+
+// hasChecksumMismatch reports whether the artifact of any of the stages
+// doesn't match its checksum.
+func hasChecksumMismatch(stages []stageDetails) bool {
+	for _, details := range stages {
+		if details.Checksum != nil && details.Checksum.Status == checksumMismatch {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// unversionedS3 holds the current object of an unversioned bucket, its
+// ETag etag, and like S3 rejects reads that require another ETag.
+type unversionedS3 struct {
+	s3iface.S3API
+	etag    string
+	content []byte
+}
+
+func (u *unversionedS3) HeadObject(in *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+	if in.IfMatch != nil && *in.IfMatch != u.etag {
+		return nil, awserr.New("PreconditionFailed", "At least one of the pre-conditions you specified did not hold", nil)
+	}
+	sum := sha256.Sum256(u.content)
+	return &s3.HeadObjectOutput{
+		ETag:           aws.String(u.etag),
+		ChecksumSHA256: aws.String(base64.StdEncoding.EncodeToString(sum[:])),
+		ContentLength:  aws.Int64(int64(len(u.content))),
+	}, nil
+}
+
+func TestVerifyChecksumUnversioned(t *testing.T) {
+	deployed := `"5d41402abc4b2a76b9719d911017c592"`
+	sum := sha256.Sum256([]byte("deployed"))
+	meta := map[string]*string{checksumKey: aws.String(hex.EncodeToString(sum[:]))}
+
+	tests := []struct {
+		name   string
+		etag   string
+		status string
+		reason string
+	}{
+		{name: "deployed", etag: deployed, status: checksumVerified},
+		{name: "replaced", etag: `"7d793037a0760186574b0282f2f435e7"`, status: checksumUnverified, reason: errObjectReplaced.Error()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sess := withS3(t, &unversionedS3{etag: tt.etag, content: []byte("deployed")})
+			cfg := testCfg("app")
+			cfg.Bucket, cfg.Key, cfg.ChecksumMaxSize = "artifacts", tt.name+".zip", 1
+
+			c := verifyChecksum(sess, cfg, deployed, meta)
+			if c.Status != tt.status || c.Reason != tt.reason {
+				t.Errorf("verifyChecksum = %s (%q), want %s (%q)", c.Status, c.Reason, tt.status, tt.reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/codecommit"
+)
+
+// providerCodeCommit is the provider of CodeCommit source actions.
+const providerCodeCommit = "CodeCommit"
+
+// readCommit describes a CodeCommit revision, the commit itself is the
+// version. CodeCommit has no API listing the tags of a commit, so the
+// version is always the short SHA. The message, author and date are only
+// looked up when cfg asks for them.
+func readCommit(sess *session.Session, cfg Cfg, repo, revision string) (versionMeta, error) {
+	if revision == "" {
+		return versionMeta{}, nil
+	}
+
+	meta := versionMeta{Version: shortCommit(revision), Commit: revision}
+	describeCommit(sess, cfg, &meta, providerCodeCommit, repo)
+	return meta, nil
+}
+
+// commitCache remembers every commit looked up, commits never change.
+var commitCache = struct {
+	sync.Mutex
+	m map[string]*codecommit.Commit
+}{m: make(map[string]*codecommit.Commit)}
+
+// getCommit returns the commit of the named repository.
+func getCommit(sess *session.Session, repo, commitID string) (*codecommit.Commit, error) {
+	cacheKey := repo + "@" + commitID
+	commitCache.Lock()
+	commit, ok := commitCache.m[cacheKey]
+	commitCache.Unlock()
+	if ok {
+		return commit, nil
+	}
+
+	out, err := codecommit.New(sess).GetCommit(&codecommit.GetCommitInput{
+		RepositoryName: aws.String(repo),
+		CommitId:       aws.String(commitID),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			switch aerr.Code() {
+			default:
+				return nil, fmt.Errorf("failed to get commit: %s", aerr.Message())
+			}
+		}
+		return nil, err
+	}
+
+	commitCache.Lock()
+	commitCache.m[cacheKey] = out.Commit
+	commitCache.Unlock()
+	return out.Commit, nil
+}
+
+// parseGitDate parses a date the way CodeCommit reports it, Unix seconds
+// followed by the zone offset, e.g. "1484167798 -0800". nil if it can't.
+func parseGitDate(s string) *time.Time {
+	secs, zone, _ := strings.Cut(s, " ")
+	n, err := strconv.ParseInt(secs, 10, 64)
+	if err != nil {
+		return nil
+	}
+	t := time.Unix(n, 0)
+	if z, err := time.Parse("-0700", zone); err == nil {
+		t = t.In(z.Location())
+	}
+	return &t
+}
+
+// firstLine returns the subject line of a commit message.
+func firstLine(message string) string {
+	line, _, _ := strings.Cut(message, "\n")
+	return strings.TrimSpace(line)
+}
+
+// messageColumn shows the subject line of the commit of Git sources,
+// authorColumn who wrote it and commitDateColumn when.
+var (
+	messageColumn = column{
+		Name:  "message",
+		Title: "Message",
+		Wide:  true,
+		Value: func(_ report, d stageDetails) string { return firstLine(d.CommitMessage) },
+	}
+	authorColumn = column{
+		Name:  "author",
+		Title: "Author",
+		Wide:  true,
+		Value: func(_ report, d stageDetails) string { return d.CommitAuthor },
+	}
+	commitDateColumn = column{
+		Name:  "commitDate",
+		Title: "Commit Date",
+		Value: func(_ report, d stageDetails) string { return formatTime(d.CommitDate) },
+		Display: func(o renderOptions, r report, d stageDetails) string {
+			return o.Times.format(d.CommitDate, r.QueriedAt, false)
+		},
+	}
+)
+
+// wantsCommitDetails reports whether one of the columns describing the
+// commit is in spec.
+func wantsCommitDetails(spec string) bool {
+	return wantsColumn(spec, messageColumn.Name) || wantsColumn(spec, authorColumn.Name) || wantsColumn(spec, commitDateColumn.Name)
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/codedeploy"
+)
+
+// Providers of CodeDeploy deploy actions.
+const (
+	providerCodeDeploy      = "CodeDeploy"
+	providerCodeDeployToECS = "CodeDeployToECS"
+)
+
+// deploymentGroup is a CodeDeploy deployment group a stage deploys to.
+type deploymentGroup struct {
+	Application string
+	Group       string
+}
+
+// deploymentRuntime is the last deployment of a CodeDeploy deployment
+// group of a stage, checked against the revision of the stage.
+type deploymentRuntime struct {
+	Application  string `json:"application" yaml:"application"`
+	Group        string `json:"deploymentGroup" yaml:"deploymentGroup"`
+	Status       string `json:"status" yaml:"status"`
+	DeploymentID string `json:"deploymentId,omitempty" yaml:"deploymentId,omitempty"`
+	// State is the CodeDeploy status of the deployment, e.g. Succeeded.
+	State string `json:"state,omitempty" yaml:"state,omitempty"`
+	// Rollback is set when the deployment rolled back an earlier one.
+	Rollback bool `json:"rollback,omitempty" yaml:"rollback,omitempty"`
+	// Revision is the revision the deployment deployed, an S3 object
+	// version or a commit.
+	Revision string `json:"revision,omitempty" yaml:"revision,omitempty"`
+	// Progress counts the instances or tasks by their state while the
+	// deployment is in progress.
+	Progress *deploymentProgress `json:"progress,omitempty" yaml:"progress,omitempty"`
+	// Reason tells why the deployment couldn't be verified.
+	Reason string `json:"reason,omitempty" yaml:"reason,omitempty"`
+}
+
+// deploymentProgress is the overview of a deployment in progress.
+type deploymentProgress struct {
+	Pending    int64 `json:"pending" yaml:"pending"`
+	InProgress int64 `json:"inProgress" yaml:"inProgress"`
+	Succeeded  int64 `json:"succeeded" yaml:"succeeded"`
+	Failed     int64 `json:"failed" yaml:"failed"`
+	Skipped    int64 `json:"skipped" yaml:"skipped"`
+}
+
+// String renders the counts that aren't zero, e.g. "3 succeeded, 1 in
+// progress".
+func (p deploymentProgress) String() string {
+	var s []string
+	for _, c := range []struct {
+		n    int64
+		what string
+	}{{p.Succeeded, "succeeded"}, {p.InProgress, "in progress"}, {p.Pending, "pending"}, {p.Failed, "failed"}, {p.Skipped, "skipped"}} {
+		if c.n > 0 {
+			s = append(s, fmt.Sprintf("%d %s", c.n, c.what))
+		}
+	}
+	if len(s) == 0 {
+		return "starting"
+	}
+	return strings.Join(s, ", ")
+}
+
+// String renders the outcome, e.g. "DRIFTED (Succeeded rollback d-ABC,
+// revision 3HL4kqtJ)".
+func (d deploymentRuntime) String() string {
+	what := d.State + " " + d.DeploymentID
+	if d.Rollback {
+		what = d.State + " rollback " + d.DeploymentID
+	}
+	switch d.Status {
+	case runtimeOK:
+		return fmt.Sprintf("OK (%s)", what)
+	case runtimeDrifted:
+		return fmt.Sprintf("DRIFTED (%s, revision %s)", what, d.Revision)
+	case runtimeRollingOut:
+		return fmt.Sprintf("IN PROGRESS (%s: %s)", d.DeploymentID, d.Progress)
+	}
+	if d.State != "" {
+		return fmt.Sprintf("unverified (%s)", what)
+	}
+	return d.Status
+}
+
+// parseDeploymentGroups parses STAGE=APPLICATION/GROUP mappings, as given
+// by --deployment-group. A stage may be mapped to several groups.
+func parseDeploymentGroups(specs []string) (map[string][]deploymentGroup, error) {
+	groups := make(map[string][]deploymentGroup)
+	for _, spec := range specs {
+		if spec == "" {
+			continue
+		}
+		stage, path, _ := strings.Cut(spec, "=")
+		app, group, _ := strings.Cut(path, "/")
+		if stage == "" || app == "" || group == "" {
+			return nil, fmt.Errorf("invalid deployment group %q, want STAGE=APPLICATION/GROUP", spec)
+		}
+		groups[stage] = append(groups[stage], deploymentGroup{Application: app, Group: group})
+	}
+	return groups, nil
+}
+
+// stageDeploymentGroups returns the CodeDeploy deployment groups of the
+// stage, those --deployment-group maps it to or else the ones its
+// CodeDeploy deploy actions deploy to.
+func stageDeploymentGroups(cfg Cfg, details stageDetails) []deploymentGroup {
+	// validated on startup
+	explicit, _ := parseDeploymentGroups(cfg.DeploymentGroup)
+	if groups, ok := explicit[details.Name]; ok {
+		return groups
+	}
+	var groups []deploymentGroup
+	for _, t := range details.Targets {
+		if t.Provider != providerCodeDeploy && t.Provider != providerCodeDeployToECS {
+			continue
+		}
+		if app, group, ok := strings.Cut(t.Target, "/"); ok && app != "" && group != "" {
+			groups = append(groups, deploymentGroup{Application: app, Group: group})
+		}
+	}
+	return groups
+}
+
+// verifyDeployments checks the last deployment of every CodeDeploy
+// deployment group of the stage against the revision the stage deployed.
+// nil if it deploys to none. Groups that can't be read are left
+// unverified with a warning.
+func verifyDeployments(execs *executionCache, sess *session.Session, cfg Cfg, details stageDetails) []deploymentRuntime {
+	groups := stageDeploymentGroups(cfg, details)
+	if len(groups) == 0 {
+		return nil
+	}
+
+	expected, err := deployedArtifacts(execs, details)
+	if err != nil {
+		warnUnverified("stage "+details.Name+" CodeDeploy revision", err)
+	}
+	runtimes := make([]deploymentRuntime, len(groups))
+	for i, g := range groups {
+		rt := deploymentRuntime{Application: g.Application, Group: g.Group}
+		if err := checkDeployment(sess, g, details, expected, &rt); err != nil {
+			rt.Status, rt.Reason = runtimeUnverified, err.Error()
+			warnUnverified(fmt.Sprintf("CodeDeploy deployment group %s/%s", g.Application, g.Group), err)
+		}
+		runtimes[i] = rt
+	}
+	return runtimes
+}
+
+// deployedArtifacts returns the input artifacts the CodeDeploy deploy
+// actions of the stage handed to CodeDeploy in the execution that completed
+// it, as bucket/key. The artifact store keeps every one under its own key.
+func deployedArtifacts(execs *executionCache, details stageDetails) (map[string]bool, error) {
+	execID := details.deployedExecution()
+	if execID == "" {
+		return nil, nil
+	}
+	actions, err := execs.actionExecutions(execID)
+	if err != nil {
+		return nil, err
+	}
+
+	artifacts := make(map[string]bool)
+	for _, action := range actions {
+		in := action.Input
+		if aws.StringValue(action.StageName) != details.Name || in == nil || in.ActionTypeId == nil {
+			continue
+		}
+		if p := aws.StringValue(in.ActionTypeId.Provider); p != providerCodeDeploy && p != providerCodeDeployToECS {
+			continue
+		}
+		for _, a := range in.InputArtifacts {
+			if loc := a.S3location; loc != nil {
+				artifacts[aws.StringValue(loc.Bucket)+"/"+aws.StringValue(loc.Key)] = true
+			}
+		}
+	}
+	return artifacts, nil
+}
+
+// checkDeployment looks up the last deployment attempted in the group and
+// compares its revision with the one of the stage: the input artifact of
+// its deploy action, the stage artifact version or its commit. The group
+// tells its last deployment, the order ListDeployments returns them in
+// isn't documented.
+func checkDeployment(sess *session.Session, g deploymentGroup, details stageDetails, expected map[string]bool, rt *deploymentRuntime) error {
+	svc := codedeploy.New(sess)
+	group, err := svc.GetDeploymentGroup(&codedeploy.GetDeploymentGroupInput{
+		ApplicationName:     aws.String(g.Application),
+		DeploymentGroupName: aws.String(g.Group),
+	})
+	if err != nil {
+		return codeDeployError(err, fmt.Sprintf("failed to get deployment group %s/%s", g.Application, g.Group))
+	}
+	last := group.DeploymentGroupInfo.LastAttemptedDeployment
+	if last == nil || last.DeploymentId == nil {
+		return fmt.Errorf("deployment group %s/%s has no deployments", g.Application, g.Group)
+	}
+
+	out, err := svc.GetDeployment(&codedeploy.GetDeploymentInput{DeploymentId: last.DeploymentId})
+	if err != nil {
+		return codeDeployError(err, "failed to get deployment "+aws.StringValue(last.DeploymentId))
+	}
+	d := out.DeploymentInfo
+	rt.DeploymentID = aws.StringValue(d.DeploymentId)
+	rt.State = aws.StringValue(d.Status)
+	rt.Rollback = d.RollbackInfo != nil && aws.StringValue(d.RollbackInfo.RollbackTriggeringDeploymentId) != ""
+
+	matches, comparable := false, false
+	if rev := d.Revision; rev != nil {
+		switch {
+		case rev.S3Location != nil:
+			loc := rev.S3Location
+			bucket, key, version := aws.StringValue(loc.Bucket), aws.StringValue(loc.Key), aws.StringValue(loc.Version)
+			rt.Revision = version
+			if version == "" {
+				rt.Revision = "s3://" + bucket + "/" + key
+			}
+			if bucket == details.Bucket && key == details.Key {
+				comparable, matches = true, version == details.RevisionID
+			} else if expected != nil {
+				comparable, matches = true, expected[bucket+"/"+key]
+			}
+		case rev.GitHubLocation != nil:
+			rt.Revision = aws.StringValue(rev.GitHubLocation.CommitId)
+			comparable = details.Commit != "" && !isPlaceholder(details.Commit)
+			matches = comparable && rt.Revision == details.Commit
+		}
+	}
+
+	switch {
+	case deploymentInProgress(rt.State):
+		rt.Status = runtimeRollingOut
+		if o := d.DeploymentOverview; o != nil {
+			rt.Progress = &deploymentProgress{
+				Pending:    aws.Int64Value(o.Pending),
+				InProgress: aws.Int64Value(o.InProgress),
+				Succeeded:  aws.Int64Value(o.Succeeded),
+				Failed:     aws.Int64Value(o.Failed),
+				Skipped:    aws.Int64Value(o.Skipped),
+			}
+		} else {
+			rt.Progress = &deploymentProgress{}
+		}
+	// a failed deployment may have left some instances on either revision
+	case rt.State == codedeploy.DeploymentStatusFailed || rt.State == codedeploy.DeploymentStatusStopped:
+		rt.Status = runtimeDrifted
+	case !comparable:
+		rt.Status, rt.Reason = runtimeUnverified, "the revision of the deployment can't be told apart from others"
+	case matches:
+		rt.Status = runtimeOK
+	default:
+		rt.Status = runtimeDrifted
+	}
+	return nil
+}
+
+// deploymentInProgress reports whether a deployment in state is still
+// under way.
+func deploymentInProgress(state string) bool {
+	switch state {
+	case codedeploy.DeploymentStatusCreated, codedeploy.DeploymentStatusQueued, codedeploy.DeploymentStatusInProgress, codedeploy.DeploymentStatusBaking, codedeploy.DeploymentStatusReady:
+		return true
+	}
+	return false
+}
+
+// codeDeployError describes a failed CodeDeploy call, doing what failed.
+func codeDeployError(err error, doing string) error {
+	if aerr, ok := err.(awserr.Error); ok {
+		switch aerr.Code() {
+		case codedeploy.ErrCodeApplicationDoesNotExistException, codedeploy.ErrCodeDeploymentGroupDoesNotExistException:
+			return fmt.Errorf("%s: not found", doing)
+		default:
+			return fmt.Errorf("%s: %s", doing, aerr.Message())
+		}
+	}
+	return err
+}
+
+// deploymentsSummary renders the outcome for every deployment group of a
+// stage on a single line, naming the groups when there are several.
+func deploymentsSummary(runtimes []deploymentRuntime) string {
+	if len(runtimes) == 1 {
+		return runtimes[0].String()
+	}
+	s := make([]string, len(runtimes))
+	for i, rt := range runtimes {
+		s[i] = rt.Group + " " + rt.String()
+	}
+	return strings.Join(s, "; ")
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// column describes a single column of the tabular output formats.
+type column struct {
+	// Name identifies the column in --columns and is used as the csv header.
+	Name string
+	// Title is the header shown in table and tsv output.
+	Title string
+	// Wide columns get an extra tab stop in the aligned table, their
+	// values tend to be longer than the tab width.
+	Wide bool
+	// Value extracts the cell value for a stage.
+	Value func(r report, details stageDetails) string
+	// Display, when set, renders the value for the aligned table, e.g. to
+	// shorten it. Machine readable formats always get Value.
+	Display func(o renderOptions, r report, details stageDetails) string
+}
+
+// columns lists every column that can be selected, in no particular order.
+var columns = []column{
+	{Name: "pipeline", Title: "Pipeline", Value: func(r report, _ stageDetails) string { return r.Pipeline }},
+	{Name: "stage", Title: "Stage", Value: func(_ report, d stageDetails) string { return d.Name }},
+	{Name: "status", Title: "Status", Value: func(_ report, d stageDetails) string { return d.Status },
+		Display: func(o renderOptions, r report, d stageDetails) string {
+			if d.Approval != nil && d.Approval.Status == approvalPending {
+				return "Awaiting Approval (" + o.Times.format(d.Approval.Since, r.QueriedAt, true) + ")"
+			}
+			if d.Stuck {
+				return stuckStatus(d, r.QueriedAt)
+			}
+			if d.Superseded != nil {
+				return supersededStatus(d.Superseded)
+			}
+			if d.Rollback != nil && d.Status == "Succeeded" {
+				return rollbackStatus(d.Rollback)
+			}
+			return d.displayStatus()
+		}},
+	{Name: "version", Title: "Version", Wide: true, Value: func(_ report, d stageDetails) string { return d.Version },
+		Display: func(_ renderOptions, _ report, d stageDetails) string { return d.displayVersion() }},
+	{Name: "commit", Title: "Commit", Value: func(_ report, d stageDetails) string { return d.Commit },
+		Display: func(o renderOptions, _ report, d stageDetails) string { return o.displayCommit(d.Commit) }},
+	{Name: "branch", Title: "Branch", Value: func(_ report, d stageDetails) string { return d.Branch },
+		Display: func(_ renderOptions, _ report, d stageDetails) string {
+			if d.Branch == "" {
+				return "-"
+			}
+			return d.Branch
+		}},
+	{Name: "repository", Title: "Repository", Wide: true, Value: func(_ report, d stageDetails) string { return d.Repository },
+		Display: func(_ renderOptions, _ report, d stageDetails) string {
+			if d.Repository == "" {
+				return "-"
+			}
+			return d.Repository
+		}},
+	{Name: "releaseUrl", Title: "Release URL", Wide: true, Value: func(_ report, d stageDetails) string { return d.ReleaseURL }},
+	{Name: "executionId", Title: "ExecutionID", Value: func(_ report, d stageDetails) string { return d.ExecutionID }},
+	{Name: "revisionId", Title: "RevisionID", Value: func(_ report, d stageDetails) string { return d.RevisionID }},
+	{Name: "lastStatusChange", Title: "LastStatusChange", Value: func(_ report, d stageDetails) string { return formatTime(d.LastStatusChange) },
+		Display: func(o renderOptions, r report, d stageDetails) string {
+			return o.Times.format(d.LastStatusChange, r.QueriedAt, false)
+		}},
+	{Name: "age", Title: "Age", Value: func(_ report, d stageDetails) string { return formatTime(d.LastStatusChange) },
+		Display: func(o renderOptions, r report, d stageDetails) string {
+			return o.Times.format(d.LastStatusChange, r.QueriedAt, true)
+		}},
+	{Name: "executionUrl", Title: "Execution URL", Value: func(r report, d stageDetails) string {
+		if d.ExecutionID == "" {
+			return ""
+		}
+		return executionConsoleURL(r.Region, r.Pipeline, d.ExecutionID)
+	}},
+	{Name: "approval", Title: "Approval", Wide: true, Value: func(_ report, d stageDetails) string {
+		if d.Approval == nil {
+			return ""
+		}
+		return d.Approval.String()
+	}},
+	{Name: "inbound", Title: "Inbound", Wide: true, Value: func(_ report, d stageDetails) string { return inboundSummary(d.Inbound) }},
+	{Name: "trigger", Title: "Trigger", Wide: true, Value: func(_ report, d stageDetails) string { return d.Trigger.String() },
+		Display: func(_ renderOptions, _ report, d stageDetails) string {
+			if d.Trigger == nil {
+				return "-"
+			}
+			return d.Trigger.String()
+		}},
+	durationColumn,
+	deployedAtColumn,
+	deployedForColumn,
+	builtColumn,
+	behindColumn,
+	targetColumn,
+	buildColumn,
+	signatureColumn,
+	runtimeColumn,
+	liveColumn,
+	parameterColumn,
+	messageColumn,
+	authorColumn,
+	commitDateColumn,
+	{Name: "queriedAt", Title: "Queried At", Value: func(r report, _ stageDetails) string { return r.QueriedAt.Format(time.RFC3339) }},
+}
+
+// Default column sets of the tabular formats.
+var (
+	defaultTableColumns = []string{"stage", "status", "version", "releaseUrl", "executionId", "age"}
+	wideTableColumns    = []string{"stage", "status", "version", "commit", "repository", "branch", "releaseUrl", "executionId", "revisionId", "trigger", "lastStatusChange", "age"}
+	defaultCSVColumns   = []string{"pipeline", "stage", "status", "version", "commit", "executionId", "lastStatusChange", "queriedAt"}
+)
+
+// columnNames returns the names of all selectable columns.
+func columnNames() []string {
+	names := make([]string, len(columns))
+	for i, c := range columns {
+		names[i] = c.Name
+	}
+	return names
+}
+
+// parseColumns resolves a comma separated list of column names, matched
+// case-insensitively, into columns in the given order.
+func parseColumns(spec string) ([]column, error) {
+	var cols []column
+
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		col, ok := lookupColumn(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown column %q, valid columns are: %s", name, strings.Join(columnNames(), ", "))
+		}
+		cols = append(cols, col)
+	}
+
+	if len(cols) == 0 {
+		return nil, fmt.Errorf("no columns selected, valid columns are: %s", strings.Join(columnNames(), ", "))
+	}
+
+	return cols, nil
+}
+
+// lookupColumn finds a column by its case-insensitive name.
+func lookupColumn(name string) (column, bool) {
+	for _, c := range columns {
+		if strings.EqualFold(c.Name, name) {
+			return c, true
+		}
+	}
+	return column{}, false
+}
+
+// formatTime renders an optional timestamp as RFC3339, nil renders empty.
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// humanDuration renders d compactly, e.g. "45s", "12m", "3h12m" or "2d".
+func humanDuration(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh%dm", int(d.Hours()), int(d.Minutes())%60)
+	}
+	return fmt.Sprintf("%dd", int(d.Hours()/24))
+}
+
+// mustColumns resolves a built in column set.
+func mustColumns(names []string) []column {
+	cols, err := parseColumns(strings.Join(names, ","))
+	if err != nil {
+		panic(err)
+	}
+	return cols
+}
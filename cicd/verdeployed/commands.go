@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Subcommands, given as the first argument. Without one the pipeline is
+// reported.
+const (
+	cmdReport   = ""
+	cmdWaitFor  = "wait-for"
+	cmdRetry    = "retry"
+	cmdApprove  = "approve"
+	cmdReject   = "reject"
+	cmdStart    = "start"
+	cmdStop     = "stop"
+	cmdFreeze   = "freeze"
+	cmdUnfreeze = "unfreeze"
+	cmdCompare  = "compare"
+	cmdFleet    = "fleet"
+	cmdDownload = "download"
+)
+
+// commands lists the valid subcommands.
+var commands = []string{cmdWaitFor, cmdRetry, cmdApprove, cmdReject, cmdStart, cmdStop, cmdFreeze, cmdUnfreeze, cmdCompare, cmdFleet, cmdDownload}
+
+// commandFlags renames the flags of a subcommand that clash with those
+// conf handles itself, --version would print the program version, or read
+// better under another name there.
+var commandFlags = map[string]map[string]string{
+	cmdWaitFor:  {"--version": "--release"},
+	cmdCompare:  {"--pipelines": "--pipeline-name"},
+	cmdDownload: {"--out": "--output"},
+}
+
+// listFlags names the flags that may be repeated, whatever the subcommand,
+// and commandLists those of a single subcommand. conf keeps only the last
+// occurrence of a flag and splits values on ";", so their values are
+// collected by parseCommand and set by setLists instead.
+var (
+	listFlags    = []string{"--artifact", "--ecs-service", "--beanstalk-env", "--deployment-group", "--check", "--ssm-parameter", "--lambda-function"}
+	commandLists = map[string][]string{
+		cmdStart: {"--var"},
+	}
+)
+
+// parseCommand splits the subcommand and the values of the repeatable flags
+// off the command line arguments, the rest is left to conf.
+func parseCommand(args []string) (string, []string, map[string][]string, error) {
+	cmd, first := cmdReport, 0
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		cmd, first = args[0], 1
+		var known bool
+		for _, c := range commands {
+			known = known || c == cmd
+		}
+		if !known {
+			return "", nil, nil, fmt.Errorf("unknown command %q, valid commands are: %s", cmd, strings.Join(commands, ", "))
+		}
+	}
+
+	rest := make([]string, 0, len(args)-first)
+	lists := make(map[string][]string)
+	for i := first; i < len(args); i++ {
+		arg := args[i]
+		name, value, hasValue := strings.Cut(arg, "=")
+
+		if isListFlag(cmd, name) {
+			if !hasValue {
+				if i+1 == len(args) || strings.HasPrefix(args[i+1], "--") {
+					return "", nil, nil, fmt.Errorf("%s requires a value", name)
+				}
+				i++
+				value = args[i]
+			}
+			lists[name] = append(lists[name], value)
+			continue
+		}
+
+		if renamed, ok := commandFlags[cmd][name]; ok {
+			arg = renamed
+			if hasValue {
+				arg += "=" + value
+			}
+		}
+		rest = append(rest, arg)
+	}
+
+	return cmd, rest, lists, nil
+}
+
+// setLists sets the repeatable flags parseCommand collected, overriding
+// the values conf read from the environment.
+func setLists(cfg *Cfg, lists map[string][]string) {
+	fields := map[string]*[]string{
+		"--artifact":         &cfg.Artifact,
+		"--ecs-service":      &cfg.ECSService,
+		"--beanstalk-env":    &cfg.BeanstalkEnv,
+		"--deployment-group": &cfg.DeploymentGroup,
+		"--check":            &cfg.Check,
+		"--ssm-parameter":    &cfg.SSMParameter,
+		"--lambda-function":  &cfg.LambdaFunction,
+		"--var":              &cfg.Var,
+	}
+	for name, values := range lists {
+		*fields[name] = values
+	}
+}
+
+// isListFlag reports whether name is a repeatable flag of cmd.
+func isListFlag(cmd, name string) bool {
+	for _, list := range append(listFlags, commandLists[cmd]...) {
+		if list == name {
+			return true
+		}
+	}
+	return false
+}
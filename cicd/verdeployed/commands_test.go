@@ -0,0 +1,34 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCommandLists(t *testing.T) {
+	cmd, rest, lists, err := parseCommand([]string{"start", "--check", "a", "--var=x=1", "--pipeline-name", "app", "--check=b", "--var", "y=2"})
+	if err != nil {
+		t.Fatalf("parseCommand: %v", err)
+	}
+	if cmd != cmdStart {
+		t.Errorf("command = %q, want %q", cmd, cmdStart)
+	}
+	if want := []string{"--pipeline-name", "app"}; !reflect.DeepEqual(rest, want) {
+		t.Errorf("rest = %q, want %q", rest, want)
+	}
+	want := map[string][]string{"--check": {"a", "b"}, "--var": {"x=1", "y=2"}}
+	if !reflect.DeepEqual(lists, want) {
+		t.Errorf("lists = %q, want %q", lists, want)
+	}
+}
+
+func TestParseCommandListWithoutValue(t *testing.T) {
+	for _, args := range [][]string{
+		{"--check"},
+		{"--check", "--pipeline-name", "app"},
+	} {
+		if _, _, _, err := parseCommand(args); err == nil || err.Error() != "--check requires a value" {
+			t.Errorf("parseCommand(%q) error = %v, want --check requires a value", args, err)
+		}
+	}
+}
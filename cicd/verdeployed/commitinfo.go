@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// commitInfo is what is known of a commit besides its SHA.
+type commitInfo struct {
+	Message string
+	Author  string
+	Date    *time.Time
+}
+
+// lookupCommit describes the commit sha of repo, a CodeCommit repository
+// name or the owner/name of a GitHub one depending on provider. GitHub
+// commits are left undescribed without a token.
+func lookupCommit(sess *session.Session, provider, repo, sha string) (commitInfo, bool, error) {
+	switch provider {
+	case providerCodeCommit:
+		commit, err := getCommit(sess, repo, sha)
+		if err != nil {
+			return commitInfo{}, false, err
+		}
+		info := commitInfo{Message: strings.TrimSpace(aws.StringValue(commit.Message))}
+		if commit.Author != nil {
+			info.Author = aws.StringValue(commit.Author.Name)
+			info.Date = parseGitDate(aws.StringValue(commit.Author.Date))
+		}
+		return info, true, nil
+	case providerCodeStar:
+		token := os.Getenv(githubTokenEnv)
+		if token == "" {
+			return commitInfo{}, false, nil
+		}
+		commit, err := getGitHubCommit(token, repo, sha)
+		if err != nil {
+			return commitInfo{}, false, err
+		}
+		return commitInfo{
+			Message: strings.TrimSpace(commit.Message),
+			Author:  commit.Author.Name,
+			Date:    commit.Author.Date,
+		}, true, nil
+	}
+	return commitInfo{}, false, nil
+}
+
+// describeCommit fills in the message, author and date of the commit of
+// meta when cfg asks for them. A commit that can't be looked up, pushed
+// away or looked for in the wrong repository, only gets a warning and
+// keeps its bare SHA.
+func describeCommit(sess *session.Session, cfg Cfg, meta *versionMeta, provider, repo string) {
+	if !cfg.CommitDetails || repo == "" || meta.Commit == "" || isPlaceholder(meta.Commit) {
+		return
+	}
+
+	info, ok, err := lookupCommit(sess, provider, repo, meta.Commit)
+	if err != nil {
+		warnCommit(meta.Commit, err)
+		return
+	}
+	if ok {
+		meta.Message, meta.Author, meta.Date = info.Message, info.Author, info.Date
+	}
+}
+
+// commitRepository returns the provider and repository the commits read
+// from the metadata of S3 artifacts belong to, set by --commit-repo or
+// --github-repo.
+func commitRepository(cfg Cfg) (provider, repo string) {
+	if cfg.CommitRepo != "" {
+		return providerCodeCommit, cfg.CommitRepo
+	}
+	if cfg.GitHubRepo != "" {
+		return providerCodeStar, cfg.GitHubRepo
+	}
+	return "", ""
+}
+
+// warnedCommits remembers the commits warned about, stages often share
+// one.
+var warnedCommits sync.Map
+
+// warnCommit reports on stderr that commit couldn't be described, once
+// per commit.
+func warnCommit(commit string, err error) {
+	if _, warned := warnedCommits.LoadOrStore(commit, true); warned {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "warning: failed to describe commit %s: %v\n", shortCommit(commit), err)
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// validCompareFormat reports whether format can render a comparison.
+func validCompareFormat(format string) error {
+	switch format {
+	case formatTable, formatJSON:
+		return nil
+	}
+	return fmt.Errorf("compare is not supported by the %s format", format)
+}
+
+// comparedStage is what a stage runs in one of the compared pipelines.
+type comparedStage struct {
+	Status      string `json:"status"`
+	Version     string `json:"version"`
+	Commit      string `json:"commit"`
+	ExecutionID string `json:"executionId"`
+}
+
+// comparedRow lines up the stage of the same name across the pipelines.
+type comparedRow struct {
+	Name string `json:"stageName"`
+	// Pipelines holds the stage in every pipeline, in the order the
+	// pipelines were compared. Pipelines without the stage hold null.
+	Pipelines []*comparedStage `json:"pipelines"`
+	// Differs is set when the stage doesn't run the same version in every
+	// pipeline, or is missing from some.
+	Differs bool `json:"differs"`
+}
+
+// comparison is the result of the compare command.
+type comparison struct {
+	Pipelines []string      `json:"pipelines"`
+	Stages    []comparedRow `json:"stages"`
+	Differs   bool          `json:"differs"`
+}
+
+// compareReports aligns the stages of the reports by name. Stages are
+// listed in the order of the first pipeline, stages only found in later
+// pipelines follow the stage they come after there.
+func compareReports(reports []report) comparison {
+	c := comparison{Pipelines: make([]string, len(reports))}
+
+	index := make(map[string]int)
+	for i, r := range reports {
+		c.Pipelines[i] = r.Pipeline
+
+		pos := 0
+		for _, details := range r.Stages {
+			row, ok := index[details.Name]
+			if !ok {
+				row = pos
+				c.Stages = append(c.Stages, comparedRow{})
+				copy(c.Stages[row+1:], c.Stages[row:])
+				c.Stages[row] = comparedRow{
+					Name:      details.Name,
+					Pipelines: make([]*comparedStage, len(reports)),
+				}
+				for name, j := range index {
+					if j >= row {
+						index[name] = j + 1
+					}
+				}
+				index[details.Name] = row
+			}
+			c.Stages[row].Pipelines[i] = &comparedStage{
+				Status:      details.Status,
+				Version:     details.Version,
+				Commit:      details.Commit,
+				ExecutionID: details.ExecutionID,
+			}
+			pos = row + 1
+		}
+	}
+
+	for i := range c.Stages {
+		row := &c.Stages[i]
+		for _, s := range row.Pipelines {
+			if s == nil || s.Version != row.Pipelines[0].version() {
+				row.Differs = true
+			}
+		}
+		c.Differs = c.Differs || row.Differs
+	}
+
+	return c
+}
+
+// version returns the version of the stage, empty when it is missing.
+func (s *comparedStage) version() string {
+	if s == nil {
+		return ""
+	}
+	return s.Version
+}
+
+// renderComparison writes the comparison in the requested format.
+func renderComparison(w io.Writer, format string, opts renderOptions, c comparison) error {
+	if format == formatJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(c)
+	}
+
+	rows := make([][]string, len(c.Stages))
+	for i, row := range c.Stages {
+		cells := []string{row.Name}
+		for _, s := range row.Pipelines {
+			if s == nil {
+				cells = append(cells, "", "")
+				continue
+			}
+			cells = append(cells, s.Status, tsvEscaper.Replace(s.Version))
+		}
+		diff := ""
+		if row.Differs {
+			diff = "≠"
+		}
+		rows[i] = append(cells, diff)
+	}
+
+	if opts.Plain {
+		titles := []string{"Stage"}
+		for _, p := range c.Pipelines {
+			titles = append(titles, p+" Status", p+" Version")
+		}
+		titles = append(titles, "Diff")
+		if !opts.NoHeader {
+			io.WriteString(w, strings.Join(titles, "\t")+"\n")
+		}
+		for _, cells := range rows {
+			if _, err := io.WriteString(w, strings.Join(cells, "\t")+"\n"); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// the pipeline names head their column group, the second header row
+	// names the columns of each group
+	titles := []string{"Stage"}
+	subtitles := []string{"----"}
+	for _, p := range c.Pipelines {
+		titles = append(titles, p, "")
+		subtitles = append(subtitles, "Status", "Version")
+	}
+	titles = append(titles, "Diff")
+	subtitles = append(subtitles, "----")
+
+	var buf bytes.Buffer
+	tw := new(tabwriter.Writer)
+	// minwidth, tabwidth, padding, padchar, flags
+	tw.Init(&buf, 8, 8, 1, '\t', 0)
+	for _, cells := range append([][]string{titles, subtitles}, rows...) {
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if !opts.Color {
+		_, err := buf.WriteTo(w)
+		return err
+	}
+
+	return decorateTable(w, &buf, rows, func(row, col int, cell string) string {
+		if col == 0 || col == len(rows[row])-1 {
+			return cell
+		}
+		s := c.Stages[row].Pipelines[(col-1)/2]
+		switch {
+		case s == nil:
+		case col%2 == 1:
+			if color := statusColor(s.Status, s.ExecutionID != ""); color != "" {
+				cell = color + cell + ansiReset
+			}
+		case c.Stages[row].Differs:
+			cell = ansiYellow + cell + ansiReset
+		}
+		return cell
+	}, nil)
+}
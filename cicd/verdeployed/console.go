@@ -0,0 +1,24 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// consoleBaseURL returns the AWS console endpoint of a region.
+func consoleBaseURL(region string) string {
+	return fmt.Sprintf("https://%s.console.aws.amazon.com", region)
+}
+
+// pipelineConsoleURL returns the CodePipeline console page of a pipeline.
+func pipelineConsoleURL(region, pipeline string) string {
+	return fmt.Sprintf("%s/codesuite/codepipeline/pipelines/%s/view?region=%s",
+		consoleBaseURL(region), url.PathEscape(pipeline), url.QueryEscape(region))
+}
+
+// executionConsoleURL returns the CodePipeline console page of a single
+// pipeline execution.
+func executionConsoleURL(region, pipeline, executionID string) string {
+	return fmt.Sprintf("%s/codesuite/codepipeline/pipelines/%s/executions/%s/timeline?region=%s",
+		consoleBaseURL(region), url.PathEscape(pipeline), url.PathEscape(executionID), url.QueryEscape(region))
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// Versions shown for revisions whose object version was deleted since,
+// by a lifecycle rule or by hand, and for those whose object is gone
+// altogether, hidden behind a delete marker.
+const (
+	versionDeletedVersion = "artifact version deleted"
+	objectDeletedVersion  = "artifact deleted"
+)
+
+// errVersionDeleted and errObjectDeleted are returned when the artifact
+// version of a revision no longer exists.
+var (
+	errVersionDeleted = errors.New("artifact version deleted")
+	errObjectDeleted  = errors.New("artifact deleted, its current version is a delete marker")
+)
+
+// isDeletedVersion reports whether err, returned reading a version id,
+// may tell the version doesn't exist. HEAD responses carry no error body,
+// a missing version is a bare NotFound and a delete marker a
+// MethodNotAllowed; a wrong key or bucket is a NotFound as well, see
+// deletedVersionError.
+func isDeletedVersion(err error) bool {
+	if aerr, ok := err.(awserr.Error); ok {
+		switch aerr.Code() {
+		case "NotFound", "NoSuchKey", "NoSuchVersion", "MethodNotAllowed":
+			return true
+		}
+	}
+	return false
+}
+
+// deletedVersionError tells whether the version ver, which isDeletedVersion
+// says is missing, was deleted: errObjectDeleted when the latest version of
+// the object is a delete marker, errVersionDeleted when other versions of
+// it are left. It is nil when the key has no versions at all or they can't
+// be listed, the error reading ver is then the one to report, e.g. for a
+// wrong --key.
+func deletedVersionError(svc s3iface.S3API, cfg Cfg, ver string) error {
+	out, err := svc.ListObjectVersions(&s3.ListObjectVersionsInput{
+		Bucket:  aws.String(cfg.Bucket),
+		Prefix:  aws.String(cfg.Key),
+		MaxKeys: aws.Int64(10),
+	})
+	if err != nil {
+		return nil
+	}
+
+	var exists bool
+	for _, marker := range out.DeleteMarkers {
+		if aws.StringValue(marker.Key) != cfg.Key {
+			continue
+		}
+		if aws.BoolValue(marker.IsLatest) {
+			return errObjectDeleted
+		}
+		exists = true
+	}
+	for _, version := range out.Versions {
+		exists = exists || aws.StringValue(version.Key) == cfg.Key
+	}
+	if !exists {
+		return nil
+	}
+
+	if cfg.Verbose {
+		fmt.Fprintf(os.Stderr, "version %s of s3://%s/%s no longer exists\n", ver, cfg.Bucket, cfg.Key)
+	}
+	return errVersionDeleted
+}
+
+// unavailableVersion returns the version shown for a revision whose
+// metadata can't be read because of err, if it is one of the expected
+// conditions rather than a failure. deleted is set when the artifact
+// version is gone.
+func unavailableVersion(err error) (version string, deleted, ok bool) {
+	switch {
+	case errors.Is(err, errObjectReplaced):
+		return objectReplacedVersion, false, true
+	case errors.Is(err, errVersionDeleted):
+		return versionDeletedVersion, true, true
+	case errors.Is(err, errObjectDeleted):
+		return objectDeletedVersion, true, true
+	}
+	return "", false, false
+}
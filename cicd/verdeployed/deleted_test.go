@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// versionsS3 answers HeadObject like headS3 and ListObjectVersions with
+// out, or err.
+type versionsS3 struct {
+	headS3
+	out *s3.ListObjectVersionsOutput
+	err error
+}
+
+func (v *versionsS3) ListObjectVersions(*s3.ListObjectVersionsInput) (*s3.ListObjectVersionsOutput, error) {
+	return v.out, v.err
+}
+
+func TestReadVersionNotFound(t *testing.T) {
+	notFound := awserr.New("NotFound", "Not Found", nil)
+	tests := []struct {
+		name    string
+		out     *s3.ListObjectVersionsOutput
+		err     error
+		version string
+		wantErr string
+	}{
+		{
+			name: "other versions left",
+			out: &s3.ListObjectVersionsOutput{Versions: []*s3.ObjectVersion{
+				{Key: aws.String("app.zip"), VersionId: aws.String("v2"), IsLatest: aws.Bool(true)},
+			}},
+			version: versionDeletedVersion,
+		},
+		{
+			name: "latest delete marker",
+			out: &s3.ListObjectVersionsOutput{
+				DeleteMarkers: []*s3.DeleteMarkerEntry{{Key: aws.String("app.zip"), IsLatest: aws.Bool(true)}},
+				Versions:      []*s3.ObjectVersion{{Key: aws.String("app.zip"), VersionId: aws.String("v2")}},
+			},
+			version: objectDeletedVersion,
+		},
+		{
+			// a wrong --key, only keys sharing its prefix have versions
+			name: "no versions of the key",
+			out: &s3.ListObjectVersionsOutput{Versions: []*s3.ObjectVersion{
+				{Key: aws.String("app.zip.sig"), VersionId: aws.String("v2"), IsLatest: aws.Bool(true)},
+			}},
+			wantErr: "not found, check --bucket and --key",
+		},
+		{
+			name:    "listing denied",
+			err:     awserr.New("AccessDenied", "Access Denied", nil),
+			wantErr: "not found, check --bucket and --key",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &versionsS3{headS3: headS3{err: notFound}, out: tt.out, err: tt.err}
+			sess := withS3(t, svc)
+			cfg := testCfg("app")
+			cfg.Bucket, cfg.Key = "bucket", "app.zip"
+
+			meta, err := readVersion(sess, cfg, versionSource{}, "v1")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("readVersion = %q, %v, want an error containing %q", meta.Version, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readVersion: %v", err)
+			}
+			if meta.Version != tt.version || !meta.Incomplete {
+				t.Errorf("readVersion = %q incomplete %v, want %q incomplete", meta.Version, meta.Incomplete, tt.version)
+			}
+		})
+	}
+}
+
+func TestDeletedVersionErrorListingFails(t *testing.T) {
+	svc := &versionsS3{err: errors.New("connection reset")}
+	cfg := testCfg("app")
+	cfg.Bucket, cfg.Key = "bucket", "app.zip"
+
+	if err := deletedVersionError(svc, cfg, "v1"); err != nil {
+		t.Errorf("deletedVersionError = %v, want nil so the original error is reported", err)
+	}
+}
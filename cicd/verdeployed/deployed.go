@@ -0,0 +1,46 @@
+package main
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/codepipeline"
+)
+
+// getDeployedAt returns when the last succeeded deploy action of the stage
+// in actions finished, nil if it has none, e.g. because the action history
+// of the execution aged out.
+func getDeployedAt(stage string, actions []*codepipeline.ActionExecutionDetail) *time.Time {
+	var deployedAt *time.Time
+	for _, action := range actions {
+		if aws.StringValue(action.StageName) != stage || aws.StringValue(action.Status) != codepipeline.ActionExecutionStatusSucceeded {
+			continue
+		}
+		if action.Input == nil || action.Input.ActionTypeId == nil || aws.StringValue(action.Input.ActionTypeId.Category) != codepipeline.ActionCategoryDeploy {
+			continue
+		}
+		if action.LastUpdateTime != nil && (deployedAt == nil || action.LastUpdateTime.After(*deployedAt)) {
+			deployedAt = action.LastUpdateTime
+		}
+	}
+	return deployedAt
+}
+
+// deployedAtColumn shows when the stage finished deploying its version.
+var deployedAtColumn = column{
+	Name:  "deployedAt",
+	Title: "Deployed At",
+	Value: func(_ report, d stageDetails) string { return formatTime(d.DeployedAt) },
+	Display: func(o renderOptions, r report, d stageDetails) string {
+		return o.Times.format(d.DeployedAt, r.QueriedAt, false)
+	},
+}
+
+// withDeployedAt appends the deployedAt column to the default columns of
+// --deployed-at, a --columns selection places it itself.
+func (o renderOptions) withDeployedAt(cols []column) []column {
+	if !o.DeployedAt || o.Columns != nil {
+		return cols
+	}
+	return append(cols[:len(cols):len(cols)], deployedAtColumn)
+}
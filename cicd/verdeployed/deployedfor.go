@@ -0,0 +1,66 @@
+package main
+
+import (
+	"time"
+)
+
+// unknownAge is shown when the deploy or build time of a stage can't be
+// told, e.g. because the action history of its execution aged out. The
+// last status change would be a guess.
+const unknownAge = "unknown"
+
+// deployedFor returns how many seconds the stage has been running its
+// version at now, nil when its deploy time is unknown.
+func deployedFor(deployedAt *time.Time, now time.Time) *int64 {
+	if deployedAt == nil {
+		return nil
+	}
+	seconds := int64(now.Sub(*deployedAt).Seconds())
+	return &seconds
+}
+
+// deployedForColumn shows how long the stage has been running its version.
+var deployedForColumn = column{
+	Name:  "deployedFor",
+	Title: "Deployed For",
+	Value: func(r report, d stageDetails) string {
+		if d.DeployedAt == nil {
+			return unknownAge
+		}
+		return r.QueriedAt.Sub(*d.DeployedAt).Round(time.Second).String()
+	},
+	Display: func(_ renderOptions, r report, d stageDetails) string {
+		if d.DeployedAt == nil {
+			return unknownAge
+		}
+		return humanDuration(r.QueriedAt.Sub(*d.DeployedAt))
+	},
+}
+
+// builtColumn shows how long ago the artifact version of the stage was
+// uploaded.
+var builtColumn = column{
+	Name:  "built",
+	Title: "Built",
+	Value: func(_ report, d stageDetails) string {
+		if d.BuiltAt == nil {
+			return unknownAge
+		}
+		return formatTime(d.BuiltAt)
+	},
+	Display: func(_ renderOptions, r report, d stageDetails) string {
+		if d.BuiltAt == nil {
+			return unknownAge
+		}
+		return humanDuration(r.QueriedAt.Sub(*d.BuiltAt)) + " ago"
+	},
+}
+
+// withDeployedFor appends the deployedFor and built columns to the default
+// columns of --deployed-for, a --columns selection places them itself.
+func (o renderOptions) withDeployedFor(cols []column) []column {
+	if !o.DeployedFor || o.Columns != nil {
+		return cols
+	}
+	return append(cols[:len(cols):len(cols)], deployedForColumn, builtColumn)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// diagramLabel returns the node label of a stage, e.g. "Prod\n1.4.2 (ab12cd34)",
+// with lines joined by sep.
+func diagramLabel(opts renderOptions, details stageDetails, sep string) string {
+	label := details.Name
+
+	var version []string
+	if details.Version != "" {
+		version = append(version, details.Version)
+	}
+	if details.Commit != "" {
+		version = append(version, "("+opts.displayCommit(details.Commit)+")")
+	}
+	if len(version) > 0 {
+		label += sep + strings.Join(version, " ")
+	}
+
+	return label
+}
+
+// diagramFill returns the fill color of a stage node, empty for the default.
+func diagramFill(details stageDetails) string {
+	switch details.Status {
+	case "Failed":
+		return "#ffebe9"
+	case "InProgress":
+		return "#fff8c5"
+	}
+	return ""
+}
+
+// mermaidEscaper escapes characters with a meaning inside quoted Mermaid
+// labels.
+var mermaidEscaper = strings.NewReplacer(`"`, "#quot;", "<", "#lt;", ">", "#gt;")
+
+// renderMermaid prints the pipeline as a left to right Mermaid flowchart
+// that renders directly in GitHub Markdown.
+func renderMermaid(out io.Writer, opts renderOptions, r report) error {
+	w := bufio.NewWriter(out)
+
+	fmt.Fprintln(w, "flowchart LR")
+	for i, details := range r.Stages {
+		lines := strings.Split(diagramLabel(opts, details, "\n"), "\n")
+		for j := range lines {
+			lines[j] = mermaidEscaper.Replace(lines[j])
+		}
+		fmt.Fprintf(w, "    s%d[\"%s\"]\n", i, strings.Join(lines, "<br/>"))
+	}
+
+	for i := 1; i < len(r.Stages); i++ {
+		arrow := "-->"
+		if r.Stages[i].TransitionDisabled {
+			arrow = "-.->"
+		}
+		fmt.Fprintf(w, "    s%d %s s%d\n", i-1, arrow, i)
+	}
+
+	for i, details := range r.Stages {
+		if fill := diagramFill(details); fill != "" {
+			fmt.Fprintf(w, "    style s%d fill:%s\n", i, fill)
+		}
+	}
+
+	return w.Flush()
+}
+
+// dotEscaper escapes characters with a meaning inside quoted DOT strings.
+var dotEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// dotQuote returns s as a quoted DOT string.
+func dotQuote(s string) string {
+	return `"` + dotEscaper.Replace(s) + `"`
+}
+
+// renderDot prints the pipeline as a left to right Graphviz digraph.
+func renderDot(out io.Writer, opts renderOptions, r report) error {
+	w := bufio.NewWriter(out)
+
+	fmt.Fprintf(w, "digraph %s {\n", dotQuote(r.Pipeline))
+	fmt.Fprintln(w, "    rankdir=LR;")
+	fmt.Fprintln(w, `    node [shape=box, style="rounded,filled", fillcolor="#ffffff"];`)
+
+	for i, details := range r.Stages {
+		attrs := "label=" + dotQuote(diagramLabel(opts, details, "\n"))
+		if fill := diagramFill(details); fill != "" {
+			attrs += ", fillcolor=" + dotQuote(fill)
+		}
+		fmt.Fprintf(w, "    s%d [%s];\n", i, attrs)
+	}
+
+	for i := 1; i < len(r.Stages); i++ {
+		style := ""
+		if r.Stages[i].TransitionDisabled {
+			style = " [style=dashed]"
+		}
+		fmt.Fprintf(w, "    s%d -> s%d%s;\n", i-1, i, style)
+	}
+
+	fmt.Fprintln(w, "}")
+
+	return w.Flush()
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// maxPresign is the longest a presigned URL can be valid, a limit of
+// Signature Version 4.
+const maxPresign = 7 * 24 * time.Hour
+
+// md5ETagRe matches the ETag of an object uploaded in a single part and
+// encrypted, if at all, with S3 managed keys: the MD5 digest of its content.
+var md5ETagRe = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// validDownload reports whether cfg can download or presign an artifact.
+func validDownload(cfg Cfg) error {
+	switch {
+	case cfg.Stage == "":
+		return fmt.Errorf("download requires --stage")
+	case cfg.Output == "" && cfg.Presign == 0:
+		return fmt.Errorf("download requires --out or --presign")
+	case cfg.Output != "" && cfg.Presign != 0:
+		return fmt.Errorf("--out and --presign are mutually exclusive")
+	case cfg.Presign < 0 || cfg.Presign > maxPresign:
+		return fmt.Errorf("--presign must be a positive duration of at most %s", maxPresign)
+	case cfg.Presign != 0 && cfg.SSECustomerKey != "":
+		return fmt.Errorf("a presigned URL can't carry the --sse-customer-key, download the artifact instead")
+	case cfg.Watch || cfg.History > 0 || cfg.Quiet:
+		return fmt.Errorf("download can't be combined with --watch, --history or --quiet")
+	}
+	return nil
+}
+
+// deployedArtifact resolves the S3 artifact version running in cfg.Stage,
+// returned as a config pointing at its bucket and key along with the
+// version id, or the ETag in buckets without versioning.
+func deployedArtifact(sess *session.Session, cfg Cfg) (Cfg, string, error) {
+	stages, _, err := getStageDetails(sess, cfg, nil)
+	if err != nil {
+		return cfg, "", err
+	}
+	// getStageDetails guarantees the requested stage is the only one
+	details := stages[0]
+	switch {
+	case details.Error != "":
+		return cfg, "", fmt.Errorf("stage %s: %s", details.Name, details.Error)
+	case details.Bucket == "":
+		return cfg, "", fmt.Errorf("stage %s isn't versioned by an S3 artifact, there is nothing to download", details.Name)
+	case details.RevisionID == "":
+		return cfg, "", fmt.Errorf("stage %s hasn't deployed an artifact", details.Name)
+	}
+	cfg.Bucket, cfg.Key = details.Bucket, details.Key
+	return cfg, details.RevisionID, nil
+}
+
+// artifactInput returns the GetObject input of the artifact revision ver,
+// an object version or, without versioning, the ETag the current object
+// must still have.
+func artifactInput(cfg Cfg, ver string) *s3.GetObjectInput {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(cfg.Bucket),
+		Key:    aws.String(cfg.Key),
+	}
+	if isETag(ver) {
+		input.IfMatch = aws.String(ver)
+	} else {
+		input.VersionId = aws.String(ver)
+	}
+	withSSECustomerKey(cfg, &input.SSECustomerAlgorithm, &input.SSECustomerKey)
+	return input
+}
+
+// presignArtifact returns a URL anyone can GET the artifact revision ver
+// with for the next expires.
+func presignArtifact(sess *session.Session, cfg Cfg, ver string, expires time.Duration) (string, error) {
+	svc, err := s3Client(sess, cfg)
+	if err != nil {
+		return "", err
+	}
+	req, _ := svc.GetObjectRequest(artifactInput(cfg, ver))
+	url, err := req.Presign(expires)
+	if err != nil {
+		return "", fmt.Errorf("failed to presign the artifact: %w", err)
+	}
+	return url, nil
+}
+
+// downloadArtifact streams the artifact revision ver to path, replacing it
+// only once the download is complete and verified against the ETag. The
+// version id actually downloaded is returned. Progress goes to progress, if
+// not nil.
+func downloadArtifact(sess *session.Session, cfg Cfg, ver, path string, progress io.Writer) (string, error) {
+	if _, err := os.Lstat(path); err == nil && !cfg.Force {
+		return "", fmt.Errorf("%s exists, use --force to overwrite it", path)
+	} else if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+
+	svc, err := s3Client(sess, cfg)
+	if err != nil {
+		return "", err
+	}
+	out, err := svc.GetObject(artifactInput(cfg, ver))
+	if err != nil {
+		if isDeletedVersion(err) {
+			if err := deletedVersionError(svc, cfg, ver); err != nil {
+				return "", err
+			}
+		}
+		if err := encryptionError(svc, cfg, err, ""); err != nil {
+			return "", err
+		}
+		if aerr, ok := err.(awserr.Error); ok {
+			switch aerr.Code() {
+			case "PreconditionFailed":
+				return "", errObjectReplaced
+			default:
+				return "", fmt.Errorf("failed to download the artifact: %s", aerr.Message())
+			}
+		}
+		return "", err
+	}
+	defer out.Body.Close()
+
+	// only the ETag of single part uploads without KMS or customer keys is
+	// the MD5 digest of the content
+	etag := strings.Trim(aws.StringValue(out.ETag), `"`)
+	var digest hash.Hash
+	if md5ETagRe.MatchString(etag) && aws.StringValue(out.ServerSideEncryption) != s3.ServerSideEncryptionAwsKms && out.SSECustomerAlgorithm == nil {
+		digest = md5.New()
+	}
+
+	size := aws.Int64Value(out.ContentLength)
+	err = writeFileAtomic(path, func(w io.Writer) error {
+		if digest != nil {
+			w = io.MultiWriter(w, digest)
+		}
+		if progress != nil {
+			p := &progressWriter{w: progress, total: size}
+			defer p.done()
+			w = io.MultiWriter(w, p)
+		}
+		n, err := io.Copy(w, out.Body)
+		if err != nil {
+			return fmt.Errorf("failed to download the artifact: %w", err)
+		}
+		if n != size {
+			return fmt.Errorf("downloaded %d bytes of the %d of the artifact", n, size)
+		}
+		if digest != nil {
+			if sum := hex.EncodeToString(digest.Sum(nil)); sum != etag {
+				return fmt.Errorf("downloaded artifact has MD5 %s, not its ETag %s", sum, etag)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if digest == nil {
+		fmt.Fprintf(os.Stderr, "warning: the ETag %s of the artifact isn't an MD5 digest, the download wasn't verified against it\n", etag)
+	}
+	return aws.StringValue(out.VersionId), nil
+}
+
+// progressWriter reports how much of total was written, at most a few
+// times a second.
+type progressWriter struct {
+	w       io.Writer
+	total   int64
+	written int64
+	last    time.Time
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	p.written += int64(len(b))
+	if now := time.Now(); now.Sub(p.last) >= 200*time.Millisecond {
+		p.last = now
+		p.print()
+	}
+	return len(b), nil
+}
+
+func (p *progressWriter) print() {
+	percent := 100
+	if p.total > 0 {
+		percent = int(p.written * 100 / p.total)
+	}
+	fmt.Fprintf(p.w, "\rdownloading %.1f of %.1f MiB (%d%%)", float64(p.written)/(1<<20), float64(p.total)/(1<<20), percent)
+}
+
+// done prints the final count and ends the line.
+func (p *progressWriter) done() {
+	p.print()
+	fmt.Fprintln(p.w)
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Supported values of the DriftField config option.
+const (
+	driftFieldVersion = "version"
+	driftFieldCommit  = "commit"
+)
+
+// validDriftField reports whether field can be compared for drift.
+func validDriftField(field string) error {
+	switch field {
+	case driftFieldVersion, driftFieldCommit:
+		return nil
+	}
+	return fmt.Errorf("unsupported --drift-field %q, valid fields are: %s, %s", field, driftFieldVersion, driftFieldCommit)
+}
+
+// drift is the verdict of --fail-on-drift.
+type drift struct {
+	// Field is the compared stage field, version or commit.
+	Field   string `json:"field" yaml:"field"`
+	Drifted bool   `json:"drifted" yaml:"drifted"`
+	// Artifact names the compared artifact of a pipeline with several
+	// sources.
+	Artifact string `json:"artifact,omitempty" yaml:"artifact,omitempty"`
+	// Expected is the value of the first stage in pipeline order, the
+	// newest artifact the pipeline let through.
+	Expected string `json:"expected,omitempty" yaml:"expected,omitempty"`
+	// Behind maps the stages running something else to their value.
+	Behind map[string]string `json:"behind,omitempty" yaml:"behind,omitempty"`
+	// Positions maps the same stages to whether their value is behind,
+	// ahead of or merely different from Expected.
+	Positions map[string]string `json:"positions,omitempty" yaml:"positions,omitempty"`
+	// Artifacts holds the verdict of every artifact of a pipeline with
+	// several sources, Expected and Behind are then left empty.
+	Artifacts []*drift `json:"artifacts,omitempty" yaml:"artifacts,omitempty"`
+
+	// behindOnly leaves the stages not behind Expected out of Drifted.
+	behindOnly bool
+}
+
+// detectDrift compares field across the stages, artifact by artifact for
+// pipelines with several sources. Stages that never ran or carry no value,
+// e.g. for lack of version metadata, don't count. With behindOnly only
+// stages behind the first one drift, those ahead of it or running a value
+// that can't be ordered are only reported.
+func detectDrift(stages []stageDetails, field string, behindOnly bool) *drift {
+	names := stageArtifactNames(stages)
+	if names == nil {
+		return compareDrift(stages, field, "", behindOnly, func(d stageDetails) string {
+			if field == driftFieldCommit {
+				return d.Commit
+			}
+			return d.Version
+		})
+	}
+
+	d := &drift{Field: field, behindOnly: behindOnly}
+	for _, name := range names {
+		ad := compareDrift(stages, field, name, behindOnly, func(d stageDetails) string {
+			if a, ok := d.artifact(name); ok {
+				return a.field(field)
+			}
+			return ""
+		})
+		d.Artifacts = append(d.Artifacts, ad)
+		d.Drifted = d.Drifted || ad.Drifted
+	}
+	return d
+}
+
+// compareDrift compares the value of every stage to the first one.
+func compareDrift(stages []stageDetails, field, artifact string, behindOnly bool, value func(stageDetails) string) *drift {
+	d := &drift{Field: field, Artifact: artifact, behindOnly: behindOnly}
+
+	for _, details := range stages {
+		v := value(details)
+		// a version that couldn't be told says nothing about drift
+		if details.ExecutionID == "" || v == "" || isPlaceholder(v) {
+			continue
+		}
+
+		switch {
+		case d.Expected == "":
+			d.Expected = v
+		case v != d.Expected:
+			if d.Behind == nil {
+				d.Behind = make(map[string]string)
+				d.Positions = make(map[string]string)
+			}
+			position := relativePosition(v, d.Expected)
+			d.Behind[details.Name] = v
+			d.Positions[details.Name] = position
+			d.Drifted = d.Drifted || !behindOnly || position == positionBehind
+		}
+	}
+
+	return d
+}
+
+// String lists the stages behind, e.g.
+//
+//	Prod runs version 1.4.0, behind 1.5.0
+//
+// or, for pipelines with several sources,
+//
+//	Prod runs App version 1.4.0, expected 1.5.0
+func (d *drift) String() string {
+	var lines []string
+	for _, ad := range d.Artifacts {
+		if ad.Drifted {
+			lines = append(lines, ad.String())
+		}
+	}
+
+	names := make([]string, 0, len(d.Behind))
+	for name := range d.Behind {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		lines = append(lines, d.line(name))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// line tells what the stage, one of Behind, runs relative to Expected.
+func (d *drift) line(stage string) string {
+	what := d.Field
+	if d.Artifact != "" {
+		what = d.Artifact + " " + d.Field
+	}
+	relation := "expected"
+	switch d.Positions[stage] {
+	case positionBehind:
+		relation = "behind"
+	case positionAhead:
+		relation = "ahead of"
+	}
+	return fmt.Sprintf("%s runs %s %s, %s %s", stage, what, d.Behind[stage], relation, d.Expected)
+}
+
+// stageDrift returns the lines of String about the stage when it makes
+// the pipeline drift, for every artifact it drifted in.
+func (d *drift) stageDrift(stage string) []string {
+	var lines []string
+	for _, ad := range d.Artifacts {
+		lines = append(lines, ad.stageDrift(stage)...)
+	}
+	if _, ok := d.Behind[stage]; ok && (!d.behindOnly || d.Positions[stage] == positionBehind) {
+		lines = append(lines, d.line(stage))
+	}
+	return lines
+}
+
+// exitIfDrifted reports the stages behind on stderr and exits with
+// exitDrift if any of the reports drifted.
+func exitIfDrifted(reports ...report) {
+	var drifted bool
+	for _, r := range reports {
+		if r.Drift == nil || !r.Drift.Drifted {
+			continue
+		}
+		drifted = true
+		fmt.Fprintf(os.Stderr, "%s drifted:\n", r.Pipeline)
+		for _, line := range strings.Split(r.Drift.String(), "\n") {
+			fmt.Fprintf(os.Stderr, "  %s\n", line)
+		}
+	}
+	if drifted {
+		os.Exit(exitDrift)
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/codepipeline"
+)
+
+// stageTiming is the wall-clock span of the action executions of a stage
+// within a single pipeline execution.
+type stageTiming struct {
+	StartedAt *time.Time `json:"startedAt" yaml:"startedAt"`
+	// EndedAt is null while any action of the stage is in progress.
+	EndedAt *time.Time `json:"endedAt" yaml:"endedAt"`
+}
+
+// listActionExecutions returns every action execution of a pipeline
+// execution, across all of its stages.
+func listActionExecutions(pipelnsvc *codepipeline.CodePipeline, pipeline, execID string) ([]*codepipeline.ActionExecutionDetail, error) {
+	input := &codepipeline.ListActionExecutionsInput{
+		PipelineName: aws.String(pipeline),
+		Filter: &codepipeline.ActionExecutionFilter{
+			PipelineExecutionId: aws.String(execID),
+		},
+	}
+
+	var actions []*codepipeline.ActionExecutionDetail
+	err := pipelnsvc.ListActionExecutionsPages(input, func(page *codepipeline.ListActionExecutionsOutput, _ bool) bool {
+		actions = append(actions, page.ActionExecutionDetails...)
+		return true
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			switch aerr.Code() {
+			case codepipeline.ErrCodePipelineExecutionNotFoundException:
+				// the action history of old executions ages out
+				return nil, nil
+			default:
+				return nil, fmt.Errorf("failed to list action executions: %s", aerr.Message())
+			}
+		}
+		return nil, err
+	}
+
+	return actions, nil
+}
+
+// actionExecutions returns the action executions of the pipeline execution
+// with the given id.
+func (c *executionCache) actionExecutions(execID string) ([]*codepipeline.ActionExecutionDetail, error) {
+	c.mu.Lock()
+	actions, ok := c.actions[execID]
+	c.mu.Unlock()
+	if ok {
+		return actions, nil
+	}
+
+	actions, err := listActionExecutions(c.pipelnsvc, c.pipeline, execID)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.actions[execID] = actions
+	c.mu.Unlock()
+	return actions, nil
+}
+
+// getStageTiming spans the first start to the last update of the actions
+// the stage ran in actions. It returns nil if none of them ran.
+func getStageTiming(stage string, actions []*codepipeline.ActionExecutionDetail) *stageTiming {
+	var t stageTiming
+	var running bool
+	var end time.Time
+
+	for _, action := range actions {
+		if aws.StringValue(action.StageName) != stage || action.StartTime == nil {
+			continue
+		}
+		if t.StartedAt == nil || action.StartTime.Before(*t.StartedAt) {
+			t.StartedAt = action.StartTime
+		}
+		if aws.StringValue(action.Status) == codepipeline.ActionExecutionStatusInProgress {
+			running = true
+		}
+		if updated := aws.TimeValue(action.LastUpdateTime); updated.After(end) {
+			end = updated
+		}
+	}
+
+	if t.StartedAt == nil {
+		return nil
+	}
+	if !running && !end.IsZero() {
+		t.EndedAt = &end
+	}
+	return &t
+}
+
+// durationColumn shows how long the stage took, or has been running for so
+// far, e.g. "14m32s" or "7m and counting".
+var durationColumn = column{
+	Name:  "duration",
+	Title: "Duration",
+	Value: func(r report, d stageDetails) string {
+		if d.Timing == nil {
+			return ""
+		}
+		return d.Timing.duration(r.QueriedAt).String()
+	},
+	Display: func(_ renderOptions, r report, d stageDetails) string {
+		if d.Timing == nil {
+			return "-"
+		}
+		if d.Timing.EndedAt == nil {
+			return humanDuration(d.Timing.duration(r.QueriedAt)) + " and counting"
+		}
+		return d.Timing.duration(r.QueriedAt).String()
+	},
+}
+
+// duration returns the time the stage took, up to now while it is still
+// running, rounded to the second.
+func (t *stageTiming) duration(now time.Time) time.Duration {
+	end := now
+	if t.EndedAt != nil {
+		end = *t.EndedAt
+	}
+	return end.Sub(*t.StartedAt).Round(time.Second)
+}
+
+// withDuration appends the duration column to the default columns of
+// --durations, a --columns selection places it itself.
+func (o renderOptions) withDuration(cols []column) []column {
+	if !o.Durations || o.Columns != nil {
+		return cols
+	}
+	return append(cols[:len(cols):len(cols)], durationColumn)
+}
+
+// wantsColumn reports whether the columns spec selects the named column.
+func wantsColumn(spec, column string) bool {
+	for _, name := range strings.Split(spec, ",") {
+		if strings.EqualFold(strings.TrimSpace(name), column) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ecr"
+)
+
+// providerECR is the provider of ECR image source actions.
+const providerECR = "ECR"
+
+// shortDigestLen is the number of hex characters an image digest is
+// abbreviated to.
+const shortDigestLen = 12
+
+// imageDetails describes the image of an ECR source.
+type imageDetails struct {
+	Repository string `json:"repository" yaml:"repository"`
+	// Tag is the tag the source action watches.
+	Tag    string `json:"tag" yaml:"tag"`
+	Digest string `json:"digest" yaml:"digest"`
+
+	// Tags and PushedAt are only filled in when asked for.
+	Tags     []string   `json:"tags,omitempty" yaml:"tags,omitempty"`
+	PushedAt *time.Time `json:"pushedAt,omitempty" yaml:"pushedAt,omitempty"`
+}
+
+// shortDigest abbreviates an image digest for display, e.g.
+// "sha256:3f1c2a9b4d5e".
+func shortDigest(digest string) string {
+	algo, hex, ok := strings.Cut(digest, ":")
+	if !ok || len(hex) <= shortDigestLen {
+		return digest
+	}
+	return algo + ":" + hex[:shortDigestLen]
+}
+
+// readImage describes the image digest of an ECR source. The version is
+// the watched tag and the short digest, or the tags of the image once
+// cfg asks to look them up.
+func readImage(sess *session.Session, cfg Cfg, source versionSource, digest string) (versionMeta, error) {
+	if digest == "" {
+		return versionMeta{}, nil
+	}
+
+	img := &imageDetails{Repository: source.Repository, Tag: source.Tag, Digest: digest}
+	meta := versionMeta{Version: source.Tag + "@" + shortDigest(digest), Image: img}
+	if !cfg.ResolveImages {
+		return meta, nil
+	}
+
+	detail, err := describeImage(sess, source.Repository, digest)
+	if err != nil {
+		return meta, fmt.Errorf("describe image %s: %w", shortDigest(digest), err)
+	}
+	img.Tags = aws.StringValueSlice(detail.ImageTags)
+	sort.Strings(img.Tags)
+	img.PushedAt = detail.ImagePushedAt
+	if len(img.Tags) > 0 {
+		meta.Version = strings.Join(img.Tags, ", ")
+	}
+	return meta, nil
+}
+
+// imageCache remembers every image looked up by digest.
+var imageCache = struct {
+	sync.Mutex
+	m map[string]*ecr.ImageDetail
+}{m: make(map[string]*ecr.ImageDetail)}
+
+// describeImage returns the image of the named repository with the given
+// digest.
+func describeImage(sess *session.Session, repo, digest string) (*ecr.ImageDetail, error) {
+	cacheKey := repo + "@" + digest
+	imageCache.Lock()
+	detail, ok := imageCache.m[cacheKey]
+	imageCache.Unlock()
+	if ok {
+		return detail, nil
+	}
+
+	out, err := ecr.New(sess).DescribeImages(&ecr.DescribeImagesInput{
+		RepositoryName: aws.String(repo),
+		ImageIds:       []*ecr.ImageIdentifier{{ImageDigest: aws.String(digest)}},
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			switch aerr.Code() {
+			default:
+				return nil, fmt.Errorf("failed to describe image: %s", aerr.Message())
+			}
+		}
+		return nil, err
+	}
+	if len(out.ImageDetails) == 0 {
+		return nil, fmt.Errorf("image not found in repository %s", repo)
+	}
+
+	detail = out.ImageDetails[0]
+	imageCache.Lock()
+	imageCache.m[cacheKey] = detail
+	imageCache.Unlock()
+	return detail, nil
+}
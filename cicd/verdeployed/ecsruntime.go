@@ -0,0 +1,362 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ecs"
+)
+
+// Outcomes of --verify-ecs for a service.
+const (
+	runtimeOK         = "ok"
+	runtimeDrifted    = "drifted"
+	runtimeRollingOut = "rolling-out"
+	runtimeUnverified = "unverified"
+)
+
+// ecsService is an ECS service a stage deploys to.
+type ecsService struct {
+	Cluster string
+	Service string
+}
+
+// serviceRuntime is what an ECS service of a stage actually runs, checked
+// against the version of the stage.
+type serviceRuntime struct {
+	Cluster string `json:"cluster" yaml:"cluster"`
+	Service string `json:"service" yaml:"service"`
+	Status  string `json:"status" yaml:"status"`
+	// Desired is the image tag of the primary deployment of the service,
+	// Running those of the older deployments still running tasks while
+	// it rolls out.
+	Desired string   `json:"desired,omitempty" yaml:"desired,omitempty"`
+	Running []string `json:"running,omitempty" yaml:"running,omitempty"`
+	// Reason tells why the service couldn't be verified.
+	Reason string `json:"reason,omitempty" yaml:"reason,omitempty"`
+}
+
+// String renders the outcome, e.g. "DRIFTED (running :1.4.1)".
+func (s serviceRuntime) String() string {
+	switch s.Status {
+	case runtimeOK:
+		return "OK"
+	case runtimeDrifted:
+		if len(s.Running) > 0 {
+			return fmt.Sprintf("DRIFTED (rolling out :%s, running :%s)", s.Desired, strings.Join(s.Running, ", :"))
+		}
+		return fmt.Sprintf("DRIFTED (running :%s)", s.Desired)
+	case runtimeRollingOut:
+		return fmt.Sprintf("ROLLING OUT (:%s, running :%s)", s.Desired, strings.Join(s.Running, ", :"))
+	}
+	return s.Status
+}
+
+// parseECSServices parses STAGE=CLUSTER/SERVICE mappings, as given by
+// --ecs-service. A stage may be mapped to several services.
+func parseECSServices(specs []string) (map[string][]ecsService, error) {
+	services := make(map[string][]ecsService)
+	for _, spec := range specs {
+		if spec == "" {
+			continue
+		}
+		stage, path, _ := strings.Cut(spec, "=")
+		cluster, service, _ := strings.Cut(path, "/")
+		if stage == "" || cluster == "" || service == "" {
+			return nil, fmt.Errorf("invalid ECS service %q, want STAGE=CLUSTER/SERVICE", spec)
+		}
+		services[stage] = append(services[stage], ecsService{Cluster: cluster, Service: service})
+	}
+	return services, nil
+}
+
+// stageServices returns the ECS services of the stage, those --ecs-service
+// maps it to or else the ones its ECS deploy actions deploy to.
+func stageServices(cfg Cfg, details stageDetails) []ecsService {
+	// validated on startup
+	explicit, _ := parseECSServices(cfg.ECSService)
+	if services, ok := explicit[details.Name]; ok {
+		return services
+	}
+	var services []ecsService
+	for _, t := range details.Targets {
+		if t.Provider != providerECS {
+			continue
+		}
+		if cluster, service, ok := strings.Cut(t.Target, "/"); ok && cluster != "" && service != "" {
+			services = append(services, ecsService{Cluster: cluster, Service: service})
+		}
+	}
+	return services
+}
+
+// verifyServices checks what the ECS services of the stage run against its
+// version. nil if the stage deploys to none.
+func verifyServices(sess *session.Session, cfg Cfg, details stageDetails) []serviceRuntime {
+	services := stageServices(cfg, details)
+	if len(services) == 0 {
+		return nil
+	}
+
+	expected := expectedImages(details)
+	runtimes := make([]serviceRuntime, len(services))
+	for i, s := range services {
+		rt := serviceRuntime{Cluster: s.Cluster, Service: s.Service}
+		if len(expected) == 0 {
+			rt.Status, rt.Reason = runtimeUnverified, "the stage has no version to compare"
+		} else if err := checkService(sess, s, expected, &rt); err != nil {
+			rt.Status, rt.Reason = runtimeUnverified, err.Error()
+		}
+		runtimes[i] = rt
+	}
+	return runtimes
+}
+
+// expectedImages returns the image tags and digests the services of the
+// stage should run: its version, commit and the images it rolled out.
+func expectedImages(details stageDetails) map[string]bool {
+	expected := make(map[string]bool)
+	for _, v := range []string{details.Version, details.Commit} {
+		if v == "" || isPlaceholder(v) {
+			continue
+		}
+		expected[v] = true
+		expected[strings.TrimPrefix(v, "v")] = true
+		expected["v"+strings.TrimPrefix(v, "v")] = true
+	}
+	if details.Commit != "" && !isPlaceholder(details.Commit) && len(details.Commit) > 7 {
+		expected[details.Commit[:7]] = true
+	}
+	for _, c := range details.Containers {
+		if c.Tag != "" {
+			expected[c.Tag] = true
+		}
+		if c.Digest != "" {
+			expected[c.Digest] = true
+		}
+	}
+	return expected
+}
+
+// checkService compares the images of the deployments of the service with
+// the expected ones. The service runs the version if any container of its
+// primary deployment does, sidecars run images of their own.
+func checkService(sess *session.Session, s ecsService, expected map[string]bool, rt *serviceRuntime) error {
+	svc := ecs.New(sess)
+	out, err := svc.DescribeServices(&ecs.DescribeServicesInput{
+		Cluster:  aws.String(s.Cluster),
+		Services: []*string{aws.String(s.Service)},
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			switch aerr.Code() {
+			case ecs.ErrCodeClusterNotFoundException:
+				return fmt.Errorf("cluster %s not found", s.Cluster)
+			default:
+				return fmt.Errorf("failed to describe service %s/%s: %s", s.Cluster, s.Service, aerr.Message())
+			}
+		}
+		return err
+	}
+	if len(out.Services) == 0 {
+		return fmt.Errorf("service %s/%s not found", s.Cluster, s.Service)
+	}
+
+	var rolling bool
+	for _, d := range out.Services[0].Deployments {
+		tags, err := taskDefinitionTags(svc, aws.StringValue(d.TaskDefinition))
+		if err != nil {
+			return err
+		}
+		if aws.StringValue(d.Status) == "PRIMARY" {
+			rt.Desired = tags[0]
+			for _, tag := range tags {
+				if expected[tag] {
+					rt.Desired = tag
+					rt.Status = runtimeOK
+				}
+			}
+			rolling = rolling || aws.StringValue(d.RolloutState) == ecs.DeploymentRolloutStateInProgress
+			continue
+		}
+		if aws.Int64Value(d.RunningCount) > 0 {
+			rt.Running = append(rt.Running, tags[0])
+			rolling = true
+		}
+	}
+
+	switch {
+	case rt.Desired == "":
+		return fmt.Errorf("service %s/%s has no primary deployment", s.Cluster, s.Service)
+	case rt.Status != runtimeOK:
+		rt.Status = runtimeDrifted
+	case rolling && len(rt.Running) > 0:
+		rt.Status = runtimeRollingOut
+	}
+	return nil
+}
+
+// taskDefinitions remembers the image tags of every task definition looked
+// up, task definition revisions are immutable.
+var taskDefinitions = struct {
+	sync.Mutex
+	m map[string][]string
+}{m: make(map[string][]string)}
+
+// taskDefinitionTags returns the image tag, or digest if untagged, of every
+// container of the task definition arn, in definition order.
+func taskDefinitionTags(svc *ecs.ECS, arn string) ([]string, error) {
+	taskDefinitions.Lock()
+	tags, ok := taskDefinitions.m[arn]
+	taskDefinitions.Unlock()
+	if ok {
+		return tags, nil
+	}
+
+	out, err := svc.DescribeTaskDefinition(&ecs.DescribeTaskDefinitionInput{
+		TaskDefinition: aws.String(arn),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			switch aerr.Code() {
+			default:
+				return nil, fmt.Errorf("failed to describe task definition %s: %s", arn, aerr.Message())
+			}
+		}
+		return nil, err
+	}
+	for _, c := range out.TaskDefinition.ContainerDefinitions {
+		tag, digest := parseImageURI(aws.StringValue(c.Image))
+		if tag == "" {
+			tag = digest
+		}
+		tags = append(tags, tag)
+	}
+	if len(tags) == 0 {
+		return nil, fmt.Errorf("task definition %s has no containers", arn)
+	}
+
+	taskDefinitions.Lock()
+	taskDefinitions.m[arn] = tags
+	taskDefinitions.Unlock()
+	return tags, nil
+}
+
+// runtimeSummary renders the outcome for every service of a stage on a
+// single line, naming the services when there are several.
+func runtimeSummary(runtimes []serviceRuntime) string {
+	if len(runtimes) == 1 {
+		return runtimes[0].String()
+	}
+	s := make([]string, len(runtimes))
+	for i, rt := range runtimes {
+		s[i] = rt.Service + " " + rt.String()
+	}
+	return strings.Join(s, "; ")
+}
+
+// runtimeColumn shows whether the ECS services, Lambda functions, Elastic
+// Beanstalk environments and CodeDeploy deployment groups of the stage run
+// its version.
+var runtimeColumn = column{
+	Name:  "runtime",
+	Title: "Runtime",
+	Wide:  true,
+	Value: func(_ report, d stageDetails) string {
+		var s []string
+		for _, rt := range d.Runtime {
+			s = append(s, rt.Status)
+		}
+		for _, rt := range d.Functions {
+			s = append(s, rt.Status)
+		}
+		for _, rt := range d.Environments {
+			s = append(s, rt.Status)
+		}
+		for _, rt := range d.Deployments {
+			s = append(s, rt.Status)
+		}
+		return strings.Join(s, ";")
+	},
+	Display: func(_ renderOptions, _ report, d stageDetails) string {
+		var s []string
+		if len(d.Runtime) > 0 {
+			s = append(s, runtimeSummary(d.Runtime))
+		}
+		if len(d.Functions) > 0 {
+			s = append(s, functionsSummary(d.Functions))
+		}
+		if len(d.Environments) > 0 {
+			s = append(s, environmentsSummary(d.Environments))
+		}
+		if len(d.Deployments) > 0 {
+			s = append(s, deploymentsSummary(d.Deployments))
+		}
+		if len(s) == 0 {
+			return "-"
+		}
+		return strings.Join(s, "; ")
+	},
+}
+
+// withRuntime appends the runtime column to the default columns of
+// --verify-ecs, --lambda-function, --verify-beanstalk and
+// --verify-codedeploy, a --columns selection places it itself.
+func (o renderOptions) withRuntime(cols []column) []column {
+	if !o.VerifyRuntime || o.Columns != nil {
+		return cols
+	}
+	return append(cols[:len(cols):len(cols)], runtimeColumn)
+}
+
+// exitIfRuntimeDrifted reports the ECS services, Lambda functions, Elastic
+// Beanstalk environments and CodeDeploy deployment groups running
+// something else than the version of their stage on stderr and exits with
+// exitDrift if there are any. Those still rolling the version out don't
+// count.
+func exitIfRuntimeDrifted(reports ...report) {
+	var drifted bool
+	for _, r := range reports {
+		for _, details := range r.Stages {
+			for _, msg := range runtimeDrift(details) {
+				drifted = true
+				fmt.Fprintf(os.Stderr, "%s: stage %s: %s\n", r.Pipeline, details.Name, msg)
+			}
+		}
+	}
+	if drifted {
+		os.Exit(exitDrift)
+	}
+}
+
+// runtimeDrift describes the runtimes of the stage running something else
+// than its version, one per line.
+func runtimeDrift(details stageDetails) []string {
+	var msgs []string
+	for _, rt := range details.Runtime {
+		if rt.Status == runtimeDrifted {
+			msgs = append(msgs, fmt.Sprintf("service %s/%s %s, expected %s", rt.Cluster, rt.Service, rt, details.Version))
+		}
+	}
+	for _, rt := range details.Functions {
+		if rt.Status == runtimeDrifted {
+			msgs = append(msgs, fmt.Sprintf("function %s alias %s %s, expected %s", rt.Function, rt.Alias, rt, details.Version))
+		}
+	}
+	for _, rt := range details.Environments {
+		if rt.Status == runtimeDrifted {
+			msgs = append(msgs, fmt.Sprintf("environment %s/%s %s, expected %s", rt.Application, rt.Environment, rt, details.Version))
+		}
+	}
+	for _, rt := range details.Deployments {
+		if rt.Status == runtimeDrifted {
+			msgs = append(msgs, fmt.Sprintf("deployment group %s/%s %s, expected revision %s", rt.Application, rt.Group, rt, details.RevisionID))
+		}
+	}
+	return msgs
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// endpointMaxSize bounds the version responses read, they are a few
+// fields of JSON.
+const endpointMaxSize = 1 << 20
+
+// endpointCheck is what the version endpoint of a stage serves, checked
+// against the version and commit of the stage.
+type endpointCheck struct {
+	URL    string `json:"url" yaml:"url"`
+	Status string `json:"status" yaml:"status"`
+	// Version and Commit are what the endpoint serves, Expected* what the
+	// stage deployed. Fields the response lacks aren't compared.
+	Version         string `json:"version,omitempty" yaml:"version,omitempty"`
+	Commit          string `json:"commit,omitempty" yaml:"commit,omitempty"`
+	ExpectedVersion string `json:"expectedVersion,omitempty" yaml:"expectedVersion,omitempty"`
+	ExpectedCommit  string `json:"expectedCommit,omitempty" yaml:"expectedCommit,omitempty"`
+	// Reason tells why the endpoint couldn't be verified.
+	Reason string `json:"reason,omitempty" yaml:"reason,omitempty"`
+}
+
+// String renders live and expected side by side, e.g. "MISMATCH live
+// 1.4.1, expected 1.4.2".
+func (e endpointCheck) String() string {
+	switch e.Status {
+	case runtimeOK:
+		if e.Version != "" {
+			return "OK " + e.Version
+		}
+		return "OK " + shortCommit(e.Commit)
+	case runtimeDrifted:
+		if e.Version != "" && e.ExpectedVersion != "" && !sameVersion(e.Version, e.ExpectedVersion) {
+			return fmt.Sprintf("MISMATCH live %s, expected %s", e.Version, e.ExpectedVersion)
+		}
+		return fmt.Sprintf("MISMATCH live %s, expected %s", shortCommit(e.Commit), shortCommit(e.ExpectedCommit))
+	}
+	return e.Status
+}
+
+// parseChecks parses STAGE=URL version endpoints, as given by --check. A
+// stage may be mapped to several endpoints.
+func parseChecks(specs []string) (map[string][]string, error) {
+	checks := make(map[string][]string)
+	for _, spec := range specs {
+		if spec == "" {
+			continue
+		}
+		stage, raw, _ := strings.Cut(spec, "=")
+		u, err := url.Parse(raw)
+		if stage == "" || err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid check %q, want STAGE=URL", spec)
+		}
+		checks[stage] = append(checks[stage], raw)
+	}
+	return checks, nil
+}
+
+// newCheckClient returns the client version endpoints are called with,
+// bounded by --check-timeout. --check-insecure skips the verification of
+// their certificates, e.g. self-signed ones of staging.
+func newCheckClient(cfg Cfg) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.CheckInsecure {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	return &http.Client{Timeout: cfg.CheckTimeout, Transport: transport}
+}
+
+// checkEndpoints calls the version endpoints --check maps the stage to and
+// compares what they serve with its version and commit. nil if it maps
+// none. Endpoints that can't be read are left unverified with a warning.
+func checkEndpoints(cfg Cfg, details stageDetails) []endpointCheck {
+	// validated on startup
+	mapped, _ := parseChecks(cfg.Check)
+	urls := mapped[details.Name]
+	if len(urls) == 0 {
+		return nil
+	}
+
+	client := newCheckClient(cfg)
+	checks := make([]endpointCheck, len(urls))
+	for i, u := range urls {
+		c := endpointCheck{URL: u}
+		if !isPlaceholder(details.Version) {
+			c.ExpectedVersion = details.Version
+		}
+		if !isPlaceholder(details.Commit) {
+			c.ExpectedCommit = details.Commit
+		}
+		if c.ExpectedVersion == "" && c.ExpectedCommit == "" {
+			c.Status, c.Reason = runtimeUnverified, "the stage has no version to compare"
+		} else if err := checkEndpoint(client, cfg, &c); err != nil {
+			c.Status, c.Reason = runtimeUnverified, err.Error()
+			warnUnverified("endpoint "+u, err)
+		}
+		checks[i] = c
+	}
+	return checks
+}
+
+// checkEndpoint reads the version and commit the endpoint serves at the
+// configured JSON paths and compares them with the expected ones.
+func checkEndpoint(client *http.Client, cfg Cfg, c *endpointCheck) error {
+	req, err := http.NewRequest(http.MethodGet, c.URL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if cfg.CheckToken != "" {
+		req.Header.Set("Authorization", "Bearer "+cfg.CheckToken)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("endpoint returned %s", resp.Status)
+	}
+
+	var body any
+	if err := json.NewDecoder(io.LimitReader(resp.Body, endpointMaxSize)).Decode(&body); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	c.Version = jsonPath(body, cfg.CheckVersionPath)
+	c.Commit = jsonPath(body, cfg.CheckCommitPath)
+
+	versionCompared := c.Version != "" && c.ExpectedVersion != ""
+	commitCompared := c.Commit != "" && c.ExpectedCommit != ""
+	if !versionCompared && !commitCompared {
+		return fmt.Errorf("response has no %s or %s to compare", cfg.CheckVersionPath, cfg.CheckCommitPath)
+	}
+
+	c.Status = runtimeOK
+	if versionCompared && !sameVersion(c.Version, c.ExpectedVersion) {
+		c.Status = runtimeDrifted
+	}
+	if commitCompared && !sameCommit(c.Commit, c.ExpectedCommit) {
+		c.Status = runtimeDrifted
+	}
+	return nil
+}
+
+// sameVersion reports whether a and b are the same version, with or
+// without a v prefix.
+func sameVersion(a, b string) bool {
+	return strings.TrimPrefix(a, "v") == strings.TrimPrefix(b, "v")
+}
+
+// sameCommit reports whether a and b name the same commit, either may be
+// abbreviated.
+func sameCommit(a, b string) bool {
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	return len(a) >= 7 && strings.HasPrefix(b, a)
+}
+
+// jsonPath returns the value at the dot separated path of the decoded JSON
+// value v, e.g. build.version, empty if there is none. Numbers and booleans
+// are formatted, objects and arrays don't count.
+func jsonPath(v any, path string) string {
+	for _, key := range strings.Split(path, ".") {
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return ""
+		}
+		v = obj[key]
+	}
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64, bool:
+		return fmt.Sprint(v)
+	}
+	return ""
+}
+
+// liveColumn shows what the version endpoints of the stage serve next to
+// what the stage deployed.
+var liveColumn = column{
+	Name:  "live",
+	Title: "Live",
+	Wide:  true,
+	Value: func(_ report, d stageDetails) string {
+		s := make([]string, len(d.Endpoints))
+		for i, c := range d.Endpoints {
+			s[i] = c.Status
+		}
+		return strings.Join(s, ";")
+	},
+	Display: func(_ renderOptions, _ report, d stageDetails) string {
+		if len(d.Endpoints) == 0 {
+			return "-"
+		}
+		if len(d.Endpoints) == 1 {
+			return d.Endpoints[0].String()
+		}
+		s := make([]string, len(d.Endpoints))
+		for i, c := range d.Endpoints {
+			host := c.URL
+			if u, err := url.Parse(c.URL); err == nil {
+				host = u.Host
+			}
+			s[i] = host + " " + c.String()
+		}
+		return strings.Join(s, "; ")
+	},
+}
+
+// withLive appends the live column to the default columns of --check, a
+// --columns selection places it itself.
+func (o renderOptions) withLive(cols []column) []column {
+	if !o.Live || o.Columns != nil {
+		return cols
+	}
+	return append(cols[:len(cols):len(cols)], liveColumn)
+}
+
+// exitIfCheckFailed reports the version endpoints serving something else
+// than their stage on stderr and, with failOn, exits with exitDrift if
+// there are any.
+func exitIfCheckFailed(failOn bool, reports ...report) {
+	if !failOn {
+		return
+	}
+	var failed bool
+	for _, r := range reports {
+		for _, details := range r.Stages {
+			for _, c := range details.Endpoints {
+				if c.Status == runtimeDrifted {
+					failed = true
+					fmt.Fprintf(os.Stderr, "%s: stage %s: %s serves %s\n", r.Pipeline, details.Name, c.URL, c)
+				}
+			}
+		}
+	}
+	if failed {
+		os.Exit(exitDrift)
+	}
+}
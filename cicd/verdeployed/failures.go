@@ -0,0 +1,124 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/codepipeline"
+)
+
+// truncatedMark is appended to error messages cut to --error-length.
+const truncatedMark = "… [truncated]"
+
+// stageError is the failure reported by a failed action of a stage.
+type stageError struct {
+	Action  string `json:"actionName" yaml:"actionName"`
+	Code    string `json:"code" yaml:"code"`
+	Message string `json:"message" yaml:"message"`
+	// Truncated is set when Message was cut to the configured length.
+	Truncated bool `json:"truncated,omitempty" yaml:"truncated,omitempty"`
+}
+
+// String renders the error on a single line, e.g.
+//
+//	Deploy: JobFailed: Stack update failed
+func (e stageError) String() string {
+	s := e.Action + ": "
+	if e.Code != "" {
+		s += e.Code + ": "
+	}
+	return s + e.Message
+}
+
+// getStageErrors collects the error details of the failed actions of a
+// stage. Messages longer than maxLen runes are truncated, CloudFormation
+// in particular reports whole event logs. A maxLen of 0 keeps them whole.
+func getStageErrors(states []*codepipeline.ActionState, maxLen int) []stageError {
+	var errs []stageError
+
+	for _, astate := range states {
+		exec := astate.LatestExecution
+		if exec == nil || exec.ErrorDetails == nil || aws.StringValue(exec.Status) != codepipeline.ActionExecutionStatusFailed {
+			continue
+		}
+
+		e := stageError{
+			Action:  aws.StringValue(astate.ActionName),
+			Code:    aws.StringValue(exec.ErrorDetails.Code),
+			Message: strings.TrimSpace(aws.StringValue(exec.ErrorDetails.Message)),
+		}
+		if maxLen > 0 && utf8.RuneCountInString(e.Message) > maxLen {
+			e.Message = string([]rune(e.Message)[:maxLen]) + truncatedMark
+			e.Truncated = true
+		}
+		errs = append(errs, e)
+	}
+
+	return errs
+}
+
+// terminalWidth returns the width human readable output is wrapped to. It
+// honors COLUMNS, which most shells keep up to date, and falls back to 80.
+func terminalWidth() int {
+	if n, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && n > 0 {
+		return n
+	}
+	return 80
+}
+
+// wrapText breaks s into lines of at most width runes, including indent,
+// at spaces where possible. Words longer than a line are split.
+func wrapText(s, indent string, width int) []string {
+	avail := width - utf8.RuneCountInString(indent)
+	if avail < 20 {
+		avail = 20
+	}
+
+	var lines []string
+	var line []rune
+	flush := func() {
+		lines = append(lines, indent+strings.TrimRight(string(line), " "))
+		line = line[:0]
+	}
+
+	for _, word := range strings.Fields(s) {
+		w := []rune(word)
+		if len(line) > 0 && len(line)+1+len(w) > avail {
+			flush()
+		}
+		for len(w) > avail {
+			if len(line) > 0 {
+				flush()
+			}
+			line = append(line, w[:avail]...)
+			flush()
+			w = w[avail:]
+		}
+		if len(line) > 0 {
+			line = append(line, ' ')
+		}
+		line = append(line, w...)
+	}
+	if len(line) > 0 {
+		flush()
+	}
+
+	return lines
+}
+
+// errorLines renders the errors for display below a table row, continuation
+// lines are indented below the message.
+func errorLines(errs []stageError, width int) []string {
+	const indent = "      "
+
+	var lines []string
+	for _, e := range errs {
+		wrapped := wrapText(e.String(), indent, width)
+		wrapped[0] = "    ✗ " + strings.TrimPrefix(wrapped[0], indent)
+		lines = append(lines, wrapped...)
+	}
+	return lines
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// pipelineFilter matches pipeline names against a glob, or a regular
+// expression when written between slashes, e.g. /^svc-.*-prod$/.
+type pipelineFilter struct {
+	expr  string
+	glob  string
+	regex *regexp.Regexp
+}
+
+// parsePipelineFilter validates expr so a typo is reported before any AWS
+// call is made.
+func parsePipelineFilter(expr string) (pipelineFilter, error) {
+	f := pipelineFilter{expr: expr}
+
+	if len(expr) > 1 && strings.HasPrefix(expr, "/") && strings.HasSuffix(expr, "/") {
+		re, err := regexp.Compile(expr[1 : len(expr)-1])
+		if err != nil {
+			return pipelineFilter{}, fmt.Errorf("invalid pipeline filter %s: %w", expr, err)
+		}
+		f.regex = re
+		return f, nil
+	}
+
+	if _, err := path.Match(expr, ""); err != nil {
+		return pipelineFilter{}, fmt.Errorf("invalid pipeline filter %s: %w", expr, err)
+	}
+	f.glob = expr
+	return f, nil
+}
+
+// match reports whether the pipeline name matches the filter.
+func (f pipelineFilter) match(name string) bool {
+	if f.regex != nil {
+		return f.regex.MatchString(name)
+	}
+	ok, _ := path.Match(f.glob, name)
+	return ok
+}
+
+// filter returns the names matching the filter, in order. When nothing
+// matches the error lists a few of the existing names as a hint.
+func (f pipelineFilter) filter(names []string) ([]string, error) {
+	var matched []string
+	for _, name := range names {
+		if f.match(name) {
+			matched = append(matched, name)
+		}
+	}
+
+	if len(matched) == 0 {
+		const examples = 5
+		if len(names) == 0 {
+			return nil, fmt.Errorf("pipeline filter %s matched nothing, the region has no pipelines", f.expr)
+		}
+		hint := names
+		if len(hint) > examples {
+			hint = hint[:examples]
+		}
+		return nil, fmt.Errorf("pipeline filter %s matched none of the %d pipelines, e.g. %s", f.expr, len(names), strings.Join(hint, ", "))
+	}
+
+	return matched, nil
+}
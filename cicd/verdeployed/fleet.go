@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/codepipeline"
+	"gopkg.in/yaml.v3"
+)
+
+// fleetAccessDenied is the state of pipelines the caller may not read.
+const fleetAccessDenied = "access denied"
+
+// validFleetFormat reports whether format can render the fleet overview.
+func validFleetFormat(format string) error {
+	switch format {
+	case formatTable, formatJSON, formatYAML, formatNDJSON, formatCSV, formatTSV, formatMarkdown:
+		return nil
+	}
+	return fmt.Errorf("fleet is not supported by the %s format", format)
+}
+
+// fleetRow is the one line summary of a pipeline in the fleet overview.
+type fleetRow struct {
+	Pipeline string `json:"pipeline" yaml:"pipeline"`
+	// State is the worst status of the latest execution of any stage,
+	// "access denied" or "error" if the state couldn't be read.
+	State string `json:"state" yaml:"state"`
+	// Running lists the stages in progress.
+	Running []string `json:"running,omitempty" yaml:"running,omitempty"`
+	// LastSuccess is when the last stage last succeeded, null unless the
+	// latest execution of the last stage succeeded.
+	LastSuccess *time.Time `json:"lastSuccess" yaml:"lastSuccess"`
+
+	// Error describes why the state couldn't be read.
+	Error string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// fleetReport is the result of the fleet command.
+type fleetReport struct {
+	Region    string     `json:"region" yaml:"region"`
+	QueriedAt time.Time  `json:"queriedAt" yaml:"queriedAt"`
+	Pipelines []fleetRow `json:"pipelines" yaml:"pipelines"`
+}
+
+// statusSeverity ranks stage statuses, the worst one is the state of the
+// pipeline.
+func statusSeverity(status string) int {
+	switch status {
+	case codepipeline.StageExecutionStatusFailed:
+		return 4
+	case codepipeline.StageExecutionStatusStopped, codepipeline.StageExecutionStatusCancelled:
+		return 3
+	case codepipeline.StageExecutionStatusInProgress, codepipeline.StageExecutionStatusStopping:
+		return 2
+	case codepipeline.StageExecutionStatusSucceeded:
+		return 1
+	}
+	return 0
+}
+
+// getFleetRow summarizes the state of the named pipeline. Only the
+// pipeline state is read, no execution or artifact, to keep it quick.
+func getFleetRow(pipelnsvc *codepipeline.CodePipeline, name string) fleetRow {
+	row := fleetRow{Pipeline: name}
+
+	state, err := pipelnsvc.GetPipelineState(&codepipeline.GetPipelineStateInput{
+		Name: aws.String(name),
+	})
+	if err != nil {
+		row.State = "error"
+		if aerr, ok := err.(awserr.Error); ok {
+			switch aerr.Code() {
+			case "AccessDeniedException":
+				row.State = fleetAccessDenied
+				return row
+			default:
+				row.Error = fmt.Sprintf("failed to get pipeline state: %s", aerr.Message())
+				return row
+			}
+		}
+		row.Error = err.Error()
+		return row
+	}
+
+	for _, stage := range state.StageStates {
+		exec := stage.LatestExecution
+		if exec == nil {
+			continue
+		}
+		status := aws.StringValue(exec.Status)
+		if statusSeverity(status) > statusSeverity(row.State) {
+			row.State = status
+		}
+		if status == codepipeline.StageExecutionStatusInProgress {
+			row.Running = append(row.Running, aws.StringValue(stage.StageName))
+		}
+	}
+
+	if n := len(state.StageStates); n > 0 {
+		last := state.StageStates[n-1]
+		if last.LatestExecution != nil && aws.StringValue(last.LatestExecution.Status) == codepipeline.StageExecutionStatusSucceeded {
+			row.LastSuccess = lastStatusChange(last.ActionStates)
+		}
+	}
+
+	return row
+}
+
+// queryFleet summarizes the named pipelines, running at most concurrency
+// queries at a time. Rows keep the order of names.
+func queryFleet(sess *session.Session, names []string, concurrency int) []fleetRow {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	pipelnsvc := codepipeline.New(sess)
+
+	rows := make([]fleetRow, len(names))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	for i, name := range names {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, name string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			rows[i] = getFleetRow(pipelnsvc, name)
+		}(i, name)
+	}
+	wg.Wait()
+
+	return rows
+}
+
+// fleetCells returns the cells of a fleet row. display selects the human
+// readable rendering of the timestamp.
+func fleetCells(opts renderOptions, f fleetReport, row fleetRow, display bool) []string {
+	state := row.State
+	if state == "" {
+		state = "never run"
+	}
+	last := formatTime(row.LastSuccess)
+	if display {
+		last = opts.Times.format(row.LastSuccess, f.QueriedAt, false)
+	}
+	return []string{row.Pipeline, state, strings.Join(row.Running, ", "), last}
+}
+
+// renderFleet writes the fleet overview in the requested format.
+func renderFleet(w io.Writer, format string, opts renderOptions, f fleetReport) error {
+	if f.Pipelines == nil {
+		f.Pipelines = []fleetRow{}
+	}
+
+	switch format {
+	case formatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(f)
+	case formatYAML:
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(f); err != nil {
+			return err
+		}
+		return enc.Close()
+	case formatNDJSON:
+		enc := json.NewEncoder(w)
+		for _, row := range f.Pipelines {
+			if err := enc.Encode(row); err != nil {
+				return err
+			}
+		}
+		return nil
+	case formatCSV:
+		cw := csv.NewWriter(w)
+		if !opts.NoHeader {
+			cw.Write([]string{"pipeline", "state", "running", "lastSuccess"})
+		}
+		for _, row := range f.Pipelines {
+			cw.Write(fleetCells(opts, f, row, false))
+		}
+		cw.Flush()
+		return cw.Error()
+	case formatMarkdown:
+		fmt.Fprintln(w, "| Pipeline | State | Running | Last Success |")
+		fmt.Fprintln(w, "|---|---|---|---|")
+		for _, row := range f.Pipelines {
+			cells := fleetCells(opts, f, row, true)
+			for i := range cells {
+				cells[i] = mdEscaper.Replace(cells[i])
+			}
+			if _, err := fmt.Fprintf(w, "| %s |\n", strings.Join(cells, " | ")); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	titles := []string{"Pipeline", "State", "Running", "Last Success"}
+	rows := make([][]string, len(f.Pipelines))
+	for i, row := range f.Pipelines {
+		rows[i] = fleetCells(opts, f, row, format == formatTable && !opts.Plain)
+		for j := range rows[i] {
+			rows[i][j] = tsvEscaper.Replace(rows[i][j])
+		}
+	}
+
+	if format == formatTSV || opts.Plain {
+		if !opts.NoHeader {
+			io.WriteString(w, strings.Join(titles, "\t")+"\n")
+		}
+		for _, cells := range rows {
+			if _, err := io.WriteString(w, strings.Join(cells, "\t")+"\n"); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var buf bytes.Buffer
+	tw := new(tabwriter.Writer)
+	// minwidth, tabwidth, padding, padchar, flags
+	tw.Init(&buf, 8, 8, 1, '\t', 0)
+	for _, cells := range append([][]string{titles, {"----", "----", "----", "----"}}, rows...) {
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if !opts.Color {
+		_, err := buf.WriteTo(w)
+		return err
+	}
+
+	return decorateTable(w, &buf, rows, func(row, col int, cell string) string {
+		if col != 1 {
+			return cell
+		}
+		state := f.Pipelines[row].State
+		color := statusColor(state, state != "")
+		if state == fleetAccessDenied || state == "error" {
+			color = ansiRed
+		}
+		if color != "" {
+			cell = color + cell + ansiReset
+		}
+		return cell
+	}, nil)
+}
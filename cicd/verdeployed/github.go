@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// providerCodeStar is the provider of source actions reading GitHub, and
+// other hosts, through a CodeStar connection.
+const providerCodeStar = "CodeStarSourceConnection"
+
+// githubTokenEnv names the environment variable holding the GitHub token
+// commits are looked up with.
+const githubTokenEnv = "GITHUB_TOKEN"
+
+// githubAPI is the base URL of the GitHub REST API.
+const githubAPI = "https://api.github.com"
+
+// readGitHubCommit describes the revision of a CodeStar connection source,
+// the commit itself is the version. The message, author and date are only
+// looked up when cfg asks for them and a GitHub token is set, repo being
+// the owner/name of a GitHub repository.
+func readGitHubCommit(cfg Cfg, repo, revision string) (versionMeta, error) {
+	if revision == "" {
+		return versionMeta{}, nil
+	}
+
+	meta := versionMeta{Version: shortCommit(revision), Commit: revision}
+	describeCommit(nil, cfg, &meta, providerCodeStar, repo)
+	return meta, nil
+}
+
+// githubCommit is the part of a GitHub commit verdeployed reads.
+type githubCommit struct {
+	Message string `json:"message"`
+	Author  struct {
+		Name string     `json:"name"`
+		Date *time.Time `json:"date"`
+	} `json:"author"`
+}
+
+// githubCache remembers every commit looked up, commits never change.
+var githubCache = struct {
+	sync.Mutex
+	m map[string]githubCommit
+}{m: make(map[string]githubCommit)}
+
+// githubClient bounds the GitHub requests, a stuck one mustn't hang the
+// report.
+var githubClient = &http.Client{Timeout: 10 * time.Second}
+
+// getGitHubCommit returns the commit of the GitHub repository repo.
+func getGitHubCommit(token, repo, sha string) (githubCommit, error) {
+	cacheKey := repo + "@" + sha
+	githubCache.Lock()
+	commit, ok := githubCache.m[cacheKey]
+	githubCache.Unlock()
+	if ok {
+		return commit, nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet, githubAPI+"/repos/"+repo+"/commits/"+url.PathEscape(sha), nil)
+	if err != nil {
+		return githubCommit{}, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := githubClient.Do(req)
+	if err != nil {
+		return githubCommit{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return githubCommit{}, fmt.Errorf("failed to get commit: GitHub returned %s", resp.Status)
+	}
+
+	var body struct {
+		Commit githubCommit `json:"commit"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return githubCommit{}, fmt.Errorf("failed to decode commit: %w", err)
+	}
+
+	githubCache.Lock()
+	githubCache.m[cacheKey] = body.Commit
+	githubCache.Unlock()
+	return body.Commit, nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// Supported values of the GroupBy config option.
+const groupByVersion = "version"
+
+// unknownVersion groups stages without version metadata, or whose version
+// couldn't be told.
+const unknownVersion = "unknown"
+
+// versionGroup lists the stages running the same artifact version.
+type versionGroup struct {
+	Version string   `json:"version" yaml:"version"`
+	Stages  []string `json:"stages" yaml:"stages"`
+	// Commit is the commit of the stage that most recently changed state.
+	Commit string `json:"commit" yaml:"commit"`
+}
+
+// groupStagesByVersion inverts the stage list into one group per distinct
+// version, in order of first appearance in the pipeline.
+func groupStagesByVersion(stages []stageDetails) []versionGroup {
+	var groups []versionGroup
+	index := make(map[string]int)
+	newest := make(map[string]stageDetails)
+
+	for _, details := range stages {
+		v := details.Version
+		if v == "" || isPlaceholder(v) {
+			v = unknownVersion
+		}
+
+		i, ok := index[v]
+		if !ok {
+			i = len(groups)
+			index[v] = i
+			groups = append(groups, versionGroup{Version: v})
+		}
+		groups[i].Stages = append(groups[i].Stages, details.Name)
+
+		if n, ok := newest[v]; !ok || newerThan(details, n) {
+			newest[v] = details
+			groups[i].Commit = details.Commit
+		}
+	}
+
+	return groups
+}
+
+// newerThan reports whether stage a changed state after stage b. Stages
+// that never ran are the oldest.
+func newerThan(a, b stageDetails) bool {
+	switch {
+	case a.LastStatusChange == nil:
+		return false
+	case b.LastStatusChange == nil:
+		return true
+	}
+	return a.LastStatusChange.After(*b.LastStatusChange)
+}
+
+// validGroupBy reports whether format can render grouped output.
+func validGroupBy(groupBy, format string) error {
+	if groupBy == "" {
+		return nil
+	}
+	if groupBy != groupByVersion {
+		return fmt.Errorf("unsupported group-by %q", groupBy)
+	}
+
+	switch format {
+	case formatTable, formatJSON, formatYAML:
+		return nil
+	}
+	return fmt.Errorf("group-by is not supported by the %s format", format)
+}
+
+// renderGroupTable prints version groups as an aligned table.
+func renderGroupTable(out io.Writer, opts renderOptions, groups []versionGroup) error {
+	// initialize tabwriter
+	w := new(tabwriter.Writer)
+	// minwidth, tabwidth, padding, padchar, flags
+	w.Init(out, 8, 8, 1, '\t', 0)
+
+	fmt.Fprintf(w, "%s\t\t%s\t\t%s\n", "Version", "Stages", "Commit")
+	fmt.Fprintf(w, "%s\t\t%s\t\t%s\n", "----", "----", "----")
+
+	for _, g := range groups {
+		fmt.Fprintf(w, "%s\t\t%s\t\t%s\n", g.Version, strings.Join(g.Stages, ", "), opts.displayCommit(g.Commit))
+	}
+
+	return w.Flush()
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGroupStagesByVersionPlaceholders(t *testing.T) {
+	stages := []stageDetails{
+		{Name: "Beta", Version: "1.5.0"},
+		{Name: "Staging", Version: noVersionMetadata},
+		{Name: "Prod", Version: "1.5.0"},
+		{Name: "Canary", Version: versionDeletedVersion},
+		{Name: "New"},
+	}
+
+	var got [][]string
+	for _, g := range groupStagesByVersion(stages) {
+		got = append(got, append([]string{g.Version}, g.Stages...))
+	}
+	want := [][]string{
+		{"1.5.0", "Beta", "Prod"},
+		{unknownVersion, "Staging", "Canary", "New"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("groups = %v, want %v", got, want)
+	}
+}
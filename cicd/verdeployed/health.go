@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Supported values of the FailOn config option.
+const (
+	failOnFailed = "failed"
+	failOnStuck  = "stuck"
+)
+
+// validFailOn reports whether failOn names supported health checks, a
+// comma separated list of them.
+func validFailOn(failOn string) error {
+	for _, check := range parseNames(failOn) {
+		switch check {
+		case failOnFailed, failOnStuck:
+		default:
+			return fmt.Errorf("unsupported --fail-on %q, valid values are: %s, %s", check, failOnFailed, failOnStuck)
+		}
+	}
+	return nil
+}
+
+// unhealthyStages returns the stages of the reports failing the failOn
+// checks, e.g. "Prod (Failed)". Names are prefixed with their pipeline when
+// more than one pipeline is reported.
+func unhealthyStages(failOn string, reports ...report) []string {
+	checks := make(map[string]bool)
+	for _, check := range parseNames(failOn) {
+		checks[check] = true
+	}
+	if len(checks) == 0 {
+		return nil
+	}
+
+	var stages []string
+	for _, r := range reports {
+		for _, details := range r.Stages {
+			var why string
+			switch {
+			case checks[failOnFailed] && (details.Status == "Failed" || details.Status == "Stopped"):
+				why = details.Status
+			case checks[failOnStuck] && details.Stuck:
+				why = "stuck " + humanDuration(r.QueriedAt.Sub(*details.LastStatusChange))
+			default:
+				continue
+			}
+			name := details.Name
+			if len(reports) > 1 {
+				name = r.Pipeline + "/" + name
+			}
+			stages = append(stages, fmt.Sprintf("%s (%s)", name, why))
+		}
+	}
+	return stages
+}
+
+// exitIfUnhealthy reports the unhealthy stages on stderr and exits with
+// exitUnhealthy if there are any.
+func exitIfUnhealthy(failOn string, reports ...report) {
+	stages := unhealthyStages(failOn, reports...)
+	if len(stages) == 0 {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "unhealthy: %s\n", strings.Join(stages, ", "))
+	os.Exit(exitUnhealthy)
+}
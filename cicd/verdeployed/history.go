@@ -0,0 +1,290 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/codepipeline"
+	"gopkg.in/yaml.v3"
+)
+
+// historyEntry is a single past execution of a pipeline.
+type historyEntry struct {
+	ExecutionID string     `json:"executionId" yaml:"executionId"`
+	Status      string     `json:"status" yaml:"status"`
+	StartTime   *time.Time `json:"startTime" yaml:"startTime"`
+	// EndTime is the last update of a finished execution, null while it
+	// is still running.
+	EndTime    *time.Time `json:"endTime" yaml:"endTime"`
+	RevisionID string     `json:"revisionId" yaml:"revisionId"`
+	Version    string     `json:"version" yaml:"version"`
+	Commit     string     `json:"commit" yaml:"commit"`
+	ReleaseURL string     `json:"releaseUrl" yaml:"releaseUrl"`
+
+	// Error describes why the version couldn't be resolved.
+	Error string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// historyReport is the result of a history run.
+type historyReport struct {
+	Pipeline   string         `json:"pipeline" yaml:"pipeline"`
+	Region     string         `json:"region" yaml:"region"`
+	QueriedAt  time.Time      `json:"queriedAt" yaml:"queriedAt"`
+	Executions []historyEntry `json:"executions" yaml:"executions"`
+}
+
+// validHistoryFormat reports whether format can render execution history.
+func validHistoryFormat(format string) error {
+	switch format {
+	case formatTable, formatJSON, formatYAML, formatCSV, formatTSV:
+		return nil
+	}
+	return fmt.Errorf("history is not supported by the %s format", format)
+}
+
+// historyFilter narrows the executions listed by --history.
+type historyFilter struct {
+	// Since and Until bound the start time of the executions, nil leaves
+	// the range open.
+	Since *time.Time
+	Until *time.Time
+	// Statuses keeps executions with any of the statuses, all if empty.
+	Statuses []string
+}
+
+// parseHistoryFilter resolves --since, --until and --status, relative to
+// now for durations.
+func parseHistoryFilter(cfg Cfg, now time.Time) (historyFilter, error) {
+	var f historyFilter
+	var err error
+	if f.Since, err = parseTimeBound("--since", cfg.Since, now); err != nil {
+		return f, err
+	}
+	if f.Until, err = parseTimeBound("--until", cfg.Until, now); err != nil {
+		return f, err
+	}
+	if f.Since != nil && f.Until != nil && f.Until.Before(*f.Since) {
+		return f, fmt.Errorf("--until %s is before --since %s", cfg.Until, cfg.Since)
+	}
+	f.Statuses = parseNames(cfg.Status)
+	return f, nil
+}
+
+// parseTimeBound parses a point in time given as an RFC3339 timestamp, a
+// date or a duration back from now, e.g. 36h or 7d.
+func parseTimeBound(flag, s string, now time.Time) (*time.Time, error) {
+	if s == "" {
+		return nil, nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return &t, nil
+		}
+	}
+
+	var d time.Duration
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q, expected a duration like 7d or 12h, a date or an RFC3339 timestamp", flag, s)
+		}
+		d = time.Duration(n) * 24 * time.Hour
+	} else {
+		var err error
+		if d, err = time.ParseDuration(s); err != nil {
+			return nil, fmt.Errorf("invalid %s %q, expected a duration like 7d or 12h, a date or an RFC3339 timestamp", flag, s)
+		}
+	}
+	t := now.Add(-d)
+	return &t, nil
+}
+
+// keep reports whether the execution passes the filter.
+func (f historyFilter) keep(exec *codepipeline.PipelineExecutionSummary) bool {
+	start := aws.TimeValue(exec.StartTime)
+	if f.Until != nil && start.After(*f.Until) {
+		return false
+	}
+	if f.Since != nil && start.Before(*f.Since) {
+		return false
+	}
+	if len(f.Statuses) == 0 {
+		return true
+	}
+	for _, status := range f.Statuses {
+		if strings.EqualFold(status, aws.StringValue(exec.Status)) {
+			return true
+		}
+	}
+	return false
+}
+
+// getHistory lists the last n executions of the configured pipeline passing
+// filter, newest first, with the version each one deployed.
+func getHistory(sess *session.Session, cfg Cfg, n int, filter historyFilter) ([]historyEntry, error) {
+	pipelnsvc := codepipeline.New(sess)
+
+	pipeline, err := getPipeline(pipelnsvc, cfg.PipelineName)
+	if err != nil {
+		return nil, err
+	}
+	if err := discoverArtifact(pipeline, &cfg); err != nil {
+		return nil, err
+	}
+	// executions are listed by what their source stage read
+	sourceStage, err := sourceStageName(pipeline, cfg.SourceStage)
+	if err != nil {
+		return nil, err
+	}
+	expandStage(&cfg, sourceStage)
+	source := findVersionSource(pipeline, cfg.Bucket, cfg.Key)
+
+	var summaries []*codepipeline.PipelineExecutionSummary
+	input := &codepipeline.ListPipelineExecutionsInput{
+		PipelineName: aws.String(cfg.PipelineName),
+	}
+	err = pipelnsvc.ListPipelineExecutionsPages(input, func(page *codepipeline.ListPipelineExecutionsOutput, _ bool) bool {
+		for _, exec := range page.PipelineExecutionSummaries {
+			// newest first, the rest is older still
+			if filter.Since != nil && aws.TimeValue(exec.StartTime).Before(*filter.Since) {
+				return false
+			}
+			if filter.keep(exec) {
+				summaries = append(summaries, exec)
+			}
+		}
+		return len(summaries) < n
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			switch aerr.Code() {
+			default:
+				return nil, fmt.Errorf("failed to list pipeline executions: %s", aerr.Message())
+			}
+		}
+		return nil, err
+	}
+	if len(summaries) > n {
+		summaries = summaries[:n]
+	}
+
+	entries := make([]historyEntry, 0, len(summaries))
+
+	for _, exec := range summaries {
+		entry := historyEntry{
+			ExecutionID: aws.StringValue(exec.PipelineExecutionId),
+			Status:      aws.StringValue(exec.Status),
+			StartTime:   exec.StartTime,
+		}
+		switch entry.Status {
+		case codepipeline.PipelineExecutionStatusInProgress, codepipeline.PipelineExecutionStatusStopping:
+		default:
+			entry.EndTime = exec.LastUpdateTime
+		}
+
+		for _, revision := range exec.SourceRevisions {
+			if source.found() {
+				if aws.StringValue(revision.ActionName) == source.Action {
+					entry.RevisionID = aws.StringValue(revision.RevisionId)
+				}
+				continue
+			}
+			if revRe.MatchString(aws.StringValue(revision.RevisionSummary)) || isETag(aws.StringValue(revision.RevisionId)) {
+				entry.RevisionID = aws.StringValue(revision.RevisionId)
+			}
+		}
+
+		if entry.RevisionID != "" {
+			meta, err := readVersion(sess, cfg, source, entry.RevisionID)
+			if err != nil {
+				entry.Error = err.Error()
+			}
+			entry.Version, entry.Commit, entry.ReleaseURL = meta.Version, meta.Commit, meta.ReleaseURL
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// renderHistory writes the execution history in the requested format.
+func renderHistory(w io.Writer, format string, opts renderOptions, h historyReport) error {
+	if opts.Template != nil {
+		return opts.Template.Execute(w, h)
+	}
+
+	if h.Executions == nil {
+		h.Executions = []historyEntry{}
+	}
+
+	switch format {
+	case formatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(h)
+	case formatYAML:
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(h); err != nil {
+			return err
+		}
+		return enc.Close()
+	case formatCSV:
+		cw := csv.NewWriter(w)
+		if !opts.NoHeader {
+			cw.Write([]string{"pipeline", "executionId", "status", "startTime", "endTime", "version", "commit"})
+		}
+		for _, e := range h.Executions {
+			cw.Write([]string{h.Pipeline, e.ExecutionID, e.Status, formatTime(e.StartTime), formatTime(e.EndTime), e.Version, e.Commit})
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+
+	titles := []string{"ExecutionID", "Status", "Started", "Finished", "Version", "Commit"}
+
+	if format == formatTSV || opts.Plain {
+		if !opts.NoHeader {
+			io.WriteString(w, strings.Join(titles, "\t")+"\n")
+		}
+		for _, e := range h.Executions {
+			fields := []string{e.ExecutionID, e.Status, formatTime(e.StartTime), formatTime(e.EndTime), e.Version, e.Commit}
+			for i, f := range fields {
+				fields[i] = tsvEscaper.Replace(f)
+			}
+			if _, err := io.WriteString(w, strings.Join(fields, "\t")+"\n"); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	tw := new(tabwriter.Writer)
+	// minwidth, tabwidth, padding, padchar, flags
+	tw.Init(w, 8, 8, 1, '\t', 0)
+
+	fmt.Fprintln(tw, strings.Join(titles, "\t"))
+	fmt.Fprintln(tw, "----\t----\t----\t----\t----\t----")
+	for _, e := range h.Executions {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			e.ExecutionID,
+			e.Status,
+			opts.Times.format(e.StartTime, h.QueriedAt, false),
+			opts.Times.format(e.EndTime, h.QueriedAt, false),
+			tsvEscaper.Replace(e.Version),
+			opts.displayCommit(e.Commit),
+		)
+	}
+
+	return tw.Flush()
+}
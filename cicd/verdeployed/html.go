@@ -0,0 +1,95 @@
+package main
+
+import (
+	"html/template"
+	"io"
+)
+
+// htmlTmpl renders a self contained status page; all styling is inline so
+// the file can be served as is from any static web server.
+var htmlTmpl = template.Must(template.New("report").Funcs(template.FuncMap{
+	"statusClass": func(status string) string {
+		switch status {
+		case "Succeeded":
+			return "ok"
+		case "Failed":
+			return "failed"
+		case "InProgress":
+			return "progress"
+		}
+		return ""
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Report.Pipeline}} - deployment status</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #24292f; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #d0d7de; padding: 6px 12px; text-align: left; }
+th { background: #f6f8fa; }
+td.ok { background: #dafbe1; }
+td.failed { background: #ffebe9; }
+td.progress { background: #fff8c5; }
+footer { margin-top: 1em; color: #57606a; font-size: 0.9em; }
+code { font-family: SFMono-Regular, Consolas, monospace; }
+</style>
+</head>
+<body>
+<header>
+<h1><a href="{{.ConsoleURL}}">{{.Report.Pipeline}}</a></h1>
+<p>Region: {{.Report.Region}}</p>
+</header>
+<table>
+<thead>
+<tr><th>Stage</th><th>Status</th><th>Version</th><th>Commit</th><th>Execution ID</th></tr>
+</thead>
+<tbody>
+{{- range .Stages}}
+<tr>
+<td>{{.Name}}</td>
+<td class="{{statusClass .Status}}">{{.DisplayStatus}}</td>
+<td>{{if .Version}}{{if .ReleaseURL}}<a href="{{.ReleaseURL}}">{{.Version}}</a>{{else}}{{.Version}}{{end}}{{else}}&ndash;{{end}}</td>
+<td>{{if .CommitURL}}<a href="{{.CommitURL}}"><code>{{.DisplayCommit}}</code></a>{{else if .Commit}}<code>{{.DisplayCommit}}</code>{{else}}&ndash;{{end}}</td>
+<td><code>{{.ExecutionID}}</code></td>
+</tr>
+{{- end}}
+</tbody>
+</table>
+<footer>Generated {{.GeneratedAt}} by verdeployed</footer>
+</body>
+</html>
+`))
+
+// renderHTML prints the report as a single HTML document.
+func renderHTML(w io.Writer, opts renderOptions, r report) error {
+	type htmlStage struct {
+		stageDetails
+		CommitURL     string
+		DisplayCommit string
+		DisplayStatus string
+	}
+
+	stages := make([]htmlStage, 0, len(r.Stages))
+	for _, details := range r.Stages {
+		stages = append(stages, htmlStage{
+			stageDetails:  details,
+			CommitURL:     commitURL(opts.CommitURLTemplate, details.Commit),
+			DisplayCommit: opts.displayCommit(details.Commit),
+			DisplayStatus: details.displayStatus(),
+		})
+	}
+
+	return htmlTmpl.Execute(w, struct {
+		Report      report
+		ConsoleURL  string
+		GeneratedAt string
+		Stages      []htmlStage
+	}{
+		Report:      r,
+		ConsoleURL:  pipelineConsoleURL(r.Region, r.Pipeline),
+		GeneratedAt: opts.Times.format(&r.QueriedAt, r.QueriedAt, false),
+		Stages:      stages,
+	})
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/codepipeline"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// providerECS is the provider of ECS standard deploy actions.
+const providerECS = "ECS"
+
+// defaultImageDefinitions is the file ECS deploy actions read the images
+// from unless configured otherwise.
+const defaultImageDefinitions = "imagedefinitions.json"
+
+// containerImage is a container of an ECS service and the image a deploy
+// action rolled out to it.
+type containerImage struct {
+	Name   string `json:"name" yaml:"name"`
+	Image  string `json:"image" yaml:"image"`
+	Tag    string `json:"tag,omitempty" yaml:"tag,omitempty"`
+	Digest string `json:"digest,omitempty" yaml:"digest,omitempty"`
+}
+
+// parseImageURI splits an image reference into its tag and digest, e.g.
+// 123456789012.dkr.ecr.eu-west-1.amazonaws.com/app:1.4.2@sha256:….
+func parseImageURI(uri string) (tag, digest string) {
+	ref, digest, _ := strings.Cut(uri, "@")
+	// registries may have a port, the tag follows the last path element
+	name := ref[strings.LastIndex(ref, "/")+1:]
+	if _, t, ok := strings.Cut(name, ":"); ok {
+		tag = t
+	}
+	return tag, digest
+}
+
+// display names the image of the container for people, its tag or short
+// digest.
+func (c containerImage) display() string {
+	switch {
+	case c.Tag != "" && c.Digest != "":
+		return c.Tag + "@" + shortDigest(c.Digest)
+	case c.Digest != "":
+		return shortDigest(c.Digest)
+	case c.Tag != "":
+		return c.Tag
+	}
+	return c.Image
+}
+
+// containersVersion is the version of a stage deploying containers, the
+// image of the only one or the name and image of every one.
+func containersVersion(containers []containerImage) string {
+	if len(containers) == 1 {
+		return containers[0].display()
+	}
+	parts := make([]string, len(containers))
+	for i, c := range containers {
+		parts[i] = c.Name + " " + c.display()
+	}
+	return strings.Join(parts, ", ")
+}
+
+// getContainerImages reads the images the ECS deploy actions of the named
+// stage rolled out in the execution execID from the image definitions file
+// of their input artifact. nil if the stage deploys no ECS service.
+func getContainerImages(execs *executionCache, sess *session.Session, cfg Cfg, stage, execID string) ([]containerImage, error) {
+	actions, err := execs.actionExecutions(execID)
+	if err != nil {
+		return nil, err
+	}
+
+	var containers []containerImage
+	seen := make(map[string]bool)
+	for _, action := range actions {
+		in := action.Input
+		if aws.StringValue(action.StageName) != stage || in == nil || in.ActionTypeId == nil || aws.StringValue(in.ActionTypeId.Provider) != providerECS {
+			continue
+		}
+		if len(in.InputArtifacts) == 0 || in.InputArtifacts[0].S3location == nil {
+			continue
+		}
+		file := aws.StringValue(in.Configuration["FileName"])
+		if file == "" {
+			file = defaultImageDefinitions
+		}
+
+		loc := in.InputArtifacts[0].S3location
+		defs, err := readImageDefinitions(sess, cfg, aws.StringValue(loc.Bucket), aws.StringValue(loc.Key), file)
+		if err != nil {
+			return nil, fmt.Errorf("%s of %s: %w", file, aws.StringValue(action.ActionName), err)
+		}
+		for _, c := range defs {
+			if !seen[c.Name] {
+				seen[c.Name] = true
+				containers = append(containers, c)
+			}
+		}
+	}
+	return containers, nil
+}
+
+// readImageDefinitions reads the image definitions file from the artifact
+// at bucket and key, a zip as CodePipeline stores them or the JSON file
+// itself.
+func readImageDefinitions(sess *session.Session, cfg Cfg, bucket, key, file string) ([]containerImage, error) {
+	// the artifact store belongs to the pipeline, not to the artifact role
+	region, err := bucketRegion(sess, bucket)
+	if err != nil {
+		return nil, err
+	}
+	svc := s3.New(sess, aws.NewConfig().WithRegion(region))
+
+	out, err := svc.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			switch aerr.Code() {
+			default:
+				return nil, fmt.Errorf("failed to download artifact: %s", aerr.Message())
+			}
+		}
+		return nil, err
+	}
+	defer out.Body.Close()
+
+	limit := int64(cfg.ArchiveMaxSize) << 20
+	data, err := io.ReadAll(io.LimitReader(out.Body, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to download artifact: %w", err)
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("artifact is larger than the %d MiB --archive-max-size", cfg.ArchiveMaxSize)
+	}
+
+	if bytes.HasPrefix(data, []byte("PK")) {
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to open artifact: %w", err)
+		}
+		f, err := zr.Open(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open it in the artifact: %w", err)
+		}
+		defer f.Close()
+		if data, err = io.ReadAll(f); err != nil {
+			return nil, fmt.Errorf("failed to read it: %w", err)
+		}
+	}
+
+	var defs []struct {
+		Name     string `json:"name"`
+		ImageURI string `json:"imageUri"`
+	}
+	if err := json.Unmarshal(data, &defs); err != nil {
+		return nil, fmt.Errorf("invalid image definitions: %w", err)
+	}
+
+	containers := make([]containerImage, 0, len(defs))
+	for _, d := range defs {
+		if d.Name == "" || d.ImageURI == "" {
+			return nil, fmt.Errorf("invalid image definitions: every entry needs a name and an imageUri")
+		}
+		tag, digest := parseImageURI(d.ImageURI)
+		containers = append(containers, containerImage{Name: d.Name, Image: d.ImageURI, Tag: tag, Digest: digest})
+	}
+	return containers, nil
+}
+
+// hasECSDeploy reports whether the named stage of the pipeline deploys to
+// ECS.
+func hasECSDeploy(pipeline *codepipeline.PipelineDeclaration, stage string) bool {
+	for _, s := range pipeline.Stages {
+		if aws.StringValue(s.Name) != stage {
+			continue
+		}
+		for _, action := range s.Actions {
+			if id := action.ActionTypeId; id != nil && aws.StringValue(id.Category) == codepipeline.ActionCategoryDeploy && aws.StringValue(id.Provider) == providerECS {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/codepipeline"
+)
+
+// inboundExecution is an execution waiting to enter a stage while another
+// one is active, e.g. in queued or parallel execution mode.
+type inboundExecution struct {
+	ExecutionID string `json:"executionId" yaml:"executionId"`
+	Status      string `json:"status" yaml:"status"`
+	RevisionID  string `json:"revisionId" yaml:"revisionId"`
+	Version     string `json:"version" yaml:"version"`
+
+	// Error describes why the version couldn't be resolved.
+	Error string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// getInbound resolves the inbound executions of a stage to their versions.
+// Pipelines in the default superseded mode report at most one of them, in
+// the singular field. A failed lookup is recorded in the execution only,
+// the stage itself is still fine.
+func getInbound(execs *executionCache, source versionSource, sess *session.Session, cfg Cfg, stage *codepipeline.StageState) []inboundExecution {
+	queued := stage.InboundExecutions
+	if len(queued) == 0 && stage.InboundExecution != nil {
+		queued = []*codepipeline.StageExecution{stage.InboundExecution}
+	}
+
+	var inbound []inboundExecution
+	for _, exec := range queued {
+		in := inboundExecution{
+			ExecutionID: aws.StringValue(exec.PipelineExecutionId),
+			Status:      aws.StringValue(exec.Status),
+		}
+
+		execution, err := execs.get(in.ExecutionID)
+		if err != nil {
+			in.Error = err.Error()
+			inbound = append(inbound, in)
+			continue
+		}
+		in.RevisionID = execs.revision(execution, source)
+
+		meta, err := readVersion(sess, cfg, source, in.RevisionID)
+		if err != nil {
+			in.Error = err.Error()
+		}
+		in.Version = meta.Version
+
+		inbound = append(inbound, in)
+	}
+
+	return inbound
+}
+
+// inboundSummary renders the inbound executions of a stage on a single line,
+// e.g. "1 queued: exec 3f1c2a9b, version 1.5.1".
+func inboundSummary(inbound []inboundExecution) string {
+	if len(inbound) == 0 {
+		return ""
+	}
+
+	execs := make([]string, len(inbound))
+	for i, in := range inbound {
+		id := in.ExecutionID
+		if len(id) > shortCommitLen {
+			id = id[:shortCommitLen]
+		}
+		execs[i] = "exec " + id
+		if in.Version != "" {
+			execs[i] += ", version " + in.Version
+		}
+	}
+
+	return fmt.Sprintf("%d queued: %s", len(inbound), strings.Join(execs, "; "))
+}
+
+// hasInbound reports whether any of the stages has inbound executions.
+func hasInbound(stages []stageDetails) bool {
+	for _, details := range stages {
+		if len(details.Inbound) > 0 {
+			return true
+		}
+	}
+	return false
+}
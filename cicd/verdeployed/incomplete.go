@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// Placeholders shown for the version and commit of artifacts lacking that
+// metadata, the rest of the stage is still reported.
+const (
+	noVersionMetadata = "(no version metadata)"
+	noCommitMetadata  = "(no commit metadata)"
+)
+
+// isPlaceholder reports whether v stands in for a version that couldn't be
+// told, rather than being one.
+func isPlaceholder(v string) bool {
+	switch v {
+	case versionUnknown, objectReplacedVersion, versionDeletedVersion, objectDeletedVersion, noVersionMetadata, noCommitMetadata:
+		return true
+	}
+	return false
+}
+
+// exitIfIncomplete warns on stderr about the stages whose artifact lacks
+// version or commit metadata, or was deleted, and exits with
+// exitIncomplete if there are any.
+func exitIfIncomplete(reports ...report) {
+	var incomplete int
+	for _, r := range reports {
+		var n int
+		for _, details := range r.Stages {
+			if details.IncompleteMetadata {
+				n++
+			}
+		}
+		if n > 0 {
+			fmt.Fprintf(os.Stderr, "warning: %d stages of %s have incomplete version metadata or a deleted artifact\n", n, r.Pipeline)
+		}
+		incomplete += n
+	}
+	if incomplete > 0 {
+		os.Exit(exitIncomplete)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+)
+
+// JUnit XML document, limited to the elements understood by both Jenkins
+// and GitLab.
+type (
+	junitSuites struct {
+		XMLName xml.Name     `xml:"testsuites"`
+		Suites  []junitSuite `xml:"testsuite"`
+	}
+
+	junitSuite struct {
+		Name      string      `xml:"name,attr"`
+		Tests     int         `xml:"tests,attr"`
+		Failures  int         `xml:"failures,attr"`
+		Errors    int         `xml:"errors,attr"`
+		Skipped   int         `xml:"skipped,attr"`
+		Timestamp string      `xml:"timestamp,attr"`
+		Cases     []junitCase `xml:"testcase"`
+	}
+
+	junitCase struct {
+		Name      string        `xml:"name,attr"`
+		ClassName string        `xml:"classname,attr"`
+		Failures  []junitResult `xml:"failure,omitempty"`
+		Skipped   *junitResult  `xml:"skipped,omitempty"`
+	}
+
+	junitResult struct {
+		Message string `xml:"message,attr"`
+		Type    string `xml:"type,attr,omitempty"`
+		Text    string `xml:",chardata"`
+	}
+)
+
+// renderJUnit prints the reports as JUnit XML, a test suite per pipeline
+// with a test case per stage. Failed or stopped stages fail their test case,
+// as do those that drifted, whose artifact fails its checksum or signature
+// check, or whose runtimes or version endpoints run another version. Stages
+// still in progress are skipped.
+func renderJUnit(w io.Writer, reports ...report) error {
+	var suites junitSuites
+	for _, r := range reports {
+		suites.Suites = append(suites.Suites, junitSuiteOf(r))
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(suites); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// junitSuiteOf converts the report of a single pipeline into a test suite.
+func junitSuiteOf(r report) junitSuite {
+	suite := junitSuite{
+		Name:      r.Pipeline,
+		Timestamp: r.QueriedAt.UTC().Format(time.RFC3339),
+	}
+
+	for _, details := range r.Stages {
+		tc := junitCase{
+			Name:      details.Name,
+			ClassName: r.Pipeline,
+		}
+
+		switch details.Status {
+		case "Failed", "Stopped":
+			tc.Failures = append(tc.Failures, junitResult{
+				Message: fmt.Sprintf("stage %s", details.Status),
+				Type:    details.Status,
+				Text:    fmt.Sprintf("status: %s\nexecution id: %s", details.Status, details.ExecutionID),
+			})
+		case "InProgress":
+			tc.Skipped = &junitResult{
+				Message: fmt.Sprintf("execution %s in progress", details.ExecutionID),
+			}
+		}
+
+		if r.Drift != nil && r.Drift.Drifted {
+			for _, line := range r.Drift.stageDrift(details.Name) {
+				tc.Failures = append(tc.Failures, junitResult{Message: "drift", Type: "Drift", Text: line})
+			}
+		}
+		if c := details.Checksum; c != nil && c.Status == checksumMismatch {
+			tc.Failures = append(tc.Failures, junitResult{
+				Message: "artifact checksum mismatch",
+				Type:    "ChecksumMismatch",
+				Text:    fmt.Sprintf("metadata records %s, artifact hashes to %s", c.Expected, c.Actual),
+			})
+		}
+		if s := details.Signature; s != nil && s.Status == signatureFailed {
+			tc.Failures = append(tc.Failures, junitResult{Message: "artifact signature doesn't verify", Type: "SignatureFailed"})
+		}
+		for _, msg := range runtimeDrift(details) {
+			tc.Failures = append(tc.Failures, junitResult{Message: "runtime drift", Type: "RuntimeDrift", Text: msg})
+		}
+		for _, c := range details.Endpoints {
+			if c.Status == runtimeDrifted {
+				tc.Failures = append(tc.Failures, junitResult{Message: "version endpoint drift", Type: "EndpointDrift", Text: fmt.Sprintf("%s serves %s", c.URL, c)})
+			}
+		}
+
+		if len(tc.Failures) > 0 {
+			suite.Failures++
+		}
+		if tc.Skipped != nil {
+			suite.Skipped++
+		}
+		suite.Tests++
+		suite.Cases = append(suite.Cases, tc)
+	}
+
+	return suite
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/lambda"
+)
+
+// lambdaVersionVariable is the environment variable deploy steps stamp the
+// version of a Lambda function into. Functions without it are versioned by
+// their description.
+const lambdaVersionVariable = "VERSION"
+
+// lambdaAlias is a Lambda function alias a stage deploys to.
+type lambdaAlias struct {
+	Function string
+	Alias    string
+}
+
+// functionRuntime is what a Lambda function alias of a stage actually
+// serves, checked against the version of the stage.
+type functionRuntime struct {
+	Function string `json:"function" yaml:"function"`
+	Alias    string `json:"alias" yaml:"alias"`
+	// FunctionVersion is the published function version behind the alias.
+	FunctionVersion string `json:"functionVersion,omitempty" yaml:"functionVersion,omitempty"`
+	Status          string `json:"status" yaml:"status"`
+	// Live is the version stamped into the function, see
+	// lambdaVersionVariable.
+	Live string `json:"live,omitempty" yaml:"live,omitempty"`
+	// Reason tells why the function couldn't be verified.
+	Reason string `json:"reason,omitempty" yaml:"reason,omitempty"`
+}
+
+// String renders the outcome, e.g. "MISMATCH (live 1.4.1)".
+func (f functionRuntime) String() string {
+	switch f.Status {
+	case runtimeOK:
+		return "OK"
+	case runtimeDrifted:
+		return fmt.Sprintf("MISMATCH (live %s)", f.Live)
+	}
+	return f.Status
+}
+
+// parseLambdaAliases parses STAGE=FUNCTION:ALIAS mappings, as given by
+// --lambda-function. The function may be given by its ARN.
+func parseLambdaAliases(specs []string) (map[string][]lambdaAlias, error) {
+	aliases := make(map[string][]lambdaAlias)
+	for _, spec := range specs {
+		if spec == "" {
+			continue
+		}
+		stage, path, _ := strings.Cut(spec, "=")
+		i := strings.LastIndex(path, ":")
+		if stage == "" || i <= 0 || i == len(path)-1 {
+			return nil, fmt.Errorf("invalid Lambda function %q, want STAGE=FUNCTION:ALIAS", spec)
+		}
+		aliases[stage] = append(aliases[stage], lambdaAlias{Function: path[:i], Alias: path[i+1:]})
+	}
+	return aliases, nil
+}
+
+// verifyFunctions checks what the Lambda function aliases --lambda-function
+// maps the stage to serve against its version. nil if it maps none.
+// Functions that can't be read are left unverified with a warning.
+func verifyFunctions(sess *session.Session, cfg Cfg, details stageDetails) []functionRuntime {
+	// validated on startup
+	mapped, _ := parseLambdaAliases(cfg.LambdaFunction)
+	aliases := mapped[details.Name]
+	if len(aliases) == 0 {
+		return nil
+	}
+
+	expected := expectedImages(details)
+	runtimes := make([]functionRuntime, len(aliases))
+	for i, a := range aliases {
+		rt := functionRuntime{Function: a.Function, Alias: a.Alias}
+		if len(expected) == 0 {
+			rt.Status, rt.Reason = runtimeUnverified, "the stage has no version to compare"
+		} else if err := checkFunction(sess, a, expected, &rt); err != nil {
+			rt.Status, rt.Reason = runtimeUnverified, err.Error()
+			warnUnverified(fmt.Sprintf("Lambda function %s alias %s", a.Function, a.Alias), err)
+		}
+		runtimes[i] = rt
+	}
+	return runtimes
+}
+
+// checkFunction compares the version stamped into the function version
+// behind the alias with the expected ones.
+func checkFunction(sess *session.Session, a lambdaAlias, expected map[string]bool, rt *functionRuntime) error {
+	svc := lambda.New(sess)
+	alias, err := svc.GetAlias(&lambda.GetAliasInput{
+		FunctionName: aws.String(a.Function),
+		Name:         aws.String(a.Alias),
+	})
+	if err != nil {
+		return lambdaError(err, "failed to get alias "+a.Alias)
+	}
+	rt.FunctionVersion = aws.StringValue(alias.FunctionVersion)
+
+	conf, err := svc.GetFunctionConfiguration(&lambda.GetFunctionConfigurationInput{
+		FunctionName: aws.String(a.Function),
+		Qualifier:    alias.FunctionVersion,
+	})
+	if err != nil {
+		return lambdaError(err, "failed to get the configuration of version "+rt.FunctionVersion)
+	}
+
+	if env := conf.Environment; env != nil && env.Variables[lambdaVersionVariable] != nil {
+		rt.Live = aws.StringValue(env.Variables[lambdaVersionVariable])
+		rt.Status = runtimeDrifted
+		if expected[rt.Live] {
+			rt.Status = runtimeOK
+		}
+		return nil
+	}
+
+	// the description may say more than the version, e.g. "api 1.4.2"
+	description := strings.TrimSpace(aws.StringValue(conf.Description))
+	if description == "" {
+		return fmt.Errorf("version %s has neither a %s variable nor a description", rt.FunctionVersion, lambdaVersionVariable)
+	}
+	rt.Live, rt.Status = description, runtimeDrifted
+	for _, word := range strings.FieldsFunc(description, func(r rune) bool { return r == ' ' || r == ',' || r == ';' }) {
+		if expected[word] {
+			rt.Live, rt.Status = word, runtimeOK
+		}
+	}
+	return nil
+}
+
+// lambdaError describes a failed Lambda call, doing what failed.
+func lambdaError(err error, doing string) error {
+	if aerr, ok := err.(awserr.Error); ok {
+		switch aerr.Code() {
+		case lambda.ErrCodeResourceNotFoundException:
+			return fmt.Errorf("%s: not found", doing)
+		default:
+			return fmt.Errorf("%s: %s", doing, aerr.Message())
+		}
+	}
+	return err
+}
+
+// warnedRuntimes remembers the functions and environments warned about,
+// once is enough.
+var warnedRuntimes sync.Map
+
+// warnUnverified reports on stderr that what couldn't be verified, once
+// per what.
+func warnUnverified(what string, err error) {
+	if _, warned := warnedRuntimes.LoadOrStore(what, true); warned {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "warning: %s unverified: %v\n", what, err)
+}
+
+// functionsSummary renders the outcome for every function alias of a stage
+// on a single line, naming the functions when there are several.
+func functionsSummary(runtimes []functionRuntime) string {
+	if len(runtimes) == 1 {
+		return runtimes[0].String()
+	}
+	s := make([]string, len(runtimes))
+	for i, rt := range runtimes {
+		s[i] = rt.Function + ":" + rt.Alias + " " + rt.String()
+	}
+	return strings.Join(s, "; ")
+}
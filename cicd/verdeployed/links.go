@@ -0,0 +1,59 @@
+package main
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/codepipeline"
+)
+
+// externalLink points at the execution of an action in the service running
+// it, e.g. a CodeBuild build or a CodeDeploy deployment.
+type externalLink struct {
+	Action      string `json:"actionName" yaml:"actionName"`
+	ExecutionID string `json:"externalExecutionId,omitempty" yaml:"externalExecutionId,omitempty"`
+	URL         string `json:"externalExecutionUrl" yaml:"externalExecutionUrl"`
+}
+
+// getExternalLinks collects the external execution links of the latest
+// execution of every action of a stage, in pipeline order. Actions without
+// an URL are left out.
+func getExternalLinks(states []*codepipeline.ActionState) []externalLink {
+	var links []externalLink
+	for _, astate := range states {
+		exec := astate.LatestExecution
+		if exec == nil || aws.StringValue(exec.ExternalExecutionUrl) == "" {
+			continue
+		}
+		links = append(links, externalLink{
+			Action:      aws.StringValue(astate.ActionName),
+			ExecutionID: aws.StringValue(exec.ExternalExecutionId),
+			URL:         aws.StringValue(exec.ExternalExecutionUrl),
+		})
+	}
+	return links
+}
+
+// hasLinks reports whether any of the stages has an external link.
+func hasLinks(stages []stageDetails) bool {
+	for _, details := range stages {
+		if len(details.Links) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// linkLine renders a link for the note below its stage, e.g.
+//
+//	↗ Build: https://console.aws.amazon.com/codesuite/codebuild/...
+//
+// With hyperlinks the action name links to the execution instead.
+func linkLine(l externalLink, hyperlinks bool) string {
+	if !hyperlinks {
+		return "    ↗ " + l.Action + ": " + l.URL
+	}
+	text := l.Action
+	if l.ExecutionID != "" {
+		text += " " + l.ExecutionID
+	}
+	return "    ↗ " + hyperlink(l.URL, text)
+}
@@ -1,49 +1,184 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
 	"regexp"
-	"text/tabwriter"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/ardanlabs/conf/v3"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/codepipeline"
 	"github.com/aws/aws-sdk-go/service/s3"
 )
 
+// The S3 source is told apart by its console link and revision summary
+// only when the pipeline definition doesn't name it, e.g. for a bucket set
+// by hand.
 var (
 	urlRe = regexp.MustCompile(`https://.*aws\.amazon\.com/s3/home\?region=[a-zA-Z]{2,3}-[a-zA-Z]+-[0-9]+#`)
 	revRe = regexp.MustCompile(`Amazon S3 version id: .*`)
 )
 
+// Exit codes. Failures to query AWS or write the output exit 1, so a
+// pipeline found unhealthy by --fail-on or drifting by --fail-on-drift,
+// --verify-ecs, --lambda-function, --verify-beanstalk or
+// --verify-codedeploy, version endpoints failing --check with
+// --fail-on-check, pipelines differing by compare --fail-on-diff, or an
+// artifact failing --verify-checksum or --verify-signature, can be told
+// apart.
+// Artifacts lacking version metadata or deleted since only warrant a
+// warning, reported after everything else. --wait times out and gets
+// interrupted with the codes timeout(1) and shells use.
+const (
+	exitUnhealthy   = 2
+	exitDrift       = 3
+	exitIncomplete  = 4
+	exitChecksum    = 5
+	exitSignature   = 6
+	exitTimeout     = 124
+	exitInterrupted = 130
+)
+
 type Cfg struct {
-	Region       string        `conf:"default:us-east-1"`
-	PipelineName string        `conf:""`
-	Bucket       string        `conf:""`
-	Key          string        `conf:"default:version.zip"`
-	Timeout      time.Duration `conf:"default:1m"`
+	Region            string        `conf:"default:us-east-1"`
+	PipelineName      string        `conf:"help:pipeline to report; a comma separated list reports several with name=bucket/key overriding the artifact location"`
+	All               bool          `conf:"help:report every pipeline in the region"`
+	PipelineFilter    string        `conf:"help:report every pipeline whose name matches this glob or /regular expression/"`
+	Tags              string        `conf:"help:report every pipeline carrying all of these comma separated key=value tags"`
+	Concurrency       int           `conf:"default:4,help:number of pipelines queried at the same time"`
+	StageConcurrency  int           `conf:"default:4,help:number of stages of a pipeline looked up at the same time"`
+	FailFast          bool          `conf:"help:abort on the first stage that can't be looked up instead of reporting the error on its row"`
+	SourceStage       string        `conf:"default:Source,help:stage holding the source actions; the stage with a source action when the pipeline has none by that name"`
+	Bucket            string        `conf:"help:S3 bucket of the version artifact; discovered from the S3 source action of the pipeline when empty. Pipelines sourced from Git or ECR only are versioned by commit or image digest. {pipeline} {region} and {stage} are replaced by the pipeline/region and stage looked up"`
+	BucketRegion      string        `conf:"help:region of the artifact bucket; detected when empty as it may differ from --region"`
+	Artifact          []string      `conf:"help:NAME=BUCKET/KEY location of a source artifact read instead of the one its S3 source action configures; may be repeated"`
+	ArtifactRoleArn   string        `conf:"help:role assumed to read the artifact bucket when it belongs to another account; CodePipeline is read with the default credentials"`
+	ArtifactSession   string        `conf:"default:verdeployed,help:session name of the assumed --artifact-role-arn"`
+	ExternalID        string        `conf:"help:external id the --artifact-role-arn trust policy requires"`
+	S3Attempts        int           `conf:"default:3,flag:s3-attempts,env:S3_ATTEMPTS,help:attempts at every S3 request before giving up; retries 404s of object versions not visible yet and slowdowns"`
+	SSECustomerKey    string        `conf:"mask,help:base64 encoded 256 bit key of artifacts encrypted with a customer provided key (SSE-C)"`
+	VersionKey        string        `conf:"default:Release,help:metadata key of the version; a comma separated list is tried in order"`
+	CommitKey         string        `conf:"default:Commit,help:metadata key of the commit; a comma separated list is tried in order and empty leaves the commit out"`
+	Key               string        `conf:"default:version.zip,help:S3 key of the version artifact; discovered along with the bucket when the bucket is empty; takes the same placeholders as --bucket"`
+	InspectArchive    bool          `conf:"help:read the version from a file inside the artifact archive when the object has no version metadata"`
+	ArchiveMember     string        `conf:"default:version.json,help:path of the version file inside the archive read by --inspect-archive"`
+	VerifyChecksum    bool          `conf:"help:verify the artifact of every stage against the SHA-256 recorded in its Sha256 metadata; exit 5 on a mismatch"`
+	VerifySignature   bool          `conf:"help:verify the KMS signature of the digest of the artifact of every stage; read from its Signature metadata or the .sig object next to it. Exit 6 when one doesn't verify"`
+	KMSKeyArn         string        `conf:"help:asymmetric KMS key --verify-signature verifies with"`
+	SigningAlgorithm  string        `conf:"default:ECDSA_SHA_256,help:signing algorithm of the --kms-key-arn signatures"`
+	ChecksumMaxSize   int           `conf:"default:100,help:largest artifact in MiB --verify-checksum downloads to hash when S3 stored no checksum"`
+	ArchiveMaxSize    int           `conf:"default:10,help:largest archive in MiB --inspect-archive and --image-definitions download"`
+	Timeout           time.Duration `conf:"default:1m,help:how long --wait blocks before giving up; 0 waits forever"`
+	Format            string        `conf:"default:table,help:output format (table|json|yaml|csv|tsv|markdown|html|prom|junit|ndjson|mermaid|dot)"`
+	NoHeader          bool          `conf:"help:omit the csv/tsv header row"`
+	CommitURLTemplate string        `conf:"help:link commits in markdown and html output; {commit} is replaced by the SHA"`
+	Template          string        `conf:"help:Go text/template rendered against the report instead of --format"`
+	Color             string        `conf:"default:auto,help:colorize table output (auto|always|never)"`
+	Plain             bool          `conf:"help:print the table tab delimited without padding; implied when stdout is not a terminal"`
+	Columns           string        `conf:"help:comma separated list of table/csv/tsv columns to print"`
+	Wide              bool          `conf:"help:add commit/revision id and last status change columns to the table"`
+	Durations         bool          `conf:"help:add a column with how long the latest execution of every stage took; implied by --columns duration"`
+	Behind            bool          `conf:"help:add a column counting the releases started after the latest execution of every stage; implied by --columns behind"`
+	Lookback          int           `conf:"default:50,help:past executions listed to count --behind; older stages show a lower bound followed by +"`
+	ImageDefinitions  bool          `conf:"help:version stages deploying to ECS by the container images in the imagedefinitions.json their deploy action read"`
+	ResolveImages     bool          `conf:"help:look up the tags and push time of ECR image sources to show the tags as the version"`
+	CommitDetails     bool          `conf:"help:look up the message/author and date of CodeCommit source commits and of GitHub ones when GITHUB_TOKEN is set; implied by --columns message/author or commitDate"`
+	CommitRepo        string        `conf:"help:CodeCommit repository --commit-details looks up the commits of S3 artifact metadata in"`
+	GitHubRepo        string        `conf:"flag:github-repo,env:GITHUB_REPO,help:owner/name of the GitHub repository --commit-details looks up the commits of S3 artifact metadata in; needs GITHUB_TOKEN"`
+	DeployedAt        bool          `conf:"help:add a column with when the latest deploy action of every stage succeeded; implied by --columns deployedAt"`
+	DeployedFor       bool          `conf:"help:add columns with how long every stage has run its version and how long ago that was built; implied by --columns deployedFor or built. Always in json/yaml/ndjson"`
+	Actions           bool          `conf:"help:list the actions of every stage below it"`
+	ShowBuild         bool          `conf:"help:add a column with the CodeBuild build that produced the artifact of every stage; implied by --columns build"`
+	VerifyECS         bool          `conf:"help:check that the ECS services of every stage run its version; exit 3 when one runs something else"`
+	ECSService        []string      `conf:"help:STAGE=CLUSTER/SERVICE ECS service --verify-ecs checks for the stage instead of those its deploy actions name; may be repeated"`
+	VerifyBeanstalk   bool          `conf:"help:check that the version label of the Elastic Beanstalk environments of every stage embeds its version and show their health; exit 3 when one doesn't"`
+	BeanstalkEnv      []string      `conf:"help:STAGE=APPLICATION/ENVIRONMENT Elastic Beanstalk environment --verify-beanstalk checks for the stage instead of those its deploy actions name; may be repeated"`
+	VerifyCodeDeploy  bool          `conf:"flag:verify-codedeploy,env:VERIFY_CODEDEPLOY,help:check the last deployment of the CodeDeploy deployment groups of every stage against its revision; exit 3 when one deployed something else or was rolled back"`
+	DeploymentGroup   []string      `conf:"help:STAGE=APPLICATION/GROUP CodeDeploy deployment group --verify-codedeploy checks for the stage instead of those its deploy actions name; may be repeated"`
+	Check             []string      `conf:"help:STAGE=URL version endpoint whose JSON must serve the version and commit of the stage; may be repeated"`
+	CheckVersionPath  string        `conf:"default:version,help:dot separated path of the version in the JSON of --check endpoints"`
+	CheckCommitPath   string        `conf:"default:commit,help:dot separated path of the commit in the JSON of --check endpoints"`
+	CheckTimeout      time.Duration `conf:"default:5s,help:how long to wait for a --check endpoint"`
+	CheckToken        string        `conf:"mask,help:bearer token sent to --check endpoints"`
+	CheckInsecure     bool          `conf:"help:don't verify the TLS certificates of --check endpoints; for self-signed ones of staging"`
+	FailOnCheck       bool          `conf:"help:exit 3 when a --check endpoint serves another version or commit than its stage"`
+	SSMParameter      []string      `conf:"help:STAGE=NAME Parameter Store parameter the deploy step records the version of the stage in; may be repeated"`
+	LambdaFunction    []string      `conf:"help:STAGE=FUNCTION:ALIAS Lambda function alias whose VERSION variable or description must match the version of the stage; exit 3 when one doesn't; may be repeated"`
+	ShowTargets       bool          `conf:"help:add a column with the ECS service/CloudFormation stack/CodeDeploy group/S3 bucket every stage deploys to"`
+	ShowLinks         bool          `conf:"help:print the CodeBuild/CodeDeploy/CloudFormation execution links of every stage below it"`
+	ShowMetadata      bool          `conf:"help:print every metadata key and value of the artifact of every stage below it"`
+	ShowErrors        bool          `conf:"help:print the error of every failed action below its stage"`
+	ErrorLength       int           `conf:"default:500,help:truncate error messages to this many characters; 0 keeps them whole"`
+	ShowVariables     bool          `conf:"help:add a column per pipeline variable the stage executions were started with; all of them unless --variable is set"`
+	Variable          string        `conf:"help:comma separated names of the pipeline variables to show as columns; implies --show-variables"`
+	Wait              bool          `conf:"help:block until the current execution settles and print the final state; with retry until the retried stage settles and with start until the new execution finishes"`
+	Watch             bool          `conf:"help:redraw the table every --watch-interval until interrupted"`
+	WatchInterval     time.Duration `conf:"default:30s,help:time between two refreshes of --watch"`
+	UntilDone         bool          `conf:"help:stop watching once no stage is in progress"`
+	FailOn            string        `conf:"help:exit 2 when the pipeline is unhealthy; a comma separated list of checks: failed for any stage that Failed or was Stopped and stuck for any stage past --stuck-after"`
+	StuckAfter        time.Duration `conf:"help:flag stages in progress without a status change for this long; also fails --wait and --watch --until-done; 0 disables"`
+	FailOnDrift       bool          `conf:"help:exit 3 when a stage runs another --drift-field than the first stage of the pipeline"`
+	DriftBehindOnly   bool          `conf:"help:make --fail-on-drift only exit 3 for stages behind the first stage; those ahead of it or running versions that can't be ordered are only reported"`
+	DriftField        string        `conf:"default:version,help:stage field compared by --fail-on-drift (version|commit)"`
+	Commit            string        `conf:"help:commit wait-for waits for; a prefix of the SHA will do"`
+	Release           string        `conf:"help:version wait-for waits for; also given as --version"`
+	RetryAll          bool          `conf:"help:retry every action of the stage instead of the failed ones"`
+	Action            string        `conf:"help:approval action to approve or reject; may be omitted when the stage has a single one pending"`
+	Comment           string        `conf:"help:comment left when approving or rejecting"`
+	Yes               bool          `conf:"help:do not ask for confirmation before approving the only pending approval or stopping an execution"`
+	Var               []string      `conf:"help:KEY=VALUE pipeline variable passed to start; may be repeated"`
+	RequestToken      string        `conf:"help:client request token of start; rerunning start with the same token doesn't start another execution"`
+	DryRun            bool          `conf:"help:show what start would do without doing it"`
+	ExecutionID       string        `conf:"help:execution to stop; the current execution of the Source stage by default"`
+	Abandon           bool          `conf:"help:abandon the in progress actions of the stopped execution instead of letting them finish"`
+	Presign           time.Duration `conf:"help:print a presigned URL of the artifact download would fetch valid this long instead of downloading it"`
+	Force             bool          `conf:"help:let download overwrite an existing --out file"`
+	Reason            string        `conf:"help:reason recorded for stopping an execution or freezing a stage"`
+	FailOnDiff        bool          `conf:"help:make compare exit 3 when a stage runs different versions in the compared pipelines"`
+	History           int           `conf:"help:list the last N executions of the pipeline with their versions instead of the stages"`
+	Since             string        `conf:"help:only list executions of --history started since then: a duration back from now like 7d or 12h/a date or an RFC3339 timestamp"`
+	Until             string        `conf:"help:only list executions of --history started until then; same formats as --since"`
+	Status            string        `conf:"help:only list executions of --history with one of these comma separated statuses"`
+	Stage             string        `conf:"help:only report the named stage"`
+	Stages            string        `conf:"help:only report these comma separated stages; matched case-insensitively"`
+	ExcludeStages     string        `conf:"help:do not report these comma separated stages; matched case-insensitively"`
+	Verbose           bool          `conf:"help:print the artifact locations read on stderr"`
+	Quiet             bool          `conf:"short:q,help:print only --field of --stage"`
+	Field             string        `conf:"default:version,help:column printed in quiet mode"`
+	FullSHA           bool          `conf:"help:do not abbreviate commits in table/markdown/html output"`
+	UTC               bool          `conf:"help:show raw UTC timestamps instead of relative ages; same as --time-format rfc3339 --timezone UTC"`
+	TimeFormat        string        `conf:"help:timestamp format of human readable output: a Go layout or rfc3339|unix|relative"`
+	Timezone          string        `conf:"default:UTC,help:timezone of human readable timestamps: an IANA name or local"`
+	NoSummary         bool          `conf:"help:do not print the summary line after the table"`
+	Links             bool          `conf:"help:print console URLs as a column instead of terminal hyperlinks"`
+	GroupBy           string        `conf:"help:group stages by version instead of listing them one by one"`
+	Output            string        `conf:"help:write output to this file instead of stdout; replaced only on success"`
+	NoStepSummary     bool          `conf:"help:do not append a markdown job summary to $GITHUB_STEP_SUMMARY when running in GitHub Actions"`
 }
 
 func main() {
-	type stageDetails struct {
-		name            string
-		executionId     string
-		status          string
-		revisionId      string
-		versionDeployed string
-		releaseUrl      string
-		commit          string
-	}
-
 	// =========================================================================
 	// Configuration
 	var cfg Cfg
 
+	command, args, lists, err := parseCommand(os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Args = append(os.Args[:1:1], args...)
+
 	const prefix = "verdeployed"
 	help, err := conf.Parse(prefix, &cfg)
 	if err != nil {
@@ -51,138 +186,1081 @@ func main() {
 			fmt.Println(help)
 			os.Exit(0)
 		}
-		fmt.Printf("parsing config: %v", err)
+		fmt.Fprintf(os.Stderr, "parsing config: %v\n", err)
 		os.Exit(1)
 	}
+	setLists(&cfg, lists)
 
-	// initialize tabwriter
-	w := new(tabwriter.Writer)
-	// minwidth, tabwidth, padding, padchar, flags
-	w.Init(os.Stdout, 8, 8, 0, '\t', 0)
+	if !validFormat(cfg.Format) {
+		fmt.Fprintf(os.Stderr, "unsupported format %q\n", cfg.Format)
+		os.Exit(1)
+	}
+	if err := validGroupBy(cfg.GroupBy, cfg.Format); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err := validFailOn(cfg.FailOn); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if strings.Contains(cfg.FailOn, failOnStuck) && cfg.StuckAfter <= 0 {
+		fmt.Fprintln(os.Stderr, "--fail-on stuck requires --stuck-after")
+		os.Exit(1)
+	}
+	if (cfg.InspectArchive || cfg.ImageDefinitions) && cfg.ArchiveMaxSize < 1 {
+		fmt.Fprintln(os.Stderr, "--archive-max-size must be a positive number of MiB")
+		os.Exit(1)
+	}
+	if cfg.CommitRepo != "" && cfg.GitHubRepo != "" {
+		fmt.Fprintln(os.Stderr, "--commit-repo and --github-repo are mutually exclusive")
+		os.Exit(1)
+	}
+	if err := validLocation("bucket", cfg.Bucket); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err := validLocation("key", cfg.Key); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if _, err := parseArtifactLocations(cfg.Artifact); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if _, err := parseECSServices(cfg.ECSService); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if _, err := parseLambdaAliases(cfg.LambdaFunction); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if _, err := parseBeanstalkEnvs(cfg.BeanstalkEnv); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if _, err := parseDeploymentGroups(cfg.DeploymentGroup); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if _, err := parseParameters(cfg.SSMParameter); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if _, err := parseChecks(cfg.Check); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if len(cfg.Check) > 0 && cfg.CheckTimeout <= 0 {
+		fmt.Fprintln(os.Stderr, "--check-timeout must be a positive duration")
+		os.Exit(1)
+	}
+	if cfg.S3Attempts < 1 {
+		fmt.Fprintln(os.Stderr, "--s3-attempts must be a positive number of attempts")
+		os.Exit(1)
+	}
+	if _, err := sseCustomerKey(cfg); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if cfg.VerifySignature {
+		if cfg.KMSKeyArn == "" {
+			fmt.Fprintln(os.Stderr, "--verify-signature requires --kms-key-arn")
+			os.Exit(1)
+		}
+		if _, err := arn.Parse(cfg.KMSKeyArn); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid --kms-key-arn: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if (cfg.VerifyChecksum || cfg.VerifySignature) && cfg.ChecksumMaxSize < 1 {
+		fmt.Fprintln(os.Stderr, "--checksum-max-size must be a positive number of MiB")
+		os.Exit(1)
+	}
+	if cfg.Lookback < 1 {
+		fmt.Fprintln(os.Stderr, "--lookback must be a positive number of executions")
+		os.Exit(1)
+	}
+	if err := validDriftField(cfg.DriftField); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	targets, err := parsePipelineNames(cfg.PipelineName, cfg.Bucket, cfg.Key)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	// lookup is set when the pipelines to report are looked up by name or
+	// tags, a filter and tags narrow each other down
+	lookup := cfg.All || cfg.PipelineFilter != "" || cfg.Tags != ""
+	if lookup && len(targets) > 0 {
+		fmt.Fprintln(os.Stderr, "--pipeline-name can't be combined with --all, --pipeline-filter or --tags")
+		os.Exit(1)
+	}
+	if cfg.All && cfg.PipelineFilter != "" {
+		fmt.Fprintln(os.Stderr, "--all and --pipeline-filter are mutually exclusive")
+		os.Exit(1)
+	}
+
+	// the fleet covers every pipeline unless told otherwise
+	if command == cmdFleet && !lookup && len(targets) == 0 {
+		cfg.All, lookup = true, true
+	}
+
+	multi := lookup || len(targets) > 1 || command == cmdFleet
+	if len(targets) == 1 {
+		t := targets[0]
+		cfg.PipelineName, cfg.Bucket, cfg.Key = t.Name, t.Bucket, t.Key
+	}
+	if multi {
+		if err := validMulti(cfg); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	var filter pipelineFilter
+	if cfg.PipelineFilter != "" {
+		f, err := parsePipelineFilter(cfg.PipelineFilter)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		filter = f
+	}
+
+	var tags map[string]string
+	if cfg.Tags != "" {
+		t, err := parseTags(cfg.Tags)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		tags = t
+	}
 
-	defer w.Flush()
+	if cfg.History < 0 {
+		fmt.Fprintln(os.Stderr, "--history must be a positive number of executions")
+		os.Exit(1)
+	}
+	if cfg.History > 0 {
+		switch {
+		case multi:
+			fmt.Fprintln(os.Stderr, "history supports a single pipeline")
+			os.Exit(1)
+		case cfg.Quiet || cfg.GroupBy != "" || cfg.Stage != "" || cfg.Stages != "" || cfg.ExcludeStages != "":
+			fmt.Fprintln(os.Stderr, "--history can't be combined with --quiet, --group-by or stage filters")
+			os.Exit(1)
+		case cfg.Template == "":
+			if err := validHistoryFormat(cfg.Format); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+		}
+	}
+	if cfg.History == 0 && (cfg.Since != "" || cfg.Until != "" || cfg.Status != "") {
+		fmt.Fprintln(os.Stderr, "--since, --until and --status filter --history")
+		os.Exit(1)
+	}
+	hfilter, err := parseHistoryFilter(cfg, time.Now())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if command == cmdWaitFor {
+		if multi {
+			fmt.Fprintln(os.Stderr, "wait-for supports a single pipeline")
+			os.Exit(1)
+		}
+		if err := validWaitFor(cfg); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	if command == cmdRetry {
+		if multi {
+			fmt.Fprintln(os.Stderr, "retry supports a single pipeline")
+			os.Exit(1)
+		}
+		if err := validRetry(cfg); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	approving := command == cmdApprove || command == cmdReject
+	if approving {
+		if multi {
+			fmt.Fprintf(os.Stderr, "%s supports a single pipeline\n", command)
+			os.Exit(1)
+		}
+		if err := validApproval(command, cfg); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	if command == cmdStart {
+		if multi {
+			fmt.Fprintln(os.Stderr, "start supports a single pipeline")
+			os.Exit(1)
+		}
+		if err := validStart(cfg); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	if command == cmdStop {
+		if multi {
+			fmt.Fprintln(os.Stderr, "stop supports a single pipeline")
+			os.Exit(1)
+		}
+		if err := validStop(cfg); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	if command == cmdDownload {
+		if multi {
+			fmt.Fprintln(os.Stderr, "download supports a single pipeline")
+			os.Exit(1)
+		}
+		if err := validDownload(cfg); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	freezing := command == cmdFreeze || command == cmdUnfreeze
+	if freezing {
+		if multi {
+			fmt.Fprintf(os.Stderr, "%s supports a single pipeline\n", command)
+			os.Exit(1)
+		}
+		if err := validFreeze(command, cfg); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	if command == cmdCompare {
+		if !multi {
+			fmt.Fprintln(os.Stderr, "compare requires at least two pipelines")
+			os.Exit(1)
+		}
+		if err := validCompareFormat(cfg.Format); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	if command == cmdFleet {
+		if cfg.Watch || cfg.History > 0 || cfg.Wait {
+			fmt.Fprintln(os.Stderr, "fleet can't be combined with --watch, --history or --wait")
+			os.Exit(1)
+		}
+		if err := validFleetFormat(cfg.Format); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	if cfg.Wait && command == cmdReport {
+		switch {
+		case multi:
+			fmt.Fprintln(os.Stderr, "--wait supports a single pipeline")
+			os.Exit(1)
+		case cfg.Watch || cfg.History > 0:
+			fmt.Fprintln(os.Stderr, "--wait can't be combined with --watch or --history")
+			os.Exit(1)
+		}
+	}
+	if cfg.Watch {
+		if err := validWatch(cfg); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	var quietField column
+	if cfg.Quiet {
+		if cfg.Stage == "" {
+			fmt.Fprintln(os.Stderr, "quiet mode requires --stage")
+			os.Exit(1)
+		}
+		col, ok := lookupColumn(cfg.Field)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "unknown field %q, valid fields are: %s\n", cfg.Field, strings.Join(columnNames(), ", "))
+			os.Exit(1)
+		}
+		quietField = col
+		cfg.Durations = cfg.Durations || col.Name == durationColumn.Name
+		cfg.DeployedAt = cfg.DeployedAt || col.Name == deployedAtColumn.Name
+		cfg.DeployedFor = cfg.DeployedFor || col.Name == deployedForColumn.Name
+		cfg.Behind = cfg.Behind || col.Name == behindColumn.Name
+		cfg.ShowBuild = cfg.ShowBuild || col.Name == buildColumn.Name
+		cfg.VerifyECS = cfg.VerifyECS || col.Name == runtimeColumn.Name
+		cfg.CommitDetails = cfg.CommitDetails || wantsCommitDetails(col.Name)
+	}
+
+	terminal := cfg.Output == "" && isTerminal(os.Stdout)
+	color, err := useColor(cfg.Color, terminal)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	opts := renderOptions{
+		NoHeader:          cfg.NoHeader,
+		CommitURLTemplate: cfg.CommitURLTemplate,
+		Color:             color,
+		Plain:             cfg.Plain || !terminal,
+		Wide:              cfg.Wide,
+		FullSHA:           cfg.FullSHA,
+		NoSummary:         cfg.NoSummary,
+		Hyperlinks:        terminal && !cfg.Links && supportsHyperlinks(),
+		Links:             cfg.Links,
+		Durations:         cfg.Durations,
+		DeployedAt:        cfg.DeployedAt,
+		DeployedFor:       cfg.DeployedFor,
+		Behind:            cfg.Behind,
+		Actions:           cfg.Actions,
+		ShowErrors:        cfg.ShowErrors,
+		ShowLinks:         cfg.ShowLinks,
+		ShowMetadata:      cfg.ShowMetadata,
+		ShowTargets:       cfg.ShowTargets,
+		VerifySignature:   cfg.VerifySignature,
+		VerifyRuntime:     cfg.VerifyECS || len(cfg.LambdaFunction) > 0 || cfg.VerifyBeanstalk || cfg.VerifyCodeDeploy,
+		Live:              len(cfg.Check) > 0,
+		Parameter:         len(cfg.SSMParameter) > 0,
+	}
+	if cfg.Variable != "" {
+		cfg.ShowVariables = true
+	}
+	if cfg.ShowVariables {
+		opts.Variables = parseNames(cfg.Variable)
+	}
+	if cfg.UTC {
+		cfg.TimeFormat, cfg.Timezone = timeRFC3339, "UTC"
+	}
+	times, err := parseTimeFormat(cfg.TimeFormat, cfg.Timezone)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	opts.Times = times
+
+	if cfg.Columns != "" {
+		cols, err := parseColumns(cfg.Columns)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		opts.Columns = cols
+		// the columns of the action executions cost extra API calls,
+		// only made when asked for
+		cfg.Durations = cfg.Durations || wantsColumn(cfg.Columns, durationColumn.Name)
+		cfg.DeployedAt = cfg.DeployedAt || wantsColumn(cfg.Columns, deployedAtColumn.Name)
+		cfg.DeployedFor = cfg.DeployedFor || wantsColumn(cfg.Columns, deployedForColumn.Name)
+		cfg.Behind = cfg.Behind || wantsColumn(cfg.Columns, behindColumn.Name)
+		cfg.ShowBuild = cfg.ShowBuild || wantsColumn(cfg.Columns, buildColumn.Name)
+		cfg.VerifyECS = cfg.VerifyECS || wantsColumn(cfg.Columns, runtimeColumn.Name)
+		cfg.CommitDetails = cfg.CommitDetails || wantsCommitDetails(cfg.Columns)
+	}
+	// documents always tell how long every stage has run its version
+	switch cfg.Format {
+	case formatJSON, formatYAML, formatNDJSON:
+		cfg.DeployedFor = true
+	}
+	if cfg.Template != "" {
+		tmpl, err := parseTemplate(cfg.Template)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "parsing template: %v\n", err)
+			os.Exit(1)
+		}
+		opts.Template = tmpl
+	}
 
 	// =========================================================================
 	// AWS Session
 	sess, err := session.NewSession(aws.NewConfig().WithRegion(cfg.Region))
 	if err != nil {
-		fmt.Printf("session error: %v", err)
+		fmt.Fprintf(os.Stderr, "session error: %v\n", err)
 		os.Exit(1)
 	}
 
+	// stepSummary appends the report to the GitHub Actions job summary.
+	// It is best effort, the job summary is a convenience on top of the
+	// regular output.
+	stepSummary := func(r report) {
+		path := os.Getenv(stepSummaryEnv)
+		if path == "" || cfg.NoStepSummary {
+			return
+		}
+		if err := appendStepSummary(path, opts, r); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: writing job summary: %v\n", err)
+		}
+	}
+
+	// output sends whatever write produces to stdout or the output file.
+	output := func(write func(w io.Writer) error) error {
+		if cfg.Output != "" {
+			err := writeFileAtomic(cfg.Output, write)
+			if isIncomplete(err) {
+				fmt.Fprintf(os.Stderr, "%s left unchanged: %v\n", cfg.Output, err)
+			}
+			return err
+		}
+		return write(os.Stdout)
+	}
+
+	// reportColumns adds the columns that depend on what the reports hold,
+	// every variable unless --variable picked some, the artifacts of
+	// pipelines with several sources and the builds of those building with
+	// CodeBuild.
+	reportColumns := func(opts renderOptions, reports ...report) renderOptions {
+		if cfg.ShowVariables && opts.Variables == nil {
+			opts.Variables = variableNames(reports...)
+		}
+		opts.ShowBuild = cfg.ShowBuild && hasBuilds(reports...)
+		opts.Artifacts = artifactNames(reports...)
+		return opts
+	}
+
+	// runWatch redraws whatever query returns until interrupted.
+	runWatch := func(query func() ([]report, []error), draw func(w io.Writer, opts renderOptions, reports []report) error) {
+		wo := watchOptions{
+			Interval:  cfg.WatchInterval,
+			UntilDone: cfg.UntilDone,
+			Redraw:    terminal,
+		}
+		err := watch(os.Stdout, wo, query, func(w io.Writer, changed map[string]bool, reports []report) error {
+			opts := reportColumns(opts, reports...)
+			opts.Changed = changed
+			return draw(w, opts, reports)
+		})
+		if errors.Is(err, errStuck) {
+			exitIfWaitFailed(err)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "writing output: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
 	// =========================================================================
-	// Codepipeline state
-	pipelnsvc := codepipeline.New(sess)
-	pipelnStateInput := &codepipeline.GetPipelineStateInput{
-		Name: aws.String(cfg.PipelineName),
+	// Retry a stage
+	// The resumed execution id goes to stdout, --wait blocks until the
+	// retried stage settles and fails unless it succeeded.
+	if command == cmdRetry {
+		execID, err := retryStage(sess, cfg)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Println(execID)
+		if !cfg.Wait {
+			return
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		status, err := waitForStage(ctx, sess, cfg, execID, os.Stderr)
+		stop()
+		exitIfWaitFailed(err)
+		if status != codepipeline.StageExecutionStatusSucceeded {
+			os.Exit(exitUnhealthy)
+		}
+		return
 	}
 
-	state, err := pipelnsvc.GetPipelineState(pipelnStateInput)
-	if err != nil {
-		if aerr, ok := err.(awserr.Error); ok {
-			switch aerr.Code() {
-			default:
-				fmt.Printf("failed to get pipeline state: %s\n", aerr.Message())
+	// =========================================================================
+	// Start an execution
+	// The new execution id goes to stdout, --wait follows the execution and
+	// fails unless it succeeded.
+	if command == cmdStart {
+		vars, err := parsePipelineVariables(cfg.Var)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		token := cfg.RequestToken
+		if token == "" {
+			if token, err = newRequestToken(); err != nil {
+				fmt.Fprintf(os.Stderr, "generating request token: %v\n", err)
+				os.Exit(1)
 			}
-		} else {
-			fmt.Println(err.Error())
 		}
-		os.Exit(1)
+
+		pipelnsvc := codepipeline.New(sess)
+		if cfg.DryRun {
+			if err := describeStart(os.Stdout, pipelnsvc, cfg, vars, token); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
+		}
+
+		execID, err := startPipeline(pipelnsvc, cfg, vars, token)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Println(execID)
+		if !cfg.Wait {
+			return
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		status, err := waitForExecution(ctx, sess, cfg, execID, os.Stderr)
+		stop()
+		exitIfWaitFailed(err)
+		if status != codepipeline.PipelineExecutionStatusSucceeded {
+			os.Exit(exitUnhealthy)
+		}
+		return
 	}
-	var execId, revid string
 
-	fmt.Fprintf(w, "%s\t%s\t%s\t\t%s\t\t%s\n", "Stage", "Status", "Version", "Release URL", "ExecutionID")
-	fmt.Fprintf(w, "%s\t%s\t%s\t\t%s\t\t%s\n", "----", "----", "----", "----", "----")
+	// =========================================================================
+	// Download the deployed artifact
+	// The version downloaded is printed so there is no doubt which one it
+	// was, the presigned URL goes to stdout.
+	if command == cmdDownload {
+		acfg, ver, err := deployedArtifact(sess, cfg)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		what := "version " + ver
+		if isETag(ver) {
+			what = "ETag " + ver
+		}
 
-	// Get&Print every stage details
-	for _, stage := range state.StageStates {
-		// Get revision id from current pipeline execution
-		// This can be get for Source stage only (?)
-		if *stage.StageName == "Source" {
-			for _, astate := range stage.ActionStates {
-				if urlRe.MatchString(*astate.EntityUrl) {
-					revid = *astate.CurrentRevision.RevisionId
-					break
-				}
+		if cfg.Presign > 0 {
+			url, err := presignArtifact(sess, acfg, ver, cfg.Presign)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
 			}
-			// Also
-			execId = *stage.LatestExecution.PipelineExecutionId
+			fmt.Fprintf(os.Stderr, "s3://%s/%s %s, valid for %s\n", acfg.Bucket, acfg.Key, what, cfg.Presign)
+			fmt.Println(url)
+			return
+		}
+
+		var progress io.Writer
+		if isTerminal(os.Stderr) {
+			progress = os.Stderr
+		}
+		downloaded, err := downloadArtifact(sess, acfg, ver, cfg.Output, progress)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
 		}
-		// save stage details
-		details := stageDetails{
-			name:        *stage.StageName,
-			executionId: *stage.LatestExecution.PipelineExecutionId,
-			status:      *stage.LatestExecution.Status,
+		if downloaded != "" {
+			what = "version " + downloaded
 		}
-		// if stage is from current pipeline execution save revision Id
-		if execId == details.executionId {
-			details.revisionId = revid
-			// if stage was executed earlier - not in this run - retrieve
-			// revision id from that execution
-		} else {
-			pipelineExecutionInput := &codepipeline.GetPipelineExecutionInput{
-				PipelineExecutionId: &details.executionId,
-				PipelineName:        &cfg.PipelineName,
+		fmt.Fprintf(os.Stderr, "downloaded s3://%s/%s %s to %s\n", acfg.Bucket, acfg.Key, what, cfg.Output)
+		return
+	}
+
+	// =========================================================================
+	// Approve or reject
+	// The pipeline is reported afterwards like any other run, so the stage
+	// can be seen moving on.
+	if approving {
+		pipelnsvc := codepipeline.New(sess)
+		p, ask, err := selectApproval(pipelnsvc, cfg)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		status := approvalApproved
+		if command == cmdReject {
+			status = approvalRejected
+		}
+		if ask && !cfg.Yes {
+			ok, err := confirm(fmt.Sprintf("%s %s of pipeline %s?", command, p, cfg.PipelineName))
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			if !ok {
+				fmt.Fprintln(os.Stderr, "aborted")
+				os.Exit(1)
+			}
+		}
+
+		if err := putApproval(pipelnsvc, cfg.PipelineName, p, status, cfg.Comment); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "%s %s\n", strings.ToLower(status), p)
+	}
+
+	// =========================================================================
+	// Stop an execution
+	// The pipeline is reported afterwards like any other run, so the
+	// stopped stages can be seen.
+	if command == cmdStop {
+		pipelnsvc := codepipeline.New(sess)
+		execID := cfg.ExecutionID
+		if execID == "" {
+			if execID, err = currentExecution(pipelnsvc, cfg.PipelineName, cfg.SourceStage); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+		}
+
+		how := "stop"
+		if cfg.Abandon {
+			how = "abandon"
+		}
+		if !cfg.Yes {
+			ok, err := confirm(fmt.Sprintf("%s execution %s of pipeline %s?", how, execID, cfg.PipelineName))
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			if !ok {
+				fmt.Fprintln(os.Stderr, "aborted")
+				os.Exit(1)
+			}
+		}
+
+		if err := stopExecution(pipelnsvc, cfg, execID); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "stopping execution %s\n", execID)
+	}
+
+	// =========================================================================
+	// Freeze or unfreeze a stage
+	// The pipeline is reported afterwards like any other run, showing the
+	// transition state.
+	if freezing {
+		enable := command == cmdUnfreeze
+		if err := setTransition(codepipeline.New(sess), cfg, enable); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		state := "disabled"
+		if enable {
+			state = "enabled"
+		}
+		fmt.Fprintf(os.Stderr, "transition into %s %s\n", cfg.Stage, state)
+	}
+
+	// =========================================================================
+	// Execution history
+	if cfg.History > 0 {
+		h := historyReport{
+			Pipeline:  cfg.PipelineName,
+			Region:    cfg.Region,
+			QueriedAt: time.Now().UTC(),
+		}
+		h.Executions, err = getHistory(sess, cfg, cfg.History, hfilter)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		for _, e := range h.Executions {
+			if e.Error != "" {
+				fmt.Fprintf(os.Stderr, "warning: execution %s: %s\n", e.ExecutionID, e.Error)
 			}
+		}
+
+		err := output(func(w io.Writer) error {
+			return renderHistory(w, cfg.Format, opts, h)
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "writing output: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
 
-			execution, err := pipelnsvc.GetPipelineExecution(pipelineExecutionInput)
+	// =========================================================================
+	// Multiple pipelines
+	// A pipeline that can't be queried doesn't hide the others, failures
+	// are reported once everything else was printed.
+	if multi {
+		if lookup {
+			names, err := listPipelines(sess)
 			if err != nil {
-				if aerr, ok := err.(awserr.Error); ok {
-					switch aerr.Code() {
-					default:
-						fmt.Println(aerr.Error())
-					}
-				} else {
-					// Prin the error, cat err to awserr.Error to get the Code and
-					// Message from an error.
-					fmt.Println(err.Error())
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			if cfg.PipelineFilter != "" {
+				if names, err = filter.filter(names); err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					os.Exit(1)
+				}
+			}
+			if tags != nil {
+				if names, err = pipelinesWithTags(sess, names, tags, cfg.Concurrency); err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					os.Exit(1)
+				}
+				if len(names) == 0 {
+					fmt.Fprintf(os.Stderr, "no pipeline is tagged %s\n", formatTags(tags))
+					os.Exit(1)
+				}
+				fmt.Fprintf(os.Stderr, "tags %s matched %d pipelines: %s\n", formatTags(tags), len(names), strings.Join(names, ", "))
+			}
+			targets = pipelineTargets(names, cfg)
+		}
+
+		if command == cmdFleet {
+			names := make([]string, len(targets))
+			for i, t := range targets {
+				names[i] = t.Name
+			}
+			f := fleetReport{
+				Region:    cfg.Region,
+				QueriedAt: time.Now().UTC(),
+				Pipelines: queryFleet(sess, names, cfg.Concurrency),
+			}
+			err := output(func(w io.Writer) error {
+				return renderFleet(w, cfg.Format, opts, f)
+			})
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "writing output: %v\n", err)
+				os.Exit(1)
+			}
+
+			var failed bool
+			for _, row := range f.Pipelines {
+				if row.Error != "" {
+					fmt.Fprintf(os.Stderr, "%s: %s\n", row.Pipeline, row.Error)
+					failed = true
 				}
+			}
+			if failed {
+				os.Exit(1)
+			}
+			return
+		}
+
+		if command == cmdCompare {
+			reports, errs := queryPipelines(sess, cfg, targets, cfg.Concurrency)
+			for _, err := range errs {
+				fmt.Fprintln(os.Stderr, err)
+			}
+			if len(errs) > 0 {
+				os.Exit(1)
+			}
+			if len(reports) < 2 {
+				fmt.Fprintln(os.Stderr, "compare requires at least two pipelines")
 				os.Exit(1)
 			}
-			// finally, save revisionId from earlier execution
-			for _, revision := range execution.PipelineExecution.ArtifactRevisions {
-				if revRe.MatchString(*revision.RevisionSummary) {
-					details.revisionId = *revision.RevisionId
+
+			c := compareReports(reports)
+			err := output(func(w io.Writer) error {
+				if err := renderComparison(w, cfg.Format, opts, c); err != nil {
+					return err
 				}
+				return incompleteReport(nil, reports...)
+			})
+			if err != nil && !isIncomplete(err) {
+				fmt.Fprintf(os.Stderr, "writing output: %v\n", err)
+				os.Exit(1)
 			}
+			exitIfStagesFailed(reports...)
+			if cfg.FailOnDiff && c.Differs {
+				os.Exit(exitDrift)
+			}
+			return
+		}
+
+		if cfg.Watch {
+			runWatch(func() ([]report, []error) {
+				return queryPipelines(sess, cfg, targets, cfg.Concurrency)
+			}, func(w io.Writer, opts renderOptions, reports []report) error {
+				return renderMulti(w, cfg.Format, opts, reports)
+			})
+			return
+		}
+
+		reports, errs := queryPipelines(sess, cfg, targets, cfg.Concurrency)
+		opts := reportColumns(opts, reports...)
+		err := output(func(w io.Writer) error {
+			if err := renderMulti(w, cfg.Format, opts, reports); err != nil {
+				return err
+			}
+			return incompleteReport(errs, reports...)
+		})
+		if err != nil && !isIncomplete(err) {
+			fmt.Fprintf(os.Stderr, "writing output: %v\n", err)
+			os.Exit(1)
+		}
+		for _, r := range reports {
+			stepSummary(r)
+		}
+
+		for _, err := range errs {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		if len(errs) > 0 {
+			os.Exit(1)
+		}
+		exitIfStagesFailed(reports...)
+		exitIfChecksumMismatch(reports...)
+		exitIfSignatureFailed(reports...)
+		exitIfRuntimeDrifted(reports...)
+		exitIfCheckFailed(cfg.FailOnCheck, reports...)
+		exitIfUnhealthy(cfg.FailOn, reports...)
+		exitIfDrifted(reports...)
+		exitIfIncomplete(reports...)
+		return
+	}
+
+	// =========================================================================
+	// Wait for the pipeline
+	// Once settled, or running the awaited release, the pipeline is
+	// reported like any other run.
+	if cfg.Wait || command == cmdWaitFor {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		if command == cmdWaitFor {
+			err = waitForRelease(ctx, sess, cfg, os.Stderr)
+		} else {
+			err = waitForPipeline(ctx, sess, cfg, os.Stderr)
+		}
+		stop()
+		exitIfWaitFailed(err)
+	}
 
+	// =========================================================================
+	// Streaming output
+	// Stages are written as soon as they are resolved.
+	if cfg.Format == formatNDJSON && opts.Template == nil && !cfg.Quiet {
+		queriedAt := time.Now().UTC()
+		var stages []stageDetails
+		err := output(func(w io.Writer) error {
+			var err error
+			stages, err = streamNDJSON(w, sess, cfg)
+			return err
+		})
+		r := report{
+			Pipeline:  cfg.PipelineName,
+			Region:    cfg.Region,
+			QueriedAt: queriedAt,
+			Stages:    stages,
+			Summary:   summarize(stages),
+		}
+		if cfg.FailOnDrift {
+			r.Drift = detectDrift(stages, cfg.DriftField, cfg.DriftBehindOnly)
+		}
+		if stages != nil {
+			stepSummary(r)
 		}
-		meta, err := getMetadataFromRevision(sess, cfg, details.revisionId)
 		if err != nil {
-			fmt.Printf("get metadata from file revision: %v\n", err)
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		exitIfChecksumMismatch(r)
+		exitIfSignatureFailed(r)
+		exitIfRuntimeDrifted(r)
+		exitIfCheckFailed(cfg.FailOnCheck, r)
+		exitIfUnhealthy(cfg.FailOn, r)
+		exitIfDrifted(r)
+		exitIfIncomplete(r)
+		return
+	}
+
+	// =========================================================================
+	// Stage details
+	// Everything is resolved before anything is written so stdout never
+	// carries a partial document when one of the lookups fails.
+	if cfg.Watch {
+		runWatch(func() ([]report, []error) {
+			r, err := queryPipeline(sess, cfg)
+			if err != nil {
+				return nil, []error{err}
+			}
+			return []report{r}, nil
+		}, func(w io.Writer, opts renderOptions, reports []report) error {
+			for _, r := range reports {
+				if err := render(w, cfg.Format, opts, r); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		return
+	}
+
+	r, err := queryPipeline(sess, cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	opts = reportColumns(opts, r)
+
+	write := func(w io.Writer) error {
+		if err := render(w, cfg.Format, opts, r); err != nil {
+			return err
+		}
+		return incompleteReport(nil, r)
+	}
+
+	if cfg.Quiet {
+		// getStageDetails guarantees the requested stage is the only one
+		if err := r.Stages[0].Error; err != "" {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		v := quietField.Value(r, r.Stages[0])
+		if v == "" {
+			fmt.Fprintf(os.Stderr, "stage %s has no %s\n", cfg.Stage, quietField.Name)
 			os.Exit(1)
 		}
+		write = func(w io.Writer) error {
+			_, err := fmt.Fprintln(w, v)
+			return err
+		}
+	}
+
+	if err := output(write); err != nil && !isIncomplete(err) {
+		fmt.Fprintf(os.Stderr, "writing output: %v\n", err)
+		os.Exit(1)
+	}
+	stepSummary(r)
+	exitIfStagesFailed(r)
+	exitIfChecksumMismatch(r)
+	exitIfSignatureFailed(r)
+	exitIfRuntimeDrifted(r)
+	exitIfCheckFailed(cfg.FailOnCheck, r)
+	exitIfUnhealthy(cfg.FailOn, r)
+	exitIfDrifted(r)
+	exitIfIncomplete(r)
+}
 
-		details.versionDeployed = *meta["Release"]
-		details.commit = *meta["Commit"]
-		details.releaseUrl = *meta["Release-Url"]
+// metadataCache remembers the metadata of every artifact version looked up.
+// Object versions are immutable, so entries never go stale and --watch only
+// pays for the revisions it hasn't seen yet.
+var metadataCache = struct {
+	sync.Mutex
+	m map[string]*cachedMetadata
+}{m: make(map[string]*cachedMetadata)}
 
-		fmt.Fprintf(w, "%s\t%s\t%s\t\t%s\t\t%s\n", details.name, details.status, details.versionDeployed, details.releaseUrl, details.executionId)
+// cachedMetadata is the metadata of an artifact version, where it was read
+// from and when the version was uploaded. done is closed once they are
+// known; stages of concurrently queried pipelines asking for the same
+// version wait for the first lookup rather than making their own.
+type cachedMetadata struct {
+	meta     map[string]*string
+	source   string
+	uploaded *time.Time
+	err      error
+	done     chan struct{}
+}
+
+// getMetadataFromRevision returns the version metadata of the artifact
+// version ver, where it was read from, see versionFromMetadata, and when
+// the version was uploaded. Every version is only looked up once; failed
+// lookups and those of the current object of unversioned buckets are
+// repeated.
+func getMetadataFromRevision(s *session.Session, cfg Cfg, ver string) (map[string]*string, string, *time.Time, error) {
+	cacheKey := cfg.Bucket + "/" + cfg.Key + "?versionId=" + ver
+	metadataCache.Lock()
+	cached, ok := metadataCache.m[cacheKey]
+	if !ok {
+		cached = &cachedMetadata{done: make(chan struct{})}
+		metadataCache.m[cacheKey] = cached
+	}
+	metadataCache.Unlock()
+	if ok {
+		<-cached.done
+		return cached.meta, cached.source, cached.uploaded, cached.err
 	}
+
+	var current bool
+	cached.meta, cached.source, cached.uploaded, current, cached.err = readMetadata(s, cfg, ver)
+	if cached.err != nil || current {
+		metadataCache.Lock()
+		delete(metadataCache.m, cacheKey)
+		metadataCache.Unlock()
+	}
+	close(cached.done)
+
+	return cached.meta, cached.source, cached.uploaded, cached.err
 }
 
-func getMetadataFromRevision(s *session.Session, cfg Cfg, ver string) (map[string]*string, error) {
+// readMetadata reads the version metadata of the artifact version ver and
+// when it was uploaded. Objects without version metadata fall back to their
+// tags and, with --inspect-archive, to the version file in the archive.
+// current is set when the metadata is that of the current object, in
+// buckets without versioning.
+func readMetadata(s *session.Session, cfg Cfg, ver string) (meta map[string]*string, source string, uploaded *time.Time, current bool, err error) {
 	// =========================================================================
 	// S3 client
-	svc := s3.New(s)
+	// The bucket may live in another region than the pipeline.
+	svc, err := s3Client(s, cfg)
+	if err != nil {
+		return make(map[string]*string), "", nil, false, err
+	}
+
+	if cfg.Verbose {
+		fmt.Fprintf(os.Stderr, "reading the metadata of s3://%s/%s version %s\n", cfg.Bucket, cfg.Key, ver)
+	}
+
+	// buckets without versioning track the ETag instead, only the current
+	// object can be read and it may have been replaced since
+	if isETag(ver) {
+		meta, uploaded, err := getCurrentMetadata(svc, cfg, ver)
+		return meta, versionFromMetadata, uploaded, true, err
+	}
 
 	input := &s3.HeadObjectInput{
 		Bucket:    aws.String(cfg.Bucket),
 		Key:       aws.String(cfg.Key),
 		VersionId: aws.String(ver),
 	}
+	withSSECustomerKey(cfg, &input.SSECustomerAlgorithm, &input.SSECustomerKey)
 
 	result, err := svc.HeadObject(input)
 	if err != nil {
+		if isVersioningError(err) {
+			meta, uploaded, err := getCurrentMetadata(svc, cfg, ver)
+			return meta, versionFromMetadata, uploaded, true, err
+		}
+		if isDeletedVersion(err) {
+			if err := deletedVersionError(svc, cfg, ver); err != nil {
+				return make(map[string]*string), "", nil, false, err
+			}
+		}
+		if err := encryptionError(svc, cfg, err, ""); err != nil {
+			return make(map[string]*string), "", nil, false, err
+		}
 		if aerr, ok := err.(awserr.Error); ok {
 			switch aerr.Code() {
+			case "NotFound", "NoSuchKey", "NoSuchBucket":
+				return make(map[string]*string), "", nil, false, fmt.Errorf("version %s of s3://%s/%s not found, check --bucket and --key", ver, cfg.Bucket, cfg.Key)
 			default:
-				return make(map[string]*string), fmt.Errorf("failed to retrieve version metadata: %s", aerr.Message())
+				return make(map[string]*string), "", nil, false, fmt.Errorf("failed to retrieve version metadata: %s", aerr.Message())
 			}
 		} else {
-			return make(map[string]*string), err
+			return make(map[string]*string), "", nil, false, err
 		}
 
 	}
-	return result.Metadata, nil
+
+	meta, source = result.Metadata, versionFromMetadata
+	// some builds tag the object instead
+	if lacksVersion(cfg, meta) {
+		tags, err := getTagMetadata(svc, cfg, ver)
+		if err != nil {
+			return make(map[string]*string), "", nil, false, err
+		}
+		if !lacksVersion(cfg, tags) {
+			meta, source = tags, versionFromTags
+		}
+	}
+	// older artifacts carry their version in a file of the archive instead
+	if cfg.InspectArchive && lacksVersion(cfg, meta) {
+		if meta, err = readArchiveMetadata(svc, cfg, ver, result); err != nil {
+			return make(map[string]*string), "", nil, false, err
+		}
+		source = versionFromArchive
+	}
+
+	return meta, source, result.LastModified, false, nil
 }
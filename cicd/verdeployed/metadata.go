@@ -0,0 +1,45 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// metadataValues copies the metadata of an artifact version as is.
+func metadataValues(meta map[string]*string) map[string]string {
+	if len(meta) == 0 {
+		return nil
+	}
+	values := make(map[string]string, len(meta))
+	for k, v := range meta {
+		values[k] = aws.StringValue(v)
+	}
+	return values
+}
+
+// hasMetadata reports whether any of the stages carries artifact metadata.
+func hasMetadata(stages []stageDetails) bool {
+	for _, details := range stages {
+		if len(details.Metadata) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// metadataLines renders the artifact metadata of a stage below its row, a
+// line per key in order, e.g. "    · BuildNumber: 1234".
+func metadataLines(details stageDetails) []string {
+	keys := make([]string, 0, len(details.Metadata))
+	for k := range details.Metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	lines := make([]string, len(keys))
+	for i, k := range keys {
+		lines[i] = "    · " + k + ": " + details.Metadata[k]
+	}
+	return lines
+}
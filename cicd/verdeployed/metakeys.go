@@ -0,0 +1,53 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// Built in metadata keys, the object tags and the version file in the
+// archive are read into.
+const (
+	builtinVersionKey = "Release"
+	builtinCommitKey  = "Commit"
+)
+
+// versionKeys returns the metadata keys tried in order for the version.
+func versionKeys(cfg Cfg) []string {
+	return metadataKeys(cfg.VersionKey, builtinVersionKey)
+}
+
+// commitKeys returns the metadata keys tried in order for the commit, none
+// if the commit key is unset.
+func commitKeys(cfg Cfg) []string {
+	return metadataKeys(cfg.CommitKey, builtinCommitKey)
+}
+
+// metadataKeys returns the comma separated keys of spec followed by the
+// built in one, unless spec is empty.
+func metadataKeys(spec, builtin string) []string {
+	keys := parseNames(spec)
+	if len(keys) == 0 {
+		return nil
+	}
+	for _, key := range keys {
+		if strings.EqualFold(key, builtin) {
+			return keys
+		}
+	}
+	return append(keys, builtin)
+}
+
+// metaValue returns the value of the first of keys set in meta. Keys match
+// case-insensitively, S3 canonicalizes the casing of metadata headers.
+func metaValue(meta map[string]*string, keys []string) string {
+	for _, key := range keys {
+		for k, v := range meta {
+			if strings.EqualFold(k, key) && aws.StringValue(v) != "" {
+				return aws.StringValue(v)
+			}
+		}
+	}
+	return ""
+}
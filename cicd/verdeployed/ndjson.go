@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// errStagesFailed is returned by streamNDJSON when some of the stages could
+// not be resolved; their records carry the details.
+var errStagesFailed = errors.New("some stages could not be resolved")
+
+// ndjsonRecord is a single line of ndjson output. Stage lookup failures are
+// reported through the error field of the embedded stage.
+type ndjsonRecord struct {
+	Pipeline string `json:"pipeline"`
+	stageDetails
+	EmittedAt time.Time `json:"emittedAt"`
+}
+
+// ndjsonError reports a failure affecting the whole pipeline.
+type ndjsonError struct {
+	Pipeline  string    `json:"pipeline"`
+	Error     string    `json:"error"`
+	EmittedAt time.Time `json:"emittedAt"`
+}
+
+// renderNDJSON prints already resolved reports, one stage per line.
+func renderNDJSON(w io.Writer, reports ...report) error {
+	enc := json.NewEncoder(w)
+	for _, r := range reports {
+		for _, details := range r.Stages {
+			if err := enc.Encode(ndjsonRecord{Pipeline: r.Pipeline, stageDetails: details, EmittedAt: time.Now().UTC()}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// streamNDJSON resolves the pipeline stages writing each one to w as soon as
+// it is known, so consumers like jq or tail -f see them in real time.
+// Writes to w are not buffered. The resolved stages are returned as well.
+func streamNDJSON(w io.Writer, sess *session.Session, cfg Cfg) ([]stageDetails, error) {
+	enc := json.NewEncoder(w)
+
+	var failed bool
+	var encErr error
+	stages, _, err := getStageDetails(sess, cfg, func(details stageDetails) {
+		if details.Error != "" {
+			failed = true
+		}
+		if encErr == nil {
+			encErr = enc.Encode(ndjsonRecord{Pipeline: cfg.PipelineName, stageDetails: details, EmittedAt: time.Now().UTC()})
+		}
+	})
+	if err != nil {
+		enc.Encode(ndjsonError{Pipeline: cfg.PipelineName, Error: err.Error(), EmittedAt: time.Now().UTC()})
+		return nil, err
+	}
+	if encErr != nil {
+		return stages, encErr
+	}
+	if failed {
+		return stages, errStagesFailed
+	}
+
+	return stages, nil
+}
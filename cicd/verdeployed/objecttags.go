@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// Where the version of an S3 artifact was read from.
+const (
+	versionFromMetadata = "meta"
+	versionFromTags     = "tag"
+	versionFromArchive  = "archive"
+)
+
+// tagKeys maps the object tags read as version metadata, matched
+// case-insensitively, to the built in metadata keys they stand in for.
+var tagKeys = map[string]string{
+	"version":     builtinVersionKey,
+	"release":     builtinVersionKey,
+	"commit":      builtinCommitKey,
+	"release-url": "Release-Url",
+	"branch":      "Branch",
+}
+
+// getTagMetadata reads the version from the tags of the artifact version
+// ver. Tags are returned under their own key, to match configured keys,
+// the well known ones also under the built in metadata keys. Callers
+// lacking the permission to read tags are warned once per bucket and get
+// no tags.
+func getTagMetadata(svc s3iface.S3API, cfg Cfg, ver string) (map[string]*string, error) {
+	out, err := svc.GetObjectTagging(&s3.GetObjectTaggingInput{
+		Bucket:    aws.String(cfg.Bucket),
+		Key:       aws.String(cfg.Key),
+		VersionId: aws.String(ver),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			switch aerr.Code() {
+			case "AccessDenied":
+				warnTagsDenied(cfg.Bucket)
+				return make(map[string]*string), nil
+			default:
+				return make(map[string]*string), fmt.Errorf("failed to retrieve version tags: %s", aerr.Message())
+			}
+		}
+		return make(map[string]*string), err
+	}
+
+	meta := make(map[string]*string)
+	for _, tag := range out.TagSet {
+		meta[aws.StringValue(tag.Key)] = tag.Value
+	}
+	for _, tag := range out.TagSet {
+		key, ok := tagKeys[strings.ToLower(aws.StringValue(tag.Key))]
+		if !ok {
+			continue
+		}
+		if _, set := meta[key]; !set {
+			meta[key] = tag.Value
+		}
+	}
+	return meta, nil
+}
+
+// tagsDenied remembers the buckets warned about, once is enough.
+var tagsDenied sync.Map
+
+// warnTagsDenied tells the tags of bucket can't be read, once per bucket.
+func warnTagsDenied(bucket string) {
+	if _, warned := tagsDenied.LoadOrStore(bucket, true); warned {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "warning: not allowed to read the object tags in bucket %s, grant s3:GetObjectVersionTagging to read the version from them\n", bucket)
+}
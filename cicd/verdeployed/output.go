@@ -0,0 +1,716 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/codepipeline"
+	"gopkg.in/yaml.v3"
+)
+
+// Supported values of the Format config option.
+const (
+	formatTable    = "table"
+	formatJSON     = "json"
+	formatYAML     = "yaml"
+	formatCSV      = "csv"
+	formatTSV      = "tsv"
+	formatMarkdown = "markdown"
+	formatHTML     = "html"
+	formatProm     = "prom"
+	formatJUnit    = "junit"
+	formatNDJSON   = "ndjson"
+	formatMermaid  = "mermaid"
+	formatDot      = "dot"
+)
+
+// renderOptions carries the config values that tweak how a format is
+// rendered.
+type renderOptions struct {
+	NoHeader          bool
+	CommitURLTemplate string
+	Color             bool
+
+	// Plain replaces the aligned table with tab delimited rows, used when
+	// stdout is not a terminal.
+	Plain bool
+
+	// Columns selects the columns of the tabular formats, nil keeps the
+	// default set of each format.
+	Columns []column
+	// Wide switches the default table columns to the extended set.
+	Wide bool
+	// FullSHA disables abbreviating commits in the human readable formats.
+	FullSHA bool
+	// Times controls how timestamps are shown in the human readable
+	// formats.
+	Times timeFormat
+	// NoSummary suppresses the summary line printed after the table, or to
+	// stderr after the plain rows.
+	NoSummary bool
+	// Hyperlinks turns stage names and execution ids in the table into
+	// links to the AWS console.
+	Hyperlinks bool
+	// Links adds the console URL of every execution as a table column,
+	// for terminals without hyperlink support.
+	Links bool
+	// Durations adds the duration column to the default columns.
+	Durations bool
+	// DeployedAt adds the deployedAt column to the default columns.
+	DeployedAt bool
+	// DeployedFor adds the deployedFor and built columns to the default
+	// columns.
+	DeployedFor bool
+	// Behind adds the behind column to the default columns.
+	Behind bool
+	// Actions adds a row per action below every stage of the table.
+	Actions bool
+	// ShowErrors prints the errors of failed actions below their row of
+	// the aligned table.
+	ShowErrors bool
+	// ShowTargets adds the target column to the default columns.
+	ShowTargets bool
+	// ShowBuild adds the build column to the default columns.
+	ShowBuild bool
+	// VerifySignature adds the signature column to the default columns.
+	VerifySignature bool
+	// VerifyRuntime adds the runtime column to the default columns.
+	VerifyRuntime bool
+	// Live adds the live column to the default columns.
+	Live bool
+	// Parameter adds the parameter column to the default columns.
+	Parameter bool
+	// ShowLinks prints the external execution links of the actions below
+	// their row of the aligned table.
+	ShowLinks bool
+	// ShowMetadata prints the artifact metadata of every stage below it.
+	ShowMetadata bool
+	// Variables names the pipeline variables added as columns to the
+	// tabular formats.
+	Variables []string
+	// Artifacts names the source artifacts added as columns to the tabular
+	// formats, set for pipelines with several sources.
+	Artifacts []string
+	// Changed holds the stageKey of the stages whose status changed since
+	// the previous refresh of --watch, highlighted in color mode.
+	Changed map[string]bool
+	// Pipelines prefixes the default table columns with the pipeline
+	// name, set when more than one pipeline is reported.
+	Pipelines bool
+
+	// Template, when set, replaces the selected format altogether.
+	Template *template.Template
+}
+
+// columns returns the selected columns or the given format default.
+func (o renderOptions) columnsOr(defaults []string) []column {
+	if o.Columns != nil {
+		return o.Columns
+	}
+	return mustColumns(defaults)
+}
+
+// withExtraColumns appends the columns asked for by flags to cols, those
+// of the optional lookups first, then one per artifact and variable.
+func (o renderOptions) withExtraColumns(cols []column) []column {
+	cols = o.withDuration(cols)
+	cols = o.withDeployedAt(cols)
+	cols = o.withDeployedFor(cols)
+	cols = o.withBehind(cols)
+	cols = o.withTargets(cols)
+	cols = o.withBuild(cols)
+	cols = o.withSignature(cols)
+	cols = o.withRuntime(cols)
+	cols = o.withLive(cols)
+	cols = o.withParameter(cols)
+	cols = o.withArtifacts(cols)
+	return o.withVariables(cols)
+}
+
+// tableColumns returns the columns of the table and tsv formats.
+func (o renderOptions) tableColumns() []column {
+	defaults := defaultTableColumns
+	switch {
+	case o.Wide:
+		defaults = wideTableColumns
+	case o.Actions:
+		defaults = actionTableColumns
+	}
+	if o.Pipelines {
+		defaults = append([]string{"pipeline"}, defaults...)
+	}
+	cols := o.withExtraColumns(o.columnsOr(defaults))
+
+	if o.Links {
+		url, _ := lookupColumn("executionUrl")
+		cols = append(cols[:len(cols):len(cols)], url)
+	}
+
+	return cols
+}
+
+// report is the complete result of a single verdeployed run. It is also the
+// value user supplied templates are executed against, so its exported
+// fields are part of the documented template interface.
+type report struct {
+	// Pipeline is the name of the queried pipeline.
+	Pipeline string `json:"pipeline" yaml:"pipeline"`
+	// Region is the AWS region the pipeline lives in.
+	Region string `json:"region" yaml:"region"`
+	// ExecutionMode is SUPERSEDED, QUEUED or PARALLEL. In the latter two
+	// the stages may show different executions running at the same time.
+	ExecutionMode string `json:"executionMode,omitempty" yaml:"executionMode,omitempty"`
+	// QueriedAt is the time the pipeline state was requested.
+	QueriedAt time.Time `json:"queriedAt" yaml:"queriedAt"`
+	// Stages lists the pipeline stages in pipeline order.
+	Stages []stageDetails `json:"stages" yaml:"stages"`
+	// Summary rolls up the state of Stages.
+	Summary summary `json:"summary" yaml:"summary"`
+	// Drift is the verdict of --fail-on-drift, only set when asked for.
+	Drift *drift `json:"drift,omitempty" yaml:"drift,omitempty"`
+	// Groups is set when stages are grouped by version.
+	Groups []versionGroup `json:"groups,omitempty" yaml:"groups,omitempty"`
+}
+
+// validFormat reports whether f names a supported output format.
+func validFormat(f string) bool {
+	switch f {
+	case formatTable, formatJSON, formatYAML, formatCSV, formatTSV, formatMarkdown, formatHTML, formatProm, formatJUnit, formatNDJSON, formatMermaid, formatDot:
+		return true
+	}
+	return false
+}
+
+// render writes the report to w in the requested format.
+func render(w io.Writer, format string, opts renderOptions, r report) error {
+	if opts.Template != nil {
+		return renderTemplate(w, opts.Template, r)
+	}
+
+	switch format {
+	case formatJSON:
+		return renderJSON(w, r)
+	case formatYAML:
+		return renderYAML(w, r)
+	case formatCSV:
+		return renderCSV(w, opts, r)
+	case formatTSV:
+		return renderTSV(w, opts, r)
+	case formatMarkdown:
+		return renderMarkdown(w, opts, r.Stages)
+	case formatHTML:
+		return renderHTML(w, opts, r)
+	case formatProm:
+		return renderProm(w, r)
+	case formatJUnit:
+		return renderJUnit(w, r)
+	case formatNDJSON:
+		return renderNDJSON(w, r)
+	case formatMermaid:
+		return renderMermaid(w, opts, r)
+	case formatDot:
+		return renderDot(w, opts, r)
+	default:
+		if r.Groups != nil {
+			return renderGroupTable(w, opts, r.Groups)
+		}
+		return renderTable(w, opts, r)
+	}
+}
+
+// renderTable prints stages as an aligned, human readable table.
+func renderTable(out io.Writer, opts renderOptions, r report) error {
+	if opts.Plain {
+		if err := renderTSV(out, opts, r); err != nil {
+			return err
+		}
+		// keep the rows parseable, the summary goes to stderr
+		if !opts.NoSummary {
+			fmt.Fprintf(os.Stderr, "%s\n", r.Summary)
+		}
+		return nil
+	}
+
+	cols := opts.tableColumns()
+
+	// every row belongs to a stage, action rows also to one of its actions
+	var rows [][]string
+	var rowStages []stageDetails
+	var rowActions []*actionDetails
+
+	for _, details := range r.Stages {
+		cells := make([]string, len(cols))
+		for i, c := range cols {
+			cells[i] = c.Value(r, details)
+			if c.Display != nil {
+				cells[i] = c.Display(opts, r, details)
+			}
+		}
+		rows = append(rows, cells)
+		rowStages = append(rowStages, details)
+		rowActions = append(rowActions, nil)
+
+		if !opts.Actions {
+			continue
+		}
+		for i := range details.Actions {
+			rows = append(rows, actionCells(cols, opts, r, details.Actions[i], true))
+			rowStages = append(rowStages, details)
+			rowActions = append(rowActions, &details.Actions[i])
+		}
+	}
+
+	for _, cells := range rows {
+		for i := range cells {
+			// an embedded tab or newline would wreck the alignment
+			cells[i] = tsvEscaper.Replace(cells[i])
+		}
+	}
+
+	var buf bytes.Buffer
+
+	// initialize tabwriter
+	w := new(tabwriter.Writer)
+	// minwidth, tabwidth, padding, padchar, flags
+	// padding keeps cells filling a whole tab stop apart from the next one
+	w.Init(&buf, 8, 8, 1, '\t', 0)
+
+	writeRow := func(cells []string) {
+		for i, c := range cols {
+			sep := "\t"
+			if c.Wide {
+				sep = "\t\t"
+			}
+			if i == len(cols)-1 {
+				sep = "\n"
+			}
+			io.WriteString(w, cells[i]+sep)
+		}
+	}
+
+	titles := make([]string, len(cols))
+	rulers := make([]string, len(cols))
+	for i, c := range cols {
+		titles[i] = c.Title
+		rulers[i] = "----"
+	}
+	writeRow(titles)
+	writeRow(rulers)
+
+	for _, cells := range rows {
+		writeRow(cells)
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	// notes returns the lines printed below a row: the disabled transition
+	// into its stage, why it failed or stopped, the executions queued for
+	// it, the external links and errors of its stage or, when actions are
+	// listed, of its action, and why the stage couldn't be looked up or its
+	// artifact failed the checksum
+	var notes func(row int) []string
+	if opts.ShowErrors || hasLookupErrors(r.Stages) || hasChecksumMismatch(r.Stages) || opts.ShowLinks && hasLinks(r.Stages) || opts.ShowMetadata && hasMetadata(r.Stages) || hasInbound(r.Stages) || hasDisabledTransition(r.Stages) || hasStatusReasons(r.Stages) {
+		width := terminalWidth()
+		notes = func(row int) []string {
+			var lines []string
+			if details := rowStages[row]; details.Error != "" && rowActions[row] == nil {
+				line := "    ✗ " + details.Error
+				if opts.Color {
+					line = ansiRed + line + ansiReset
+				}
+				lines = append(lines, line)
+			}
+			if details := rowStages[row]; details.Checksum != nil && details.Checksum.Status == checksumMismatch && rowActions[row] == nil {
+				line := checksumLine(details.Checksum)
+				if opts.Color {
+					line = ansiRed + line + ansiReset
+				}
+				lines = append(lines, line)
+			}
+			if details := rowStages[row]; details.TransitionDisabled && rowActions[row] == nil {
+				line := "    ⏸ " + transitionSummary(details)
+				if opts.Color {
+					line = ansiYellow + line + ansiReset
+				}
+				lines = append(lines, line)
+			}
+			if rowActions[row] == nil {
+				for _, line := range reasonLines(rowStages[row], width) {
+					if opts.Color {
+						line = statusColor(rowStages[row].Status, true) + line + ansiReset
+					}
+					lines = append(lines, line)
+				}
+			}
+			if in := rowStages[row].Inbound; len(in) > 0 && rowActions[row] == nil {
+				line := "    ⇢ " + inboundSummary(in)
+				if opts.Color {
+					line = ansiYellow + line + ansiReset
+				}
+				lines = append(lines, line)
+			}
+			if opts.ShowMetadata && rowActions[row] == nil {
+				lines = append(lines, metadataLines(rowStages[row])...)
+			}
+			if opts.ShowLinks {
+				for _, l := range rowStages[row].Links {
+					if action := rowActions[row]; opts.Actions && (action == nil || action.Name != l.Action) {
+						continue
+					}
+					lines = append(lines, linkLine(l, opts.Hyperlinks))
+				}
+			}
+
+			if !opts.ShowErrors {
+				return lines
+			}
+			var errs []stageError
+			switch action := rowActions[row]; {
+			case !opts.Actions:
+				errs = rowStages[row].Errors
+			case action != nil:
+				for _, e := range rowStages[row].Errors {
+					if e.Action == action.Name {
+						errs = append(errs, e)
+					}
+				}
+			}
+			for _, line := range errorLines(errs, width) {
+				if opts.Color {
+					line = ansiRed + line + ansiReset
+				}
+				lines = append(lines, line)
+			}
+			return lines
+		}
+	}
+
+	var decorate func(row, col int, cell string) string
+	if opts.Color || opts.Hyperlinks {
+		decorate = func(row, col int, cell string) string {
+			details, action := rowStages[row], rowActions[row]
+			switch cols[col].Name {
+			case "status":
+				color := statusColor(details.Status, details.ExecutionID != "")
+				if action != nil {
+					color = statusColor(action.Status, action.Status != "")
+				}
+				if opts.Color && color != "" {
+					cell = color + cell + ansiReset
+				}
+				if opts.Color && action == nil && opts.Changed[stageKey(r.Pipeline, details.Name)] {
+					cell = ansiReverse + cell + ansiReset
+				}
+			case "stage":
+				if opts.Hyperlinks && action == nil {
+					cell = hyperlink(pipelineConsoleURL(r.Region, r.Pipeline), cell)
+				}
+			case "executionId":
+				switch {
+				case !opts.Hyperlinks:
+				case action != nil && action.ExternalExecutionURL != "":
+					cell = hyperlink(action.ExternalExecutionURL, cell)
+				case action == nil && details.ExecutionID != "":
+					cell = hyperlink(executionConsoleURL(r.Region, r.Pipeline, details.ExecutionID), cell)
+				}
+			}
+			return cell
+		}
+	}
+
+	// stages of a concurrent pipeline don't share an execution, say so
+	// before anyone reads the table as a single rollout
+	if r.ExecutionMode != "" && r.ExecutionMode != codepipeline.ExecutionModeSuperseded {
+		if _, err := fmt.Fprintf(out, "Execution mode: %s\n\n", r.ExecutionMode); err != nil {
+			return err
+		}
+	}
+
+	if banner := staleBanner(r.Stages); banner != "" {
+		if opts.Color {
+			banner = ansiYellow + banner + ansiReset
+		}
+		if _, err := fmt.Fprintf(out, "%s\n", banner); err != nil {
+			return err
+		}
+	}
+
+	if decorate != nil || notes != nil {
+		if err := decorateTable(out, &buf, rows, decorate, notes); err != nil {
+			return err
+		}
+	} else if _, err := buf.WriteTo(out); err != nil {
+		return err
+	}
+
+	if !opts.NoSummary {
+		if _, err := fmt.Fprintf(out, "\n%s\n", r.Summary); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// tableRows extracts the cell values of every stage.
+func tableRows(cols []column, r report) [][]string {
+	rows := make([][]string, len(r.Stages))
+	for i, details := range r.Stages {
+		rows[i] = make([]string, len(cols))
+		for j, c := range cols {
+			rows[i][j] = c.Value(r, details)
+		}
+	}
+	return rows
+}
+
+// decorateTable copies an aligned table from r to w, passing every non-empty
+// cell of the stage rows through decorate and printing the lines returned by
+// notes below them. Either may be nil. Decorations, like colors, are
+// applied after tabwriter did its job, escape sequences would otherwise
+// count towards the column widths.
+func decorateTable(w io.Writer, r io.Reader, rows [][]string, decorate func(row, col int, cell string) string, notes func(row int) []string) error {
+	const headerRows = 2
+
+	sc := bufio.NewScanner(r)
+	for n := 0; sc.Scan(); n++ {
+		line := sc.Text()
+
+		i := n - headerRows
+		isRow := i >= 0 && i < len(rows)
+		if isRow && decorate != nil {
+			line = decorateRow(line, rows[i], func(col int, cell string) string {
+				return decorate(i, col, cell)
+			})
+		}
+
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+
+		if isRow && notes != nil {
+			for _, note := range notes(i) {
+				if _, err := fmt.Fprintln(w, note); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return sc.Err()
+}
+
+// decorateRow walks the known cell values of an aligned table row, the
+// padding between them is made of tabs only. The row is returned unchanged
+// if it doesn't match the cells.
+func decorateRow(line string, cells []string, decorate func(col int, cell string) string) string {
+	var b strings.Builder
+
+	pos := 0
+	for col, cell := range cells {
+		if !strings.HasPrefix(line[pos:], cell) {
+			return line
+		}
+		if cell != "" {
+			b.WriteString(decorate(col, cell))
+		}
+		pos += len(cell)
+
+		for pos < len(line) && line[pos] == '\t' {
+			b.WriteByte('\t')
+			pos++
+		}
+	}
+	b.WriteString(line[pos:])
+
+	return b.String()
+}
+
+// renderJSON prints the whole report as a single JSON object, the stages
+// under "stages".
+func renderJSON(w io.Writer, r report) error {
+	// Never emit null for an empty pipeline, consumers iterate the stages.
+	if r.Stages == nil {
+		r.Stages = []stageDetails{}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// renderJSONArray prints the reports of several pipelines as a single JSON
+// array.
+func renderJSONArray(w io.Writer, reports []report) error {
+	if reports == nil {
+		reports = []report{}
+	}
+	for i := range reports {
+		if reports[i].Stages == nil {
+			reports[i].Stages = []stageDetails{}
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(reports)
+}
+
+// renderYAML prints the whole report, including the pipeline header, as a
+// single YAML document.
+func renderYAML(w io.Writer, r report) error {
+	if r.Stages == nil {
+		r.Stages = []stageDetails{}
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(r); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// renderCSV prints one record per stage, preceded by a header row unless
+// opts.NoHeader is set so results can be appended to an existing file.
+func renderCSV(w io.Writer, opts renderOptions, r report) error {
+	cols := opts.withExtraColumns(opts.columnsOr(defaultCSVColumns))
+	cw := csv.NewWriter(w)
+
+	if !opts.NoHeader {
+		names := make([]string, len(cols))
+		for i, c := range cols {
+			names[i] = c.Name
+		}
+		cw.Write(names)
+	}
+
+	for _, cells := range tableRows(cols, r) {
+		cw.Write(cells)
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// tsvEscaper escapes the characters that would otherwise break a
+// tab-separated record.
+var tsvEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+
+// renderTSV prints the table columns separated by exactly one tab, without
+// any alignment padding, so the output can be parsed with cut or awk.
+func renderTSV(w io.Writer, opts renderOptions, r report) error {
+	cols := opts.tableColumns()
+
+	writeRow := func(fields []string) error {
+		for i, f := range fields {
+			fields[i] = tsvEscaper.Replace(f)
+		}
+		_, err := io.WriteString(w, strings.Join(fields, "\t")+"\n")
+		return err
+	}
+
+	if !opts.NoHeader {
+		titles := make([]string, len(cols))
+		for i, c := range cols {
+			titles[i] = c.Title
+		}
+		if err := writeRow(titles); err != nil {
+			return err
+		}
+	}
+
+	for i, cells := range tableRows(cols, r) {
+		if err := writeRow(cells); err != nil {
+			return err
+		}
+		if !opts.Actions {
+			continue
+		}
+		for _, action := range r.Stages[i].Actions {
+			if err := writeRow(actionCells(cols, opts, r, action, false)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// shortCommitLen is the number of characters a commit is abbreviated to.
+const shortCommitLen = 8
+
+// shaRe matches values that look like an abbreviated or full git SHA.
+var shaRe = regexp.MustCompile(`^[0-9a-fA-F]{7,64}$`)
+
+// shortCommit abbreviates a commit SHA for display. Values that are not a
+// hex SHA, e.g. tag names stored by older artifacts, are returned as is
+// rather than being cut mid-word.
+func shortCommit(c string) string {
+	if len(c) <= shortCommitLen || !shaRe.MatchString(c) {
+		return c
+	}
+	return c[:shortCommitLen]
+}
+
+// displayCommit returns the commit as shown by the human readable formats.
+func (o renderOptions) displayCommit(c string) string {
+	if o.FullSHA {
+		return c
+	}
+	return shortCommit(c)
+}
+
+// commitURL expands the configured commit URL template for commit. It
+// returns an empty string when there is nothing to link to.
+func commitURL(tmpl, commit string) string {
+	if tmpl == "" || commit == "" {
+		return ""
+	}
+	return strings.ReplaceAll(tmpl, "{commit}", commit)
+}
+
+// mdEscaper escapes the characters that would break a Markdown table cell.
+var mdEscaper = strings.NewReplacer("|", `\|`, "\r", "", "\n", " ")
+
+// renderMarkdown prints stages as a GitHub flavored Markdown table, ready to
+// be pasted into a pull request comment.
+func renderMarkdown(w io.Writer, opts renderOptions, stages []stageDetails) error {
+	// placeholder keeps empty cells visible, an empty cell reads as a glitch
+	const placeholder = "–"
+
+	cell := func(v string) string {
+		if v == "" {
+			return placeholder
+		}
+		return mdEscaper.Replace(v)
+	}
+
+	fmt.Fprintln(w, "| Stage | Status | Version | Commit |")
+	fmt.Fprintln(w, "| --- | --- | --- | --- |")
+
+	for _, details := range stages {
+		commit := cell(opts.displayCommit(details.Commit))
+		if url := commitURL(opts.CommitURLTemplate, details.Commit); url != "" {
+			commit = fmt.Sprintf("[`%s`](%s)", mdEscaper.Replace(opts.displayCommit(details.Commit)), url)
+		}
+
+		if _, err := fmt.Fprintf(w, "| %s | %s | %s | %s |\n", cell(details.Name), cell(details.displayStatus()), cell(details.Version), commit); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestRenderYAMLRoundTrip(t *testing.T) {
+	changed := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+	want := report{
+		Pipeline:      "app",
+		Region:        "eu-west-1",
+		ExecutionMode: "SUPERSEDED",
+		QueriedAt:     time.Date(2024, 3, 1, 13, 0, 0, 0, time.UTC),
+		Stages: []stageDetails{
+			{
+				Name:             "Source",
+				Status:           "Succeeded",
+				ExecutionID:      "exec-2",
+				RevisionID:       "v2",
+				Version:          "1.5.0",
+				Commit:           "3f1c2a9",
+				Branch:           "main",
+				LastStatusChange: &changed,
+			},
+			{
+				Name:        "Prod",
+				Status:      "Failed",
+				ExecutionID: "exec-1",
+				RevisionID:  "v1",
+				Version:     "1.4.0",
+				Branch:      "main",
+				Metadata:    map[string]string{"release": "1.4.0"},
+			},
+			{Name: "Canary"},
+		},
+		Summary: summary{
+			Stages:    3,
+			Failed:    1,
+			Version:   "1.5.0",
+			OutOfSync: map[string]string{"Prod": "1.4.0"},
+		},
+		Drift: &drift{
+			Field:     driftFieldVersion,
+			Drifted:   true,
+			Expected:  "1.5.0",
+			Behind:    map[string]string{"Prod": "1.4.0"},
+			Positions: map[string]string{"Prod": positionBehind},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := renderYAML(&buf, want); err != nil {
+		t.Fatalf("renderYAML: %v", err)
+	}
+	if !strings.HasPrefix(buf.String(), "pipeline: app\n") {
+		t.Errorf("YAML doesn't start with the pipeline header:\n%s", buf.String())
+	}
+
+	var got report
+	if err := yaml.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("unmarshal: %v\n%s", err, buf.String())
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("round trip mismatch\ngot:  %+v\nwant: %+v\nYAML:\n%s", got, want, buf.String())
+	}
+}
+
+func TestRenderYAMLNoStages(t *testing.T) {
+	var buf bytes.Buffer
+	if err := renderYAML(&buf, report{Pipeline: "app"}); err != nil {
+		t.Fatalf("renderYAML: %v", err)
+	}
+
+	var got report
+	if err := yaml.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if got.Stages == nil || len(got.Stages) != 0 {
+		t.Errorf("stages = %#v, want an empty list\n%s", got.Stages, buf.String())
+	}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/codepipeline"
+)
+
+// pipelineError records why the report of a single pipeline is missing when
+// several pipelines are queried.
+type pipelineError struct {
+	Pipeline string
+	Err      error
+}
+
+func (e pipelineError) Error() string {
+	return fmt.Sprintf("pipeline %s: %v", e.Pipeline, e.Err)
+}
+
+func (e pipelineError) Unwrap() error {
+	return e.Err
+}
+
+// listPipelines returns the names of every pipeline in the session region.
+func listPipelines(sess *session.Session) ([]string, error) {
+	pipelnsvc := codepipeline.New(sess)
+
+	var names []string
+	err := pipelnsvc.ListPipelinesPages(&codepipeline.ListPipelinesInput{}, func(page *codepipeline.ListPipelinesOutput, _ bool) bool {
+		for _, p := range page.Pipelines {
+			names = append(names, *p.Name)
+		}
+		return true
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			switch aerr.Code() {
+			default:
+				return nil, fmt.Errorf("failed to list pipelines: %s", aerr.Message())
+			}
+		}
+		return nil, err
+	}
+
+	return names, nil
+}
+
+// queryPipeline resolves the report of the pipeline named in cfg.
+func queryPipeline(sess *session.Session, cfg Cfg) (report, error) {
+	queriedAt := time.Now().UTC()
+	stages, mode, err := getStageDetails(sess, cfg, nil)
+	if err != nil {
+		return report{}, err
+	}
+
+	r := report{
+		Pipeline:      cfg.PipelineName,
+		Region:        cfg.Region,
+		ExecutionMode: mode,
+		QueriedAt:     queriedAt,
+		Stages:        stages,
+		Summary:       summarize(stages),
+	}
+	if cfg.GroupBy == groupByVersion {
+		r.Groups = groupStagesByVersion(stages)
+	}
+	if cfg.FailOnDrift {
+		r.Drift = detectDrift(stages, cfg.DriftField, cfg.DriftBehindOnly)
+	}
+
+	return r, nil
+}
+
+// pipelineTarget names a pipeline to report and the location of its version
+// artifact.
+type pipelineTarget struct {
+	Name   string
+	Bucket string
+	Key    string
+}
+
+// parsePipelineNames parses a comma separated list of pipeline names. Each
+// name may be followed by =bucket or =bucket/key to override the artifact
+// location, e.g. api=bucket1/version.zip. bucket and key are the defaults.
+func parsePipelineNames(spec, bucket, key string) ([]pipelineTarget, error) {
+	var targets []pipelineTarget
+
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		t := pipelineTarget{Name: item, Bucket: bucket, Key: key}
+		if name, loc, ok := strings.Cut(item, "="); ok {
+			t.Name = name
+			t.Bucket = loc
+			if b, k, ok := strings.Cut(loc, "/"); ok {
+				t.Bucket, t.Key = b, k
+			}
+			if t.Name == "" || t.Bucket == "" || t.Key == "" {
+				return nil, fmt.Errorf("invalid pipeline %q, expected name=bucket/key", item)
+			}
+		}
+		targets = append(targets, t)
+	}
+
+	return targets, nil
+}
+
+// pipelineTargets turns plain pipeline names into targets sharing the
+// configured artifact location.
+func pipelineTargets(names []string, cfg Cfg) []pipelineTarget {
+	targets := make([]pipelineTarget, len(names))
+	for i, name := range names {
+		targets[i] = pipelineTarget{Name: name, Bucket: cfg.Bucket, Key: cfg.Key}
+	}
+	return targets
+}
+
+// queryPipelines resolves the reports of the target pipelines, running at
+// most concurrency queries at a time. Reports keep the order of targets. A
+// pipeline that fails doesn't stop the others, its error is returned
+// alongside the reports that could be resolved.
+func queryPipelines(sess *session.Session, cfg Cfg, targets []pipelineTarget, concurrency int) ([]report, []error) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	reports := make([]report, len(targets))
+	errs := make([]error, len(targets))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	for i, t := range targets {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, t pipelineTarget) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			pcfg := cfg
+			pcfg.PipelineName, pcfg.Bucket, pcfg.Key = t.Name, t.Bucket, t.Key
+			reports[i], errs[i] = queryPipeline(sess, pcfg)
+		}(i, t)
+	}
+	wg.Wait()
+
+	var resolved []report
+	var failed []error
+	for i, t := range targets {
+		if errs[i] != nil {
+			failed = append(failed, pipelineError{Pipeline: t.Name, Err: errs[i]})
+			continue
+		}
+		resolved = append(resolved, reports[i])
+	}
+
+	return resolved, failed
+}
+
+// validMulti reports whether the configuration can render more than one
+// pipeline.
+func validMulti(cfg Cfg) error {
+	if cfg.Quiet {
+		return fmt.Errorf("quiet mode supports a single pipeline")
+	}
+	if cfg.GroupBy != "" {
+		return fmt.Errorf("group-by supports a single pipeline")
+	}
+
+	switch cfg.Format {
+	case formatHTML, formatMermaid, formatDot:
+		return fmt.Errorf("the %s format supports a single pipeline", cfg.Format)
+	}
+	return nil
+}
+
+// renderMulti writes the reports of several pipelines to w. Formats that
+// describe a single document, like json, get one covering every pipeline,
+// the table gets a section per pipeline.
+func renderMulti(w io.Writer, format string, opts renderOptions, reports []report) error {
+	opts.Pipelines = true
+
+	if opts.Template != nil {
+		for _, r := range reports {
+			if err := renderTemplate(w, opts.Template, r); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	switch format {
+	case formatJSON:
+		return renderJSONArray(w, reports)
+	case formatYAML:
+		for _, r := range reports {
+			if _, err := io.WriteString(w, "---\n"); err != nil {
+				return err
+			}
+			if err := renderYAML(w, r); err != nil {
+				return err
+			}
+		}
+		return nil
+	case formatProm:
+		return renderProm(w, reports...)
+	case formatJUnit:
+		return renderJUnit(w, reports...)
+	case formatNDJSON:
+		return renderNDJSON(w, reports...)
+	case formatCSV, formatTSV:
+		return renderRows(w, format, opts, reports)
+	case formatMarkdown:
+		for _, r := range reports {
+			fmt.Fprintf(w, "### %s\n\n", mdEscaper.Replace(r.Pipeline))
+			if err := renderMarkdown(w, opts, r.Stages); err != nil {
+				return err
+			}
+			fmt.Fprintln(w)
+		}
+		return nil
+	default:
+		if opts.Plain {
+			return renderRows(w, formatTSV, opts, reports)
+		}
+		opts.Pipelines = false
+		for i, r := range reports {
+			if i > 0 {
+				fmt.Fprintln(w)
+			}
+			fmt.Fprintf(w, "%s\n\n", r.Pipeline)
+			if err := renderTable(w, opts, r); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// renderRows prints the reports as a single csv or tsv document with one
+// header row.
+func renderRows(w io.Writer, format string, opts renderOptions, reports []report) error {
+	render := renderCSV
+	if format == formatTSV {
+		render = renderTSV
+	}
+
+	for i, r := range reports {
+		if i > 0 {
+			opts.NoHeader = true
+		}
+		if err := render(w, opts, r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
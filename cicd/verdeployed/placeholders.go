@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Placeholders of the --bucket and --key values, expanded once the pipeline
+// and stage looked up are known.
+const (
+	placeholderPipeline = "{pipeline}"
+	placeholderRegion   = "{region}"
+	placeholderStage    = "{stage}"
+)
+
+// placeholderRe matches anything looking like a placeholder.
+var placeholderRe = regexp.MustCompile(`\{[^{}]*\}`)
+
+// validLocation reports whether value, the value of the named flag, only
+// uses known placeholders.
+func validLocation(flag, value string) error {
+	for _, p := range placeholderRe.FindAllString(value, -1) {
+		switch p {
+		case placeholderPipeline, placeholderRegion, placeholderStage:
+			continue
+		}
+		return fmt.Errorf("unknown placeholder %s in --%s, valid placeholders are: %s %s %s", p, flag, placeholderPipeline, placeholderRegion, placeholderStage)
+	}
+	return nil
+}
+
+// expandPipeline expands the pipeline and region placeholders of the
+// artifact location of cfg, {stage} is left for expandStage.
+func expandPipeline(cfg *Cfg) {
+	r := strings.NewReplacer(placeholderPipeline, cfg.PipelineName, placeholderRegion, cfg.Region)
+	cfg.Bucket, cfg.Key = r.Replace(cfg.Bucket), r.Replace(cfg.Key)
+}
+
+// expandStage expands the stage placeholder of the artifact location of
+// cfg to stage.
+func expandStage(cfg *Cfg, stage string) {
+	r := strings.NewReplacer(placeholderStage, stage)
+	cfg.Bucket, cfg.Key = r.Replace(cfg.Bucket), r.Replace(cfg.Key)
+}
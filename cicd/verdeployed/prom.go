@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// promEscaper escapes label values as required by the Prometheus text
+// exposition format.
+var promEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// promLabels renders label pairs, given as alternating names and values.
+func promLabels(pairs ...string) string {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, `%s="%s"`, pairs[i], promEscaper.Replace(pairs[i+1]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// renderProm prints the reports in the Prometheus text exposition format,
+// suitable for the node_exporter textfile collector. Every metric family is
+// printed once, with a series per pipeline.
+func renderProm(out io.Writer, reports ...report) error {
+	w := bufio.NewWriter(out)
+
+	fmt.Fprintln(w, "# HELP verdeployed_stage_info Artifact deployed by the latest execution of a pipeline stage.")
+	fmt.Fprintln(w, "# TYPE verdeployed_stage_info gauge")
+	for _, r := range reports {
+		for _, details := range r.Stages {
+			fmt.Fprintf(w, "verdeployed_stage_info%s 1\n", promLabels(
+				"pipeline", r.Pipeline,
+				"stage", details.Name,
+				"status", details.Status,
+				"version", details.Version,
+				"commit", details.Commit,
+				"branch", details.Branch,
+			))
+		}
+	}
+
+	fmt.Fprintln(w, "# HELP verdeployed_stage_succeeded Whether the latest execution of a pipeline stage succeeded.")
+	fmt.Fprintln(w, "# TYPE verdeployed_stage_succeeded gauge")
+	for _, r := range reports {
+		for _, details := range r.Stages {
+			succeeded := 0
+			if details.Status == "Succeeded" {
+				succeeded = 1
+			}
+			fmt.Fprintf(w, "verdeployed_stage_succeeded%s %d\n", promLabels("pipeline", r.Pipeline, "stage", details.Name), succeeded)
+		}
+	}
+
+	fmt.Fprintln(w, "# HELP verdeployed_stage_last_status_change_seconds Unix time any action of a pipeline stage last changed status.")
+	fmt.Fprintln(w, "# TYPE verdeployed_stage_last_status_change_seconds gauge")
+	for _, r := range reports {
+		for _, details := range r.Stages {
+			// stages that never ran have no sample
+			if details.LastStatusChange == nil {
+				continue
+			}
+			fmt.Fprintf(w, "verdeployed_stage_last_status_change_seconds%s %d\n", promLabels("pipeline", r.Pipeline, "stage", details.Name), details.LastStatusChange.Unix())
+		}
+	}
+
+	fmt.Fprintln(w, "# HELP verdeployed_scrape_timestamp_seconds Unix time the pipeline state was queried.")
+	fmt.Fprintln(w, "# TYPE verdeployed_scrape_timestamp_seconds gauge")
+	for _, r := range reports {
+		fmt.Fprintf(w, "verdeployed_scrape_timestamp_seconds%s %d\n", promLabels("pipeline", r.Pipeline), r.QueriedAt.Unix())
+	}
+
+	return w.Flush()
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/codepipeline"
+)
+
+// hasStatusReason reports whether the stage status comes with a reason,
+// only failed and stopped executions give one.
+func hasStatusReason(status string) bool {
+	return status == codepipeline.StageExecutionStatusFailed || status == codepipeline.StageExecutionStatusStopped
+}
+
+// getStatusReason returns why the execution exec failed or was stopped. The
+// reason given to a manual stop is only listed with the past executions.
+func getStatusReason(execs *executionCache, exec *codepipeline.PipelineExecution) (string, error) {
+	if reason := strings.TrimSpace(aws.StringValue(exec.StatusSummary)); reason != "" {
+		return reason, nil
+	}
+	if aws.StringValue(exec.Status) != codepipeline.PipelineExecutionStatusStopped {
+		return "", nil
+	}
+
+	history, err := execs.summaries(historyLookback)
+	if err != nil {
+		return "", err
+	}
+	for _, summary := range history {
+		if aws.StringValue(summary.PipelineExecutionId) == aws.StringValue(exec.PipelineExecutionId) && summary.StopTrigger != nil {
+			return strings.TrimSpace(aws.StringValue(summary.StopTrigger.Reason)), nil
+		}
+	}
+	return "", nil
+}
+
+// getStoppedBy returns who stopped a stage, as told by its abandoned
+// actions. Stops letting the actions finish leave no trace, empty then.
+func getStoppedBy(states []*codepipeline.ActionState) string {
+	for _, astate := range states {
+		exec := astate.LatestExecution
+		if exec == nil || aws.StringValue(exec.Status) != codepipeline.ActionExecutionStatusAbandoned {
+			continue
+		}
+		if by := aws.StringValue(exec.LastUpdatedBy); by != "" {
+			return principalName(by)
+		}
+	}
+	return ""
+}
+
+// reasonLines renders the status reason of a stage for display below its
+// table row, wrapped to width, e.g.
+//
+//	■ Stopped by alice: rolling back the bad config
+func reasonLines(details stageDetails, width int) []string {
+	if details.StatusReason == "" && details.StoppedBy == "" {
+		return nil
+	}
+
+	s := details.Status
+	if details.StoppedBy != "" {
+		s += " by " + details.StoppedBy
+	}
+	if details.StatusReason != "" {
+		s += ": " + details.StatusReason
+	}
+
+	const indent = "      "
+	lines := wrapText(s, indent, width)
+	lines[0] = "    ■ " + strings.TrimPrefix(lines[0], indent)
+	return lines
+}
+
+// hasStatusReasons reports whether any of the stages has a status reason.
+func hasStatusReasons(stages []stageDetails) bool {
+	for _, details := range stages {
+		if details.StatusReason != "" || details.StoppedBy != "" {
+			return true
+		}
+	}
+	return false
+}
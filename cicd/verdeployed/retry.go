@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/codepipeline"
+)
+
+// validRetry reports whether cfg names the stage to retry. Retrying is
+// never aimed at whatever failed anywhere in the pipeline.
+func validRetry(cfg Cfg) error {
+	switch {
+	case cfg.Stage == "":
+		return fmt.Errorf("retry requires --stage")
+	case cfg.Watch || cfg.History > 0 || cfg.Quiet:
+		return fmt.Errorf("retry can't be combined with --watch, --history or --quiet")
+	}
+	return nil
+}
+
+// retryStage retries the latest execution of cfg.Stage, only its failed
+// actions unless cfg.RetryAll is set. The stage must have failed or been
+// stopped. The id of the resumed pipeline execution is returned.
+func retryStage(sess *session.Session, cfg Cfg) (string, error) {
+	pipelnsvc := codepipeline.New(sess)
+
+	stage, err := getStageState(aws.BackgroundContext(), pipelnsvc, cfg.PipelineName, cfg.Stage)
+	if err != nil {
+		return "", err
+	}
+	exec := stage.LatestExecution
+	if exec == nil {
+		return "", fmt.Errorf("stage %s never ran, there is nothing to retry", cfg.Stage)
+	}
+	switch status := aws.StringValue(exec.Status); status {
+	case codepipeline.StageExecutionStatusFailed, codepipeline.StageExecutionStatusStopped:
+	default:
+		return "", fmt.Errorf("stage %s is %s, only failed or stopped stages can be retried", cfg.Stage, status)
+	}
+
+	mode := codepipeline.StageRetryModeFailedActions
+	if cfg.RetryAll {
+		mode = codepipeline.StageRetryModeAllActions
+	}
+
+	out, err := pipelnsvc.RetryStageExecution(&codepipeline.RetryStageExecutionInput{
+		PipelineName:        aws.String(cfg.PipelineName),
+		StageName:           aws.String(cfg.Stage),
+		PipelineExecutionId: exec.PipelineExecutionId,
+		RetryMode:           aws.String(mode),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			switch aerr.Code() {
+			case codepipeline.ErrCodeStageNotRetryableException:
+				return "", fmt.Errorf("stage %s can't be retried: %s", cfg.Stage, aerr.Message())
+			case codepipeline.ErrCodeNotLatestPipelineExecutionException:
+				return "", fmt.Errorf("execution %s of stage %s was superseded: %s", aws.StringValue(exec.PipelineExecutionId), cfg.Stage, aerr.Message())
+			default:
+				return "", fmt.Errorf("failed to retry stage execution: %s", aerr.Message())
+			}
+		}
+		return "", err
+	}
+
+	return aws.StringValue(out.PipelineExecutionId), nil
+}
+
+// waitForStage polls cfg.Stage until its execution execID is no longer in
+// progress and returns the status it settled with. Status changes are
+// reported on progress.
+//
+// Right after a retry the stage may still show the status it is retried
+// from, it only counts as settled once it was seen in progress or one of
+// its actions changed since the wait started.
+func waitForStage(ctx context.Context, sess *session.Session, cfg Cfg, execID string, progress io.Writer) (string, error) {
+	pipelnsvc := codepipeline.New(sess)
+
+	start := time.Now()
+	var status string
+	var started bool
+	err := poll(ctx, cfg, func(ctx context.Context) (bool, error) {
+		stage, err := getStageState(ctx, pipelnsvc, cfg.PipelineName, cfg.Stage)
+		if err != nil {
+			return false, err
+		}
+
+		exec := stage.LatestExecution
+		if exec == nil || aws.StringValue(exec.PipelineExecutionId) != execID {
+			return false, nil
+		}
+		if s := aws.StringValue(exec.Status); s != status {
+			status = s
+			fmt.Fprintf(progress, "%s %s (%s elapsed)\n", cfg.Stage, strings.ToLower(status), humanDuration(time.Since(start)))
+		}
+		if status == codepipeline.StageExecutionStatusInProgress {
+			started = true
+			return false, nil
+		}
+		if t := lastStatusChange(stage.ActionStates); t != nil && t.After(start) {
+			started = true
+		}
+		return started, nil
+	})
+
+	return status, err
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/codepipeline"
+)
+
+// rollbackDetails describes a rollback execution of a V2 pipeline stage.
+// The stage then runs the artifact of TargetExecutionID again.
+type rollbackDetails struct {
+	// TriggeredBy is the failed execution that caused the rollback, empty
+	// if it is no longer in the execution history.
+	TriggeredBy string `json:"triggeredBy,omitempty" yaml:"triggeredBy,omitempty"`
+	// TargetExecutionID is the execution rolled back to.
+	TargetExecutionID string `json:"targetExecutionId" yaml:"targetExecutionId"`
+	// Automated tells a rollback on failure apart from a manual one.
+	Automated bool `json:"automated" yaml:"automated"`
+
+	// FailedVersion and FailedCommit describe the artifact of the failed
+	// execution, the one the stage no longer runs.
+	FailedVersion string `json:"failedVersion" yaml:"failedVersion"`
+	FailedCommit  string `json:"failedCommit" yaml:"failedCommit"`
+}
+
+// getRollback describes exec if it is a rollback execution, nil otherwise.
+func getRollback(execs *executionCache, source versionSource, sess *session.Session, cfg Cfg, exec *codepipeline.PipelineExecution) (*rollbackDetails, error) {
+	if aws.StringValue(exec.ExecutionType) != codepipeline.ExecutionTypeRollback {
+		return nil, nil
+	}
+
+	rb := &rollbackDetails{}
+	if exec.RollbackMetadata != nil {
+		rb.TargetExecutionID = aws.StringValue(exec.RollbackMetadata.RollbackTargetPipelineExecutionId)
+	}
+	if exec.Trigger != nil {
+		rb.Automated = aws.StringValue(exec.Trigger.TriggerType) == codepipeline.TriggerTypeAutomatedRollback
+	}
+
+	failed, err := rollbackCause(execs, aws.StringValue(exec.PipelineExecutionId))
+	if err != nil || failed == "" {
+		return rb, err
+	}
+	rb.TriggeredBy = failed
+
+	fexec, err := execs.get(failed)
+	if err != nil {
+		return nil, err
+	}
+	meta, err := readVersion(sess, cfg, source, execs.revision(fexec, source))
+	if err != nil {
+		return nil, err
+	}
+	rb.FailedVersion, rb.FailedCommit = meta.Version, meta.Commit
+	return rb, nil
+}
+
+// rollbackCause returns the failed execution preceding the rollback
+// execution execID, empty if none is found in the execution history.
+func rollbackCause(execs *executionCache, execID string) (string, error) {
+	history, err := execs.summaries(historyLookback)
+	if err != nil {
+		return "", err
+	}
+
+	for i, summary := range history {
+		if aws.StringValue(summary.PipelineExecutionId) != execID {
+			continue
+		}
+		// newest first, look at the executions started before it
+		for _, older := range history[i+1:] {
+			if aws.StringValue(older.ExecutionType) == codepipeline.ExecutionTypeRollback {
+				continue
+			}
+			if aws.StringValue(older.Status) == codepipeline.PipelineExecutionStatusFailed {
+				return aws.StringValue(older.PipelineExecutionId), nil
+			}
+		}
+		break
+	}
+
+	return "", nil
+}
+
+// rollbackStatus renders the status of a rolled back stage, e.g.
+// "Rolled Back (from 1.5.0)".
+func rollbackStatus(rb *rollbackDetails) string {
+	if rb.FailedVersion == "" {
+		return "Rolled Back"
+	}
+	return "Rolled Back (from " + rb.FailedVersion + ")"
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// s3Retryer retries the S3 requests the SDK retries, like 503 SlowDown, as
+// well as the 404 reading an object version right after the execution
+// writing it started, before the version becomes visible. Versions still
+// missing after the last attempt are reported as such.
+type s3Retryer struct {
+	client.DefaultRetryer
+	verbose bool
+}
+
+// newS3Retryer makes at most attempts requests, backing off exponentially
+// with jitter in between.
+func newS3Retryer(attempts int, verbose bool) s3Retryer {
+	return s3Retryer{
+		DefaultRetryer: client.DefaultRetryer{
+			NumMaxRetries: attempts - 1,
+			MinRetryDelay: 100 * time.Millisecond,
+			MaxRetryDelay: 2 * time.Second,
+		},
+		verbose: verbose,
+	}
+}
+
+// ShouldRetry retries 404s on reading objects on top of what the SDK does.
+func (s s3Retryer) ShouldRetry(r *request.Request) bool {
+	if r.HTTPResponse != nil && r.HTTPResponse.StatusCode == http.StatusNotFound {
+		switch r.Operation.Name {
+		case "HeadObject", "GetObject":
+			return true
+		}
+	}
+	return s.DefaultRetryer.ShouldRetry(r)
+}
+
+// RetryRules returns the delay before retrying r, told on stderr with
+// --verbose.
+func (s s3Retryer) RetryRules(r *request.Request) time.Duration {
+	delay := s.DefaultRetryer.RetryRules(r)
+	if s.verbose {
+		fmt.Fprintf(os.Stderr, "retrying S3 %s in %s, attempt %d of %d, request id %s: %v\n", r.Operation.Name, delay.Round(time.Millisecond), r.RetryCount+2, s.NumMaxRetries+1, r.RequestID, r.Error)
+	}
+	return delay
+}
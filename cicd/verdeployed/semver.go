@@ -0,0 +1,168 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// semver is a semantic version, see https://semver.org. Build metadata
+// doesn't take part in the ordering and is dropped.
+type semver struct {
+	Major, Minor, Patch int
+	Pre                 []string
+}
+
+// parseSemver parses v as a semantic version, with or without a leading v.
+// ok is false for versions that don't conform.
+func parseSemver(v string) (s semver, ok bool) {
+	v = strings.TrimPrefix(v, "v")
+	v, _, _ = strings.Cut(v, "+")
+	core, pre, hasPre := strings.Cut(v, "-")
+
+	parts := strings.Split(core, ".")
+	if len(parts) != 3 {
+		return semver{}, false
+	}
+	nums := make([]int, len(parts))
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || strings.HasPrefix(p, "+") {
+			return semver{}, false
+		}
+		nums[i] = n
+	}
+	s = semver{Major: nums[0], Minor: nums[1], Patch: nums[2]}
+	if hasPre {
+		if pre == "" {
+			return semver{}, false
+		}
+		s.Pre = strings.Split(pre, ".")
+	}
+	return s, true
+}
+
+// compare returns -1, 0 or 1 as s is lower than, equal to or higher than o.
+// A pre-release is lower than the release it precedes.
+func (s semver) compare(o semver) int {
+	for _, d := range [][2]int{{s.Major, o.Major}, {s.Minor, o.Minor}, {s.Patch, o.Patch}} {
+		if c := compareInts(d[0], d[1]); c != 0 {
+			return c
+		}
+	}
+
+	switch {
+	case len(s.Pre) == 0 && len(o.Pre) == 0:
+		return 0
+	case len(s.Pre) == 0:
+		return 1
+	case len(o.Pre) == 0:
+		return -1
+	}
+	for i := 0; i < len(s.Pre) && i < len(o.Pre); i++ {
+		a, aerr := strconv.Atoi(s.Pre[i])
+		b, berr := strconv.Atoi(o.Pre[i])
+		switch {
+		case aerr == nil && berr == nil:
+			if c := compareInts(a, b); c != 0 {
+				return c
+			}
+		// numeric identifiers are lower than alphanumeric ones
+		case aerr == nil:
+			return -1
+		case berr == nil:
+			return 1
+		default:
+			if c := strings.Compare(s.Pre[i], o.Pre[i]); c != 0 {
+				return c
+			}
+		}
+	}
+	return compareInts(len(s.Pre), len(o.Pre))
+}
+
+// compareInts returns -1, 0 or 1 as a is lower than, equal to or higher
+// than b.
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// Positions of a version relative to another one.
+const (
+	positionBehind    = "behind"
+	positionAhead     = "ahead"
+	positionDifferent = "different"
+)
+
+// relativePosition tells whether v is behind or ahead of ref. Only
+// semantic versions can be ordered, the author dates of commits say nothing
+// about which one contains the other. Versions that can't be ordered are
+// merely different, equal ones have no position.
+func relativePosition(v, ref string) string {
+	if v == ref {
+		return ""
+	}
+
+	c := 0
+	if sv, ok := parseSemver(v); ok {
+		if sref, ok := parseSemver(ref); ok {
+			c = sv.compare(sref)
+		}
+	}
+
+	switch c {
+	case -1:
+		return positionBehind
+	case 1:
+		return positionAhead
+	}
+	return positionDifferent
+}
+
+// markPositions sets the position of every stage running another version
+// than the newest one in the pipeline. Without a way to order them the
+// version of the first stage, the newest the pipeline let through, is taken
+// as the newest.
+func markPositions(stages []stageDetails) {
+	var newest *stageDetails
+	for i := range stages {
+		details := &stages[i]
+		if details.ExecutionID == "" || details.Version == "" || isPlaceholder(details.Version) {
+			continue
+		}
+		if newest == nil || relativePosition(details.Version, newest.Version) == positionAhead {
+			newest = details
+		}
+	}
+	if newest == nil {
+		return
+	}
+
+	for i := range stages {
+		details := &stages[i]
+		if details.ExecutionID == "" || details.Version == "" || isPlaceholder(details.Version) {
+			continue
+		}
+		details.Position = relativePosition(details.Version, newest.Version)
+		if details.Position != "" {
+			details.Newest = newest.Version
+		}
+	}
+}
+
+// displayVersion annotates the version of a stage with its position, e.g.
+// "1.4.2 (behind 1.5.0)".
+func (d stageDetails) displayVersion() string {
+	switch d.Position {
+	case "":
+		return d.Version
+	case positionDifferent:
+		return d.Version + " (different from " + d.Newest + ")"
+	}
+	return d.Version + " (" + d.Position + " " + d.Newest + ")"
+}
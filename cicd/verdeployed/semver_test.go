@@ -0,0 +1,119 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSemver(t *testing.T) {
+	tests := []struct {
+		v    string
+		want semver
+		ok   bool
+	}{
+		{v: "1.5.0", want: semver{Major: 1, Minor: 5}, ok: true},
+		{v: "v1.5.0", want: semver{Major: 1, Minor: 5}, ok: true},
+		{v: "1.5.0-rc.1", want: semver{Major: 1, Minor: 5, Pre: []string{"rc", "1"}}, ok: true},
+		{v: "1.5.0+build.7", want: semver{Major: 1, Minor: 5}, ok: true},
+		{v: "v1.5.0-beta+exp.sha.5114f85", want: semver{Major: 1, Minor: 5, Pre: []string{"beta"}}, ok: true},
+		{v: "1.5", ok: false},
+		{v: "1.5.0.1", ok: false},
+		{v: "1.5.0-", ok: false},
+		{v: "1.+5.0", ok: false},
+		{v: "3f1c2a9", ok: false},
+	}
+	for _, tt := range tests {
+		got, ok := parseSemver(tt.v)
+		if ok != tt.ok || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseSemver(%q) = %+v, %t, want %+v, %t", tt.v, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestSemverCompare(t *testing.T) {
+	// ordered as in https://semver.org/#spec-item-11
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{a: "1.0.0", b: "2.0.0", want: -1},
+		{a: "2.0.0", b: "2.1.0", want: -1},
+		{a: "2.1.0", b: "2.1.1", want: -1},
+		{a: "1.0.0-alpha", b: "1.0.0", want: -1},
+		{a: "1.0.0-alpha", b: "1.0.0-alpha.1", want: -1},
+		{a: "1.0.0-alpha.1", b: "1.0.0-alpha.beta", want: -1},
+		{a: "1.0.0-alpha.beta", b: "1.0.0-beta", want: -1},
+		{a: "1.0.0-beta.2", b: "1.0.0-beta.11", want: -1},
+		{a: "1.0.0-rc.1", b: "1.0.0", want: -1},
+		{a: "1.10.0", b: "1.9.0", want: 1},
+		{a: "v1.5.0", b: "1.5.0", want: 0},
+		{a: "1.5.0+build.1", b: "1.5.0+build.2", want: 0},
+	}
+	for _, tt := range tests {
+		a, _ := parseSemver(tt.a)
+		b, _ := parseSemver(tt.b)
+		if got := a.compare(b); got != tt.want {
+			t.Errorf("%s compared to %s = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := b.compare(a); got != -tt.want {
+			t.Errorf("%s compared to %s = %d, want %d", tt.b, tt.a, got, -tt.want)
+		}
+	}
+}
+
+func TestMarkPositions(t *testing.T) {
+	tests := []struct {
+		name      string
+		versions  []string
+		newest    string
+		positions []string
+	}{
+		{
+			name:      "semantic",
+			versions:  []string{"1.4.0", "1.5.0", "1.5.0-rc.1", "1.5.0"},
+			newest:    "1.5.0",
+			positions: []string{positionBehind, "", positionBehind, ""},
+		},
+		{
+			name:      "commits",
+			versions:  []string{"3f1c2a9", "9b0e4d1", "3f1c2a9"},
+			newest:    "3f1c2a9",
+			positions: []string{"", positionDifferent, ""},
+		},
+		{
+			name:      "mixed",
+			versions:  []string{"1.5.0", "3f1c2a9"},
+			newest:    "1.5.0",
+			positions: []string{"", positionDifferent},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stages := make([]stageDetails, len(tt.versions))
+			for i, v := range tt.versions {
+				stages[i] = stageDetails{Name: v, ExecutionID: "exec", Version: v}
+			}
+			// stages that never ran or whose version is unknown have no position
+			stages = append(stages, stageDetails{Name: "Canary", Version: "9.9.9"}, stageDetails{Name: "Prod", ExecutionID: "exec"})
+
+			markPositions(stages)
+			for i, want := range tt.positions {
+				if got := stages[i].Position; got != want {
+					t.Errorf("position of %s = %q, want %q", stages[i].Version, got, want)
+				}
+				wantNewest := ""
+				if want != "" {
+					wantNewest = tt.newest
+				}
+				if got := stages[i].Newest; got != wantNewest {
+					t.Errorf("newest for %s = %q, want %q", stages[i].Version, got, wantNewest)
+				}
+			}
+			for _, s := range stages[len(tt.positions):] {
+				if s.Position != "" || s.Newest != "" {
+					t.Errorf("stage %s has position %q of %q, want none", s.Name, s.Position, s.Newest)
+				}
+			}
+		})
+	}
+}
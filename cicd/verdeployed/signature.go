@@ -0,0 +1,269 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/kms/kmsiface"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// signatureKey is the metadata key the publisher records the signature of
+// the artifact digest under, base64 encoded. Without it the signature is
+// looked for in the sibling object of the artifact with signatureSuffix.
+const (
+	signatureKey    = "Signature"
+	signatureSuffix = ".sig"
+)
+
+// sigLookback bounds the versions of the sibling signature object tried,
+// the latest one may sign a newer artifact than the deployed one. Without a
+// valid one among them the signature is unverified if there are older ones.
+const sigLookback = 10
+
+// sigMaxSize bounds the sibling signature objects read, signatures are a
+// few hundred bytes.
+const sigMaxSize = 64 << 10
+
+// Outcomes of --verify-signature.
+const (
+	signatureOK         = "ok"
+	signatureFailed     = "failed"
+	signatureUnsigned   = "unsigned"
+	signatureUnverified = "unverified"
+)
+
+// signatureDetails is the outcome of verifying the signature of an
+// artifact version.
+type signatureDetails struct {
+	Status string `json:"status" yaml:"status"`
+	// Reason tells why the signature couldn't be verified.
+	Reason string `json:"reason,omitempty" yaml:"reason,omitempty"`
+}
+
+// signatureCache remembers the outcome for every artifact version verified.
+var signatureCache = struct {
+	sync.Mutex
+	m map[string]*signatureDetails
+}{m: make(map[string]*signatureDetails)}
+
+// verifySignature verifies the signature of the artifact version ver with
+// the KMS key of cfg. The digest signed is the SHA-256 of that very
+// version, meta its metadata.
+func verifySignature(sess *session.Session, cfg Cfg, ver string, meta map[string]*string) *signatureDetails {
+	cacheKey := cfg.Bucket + "/" + cfg.Key + "?versionId=" + ver
+	signatureCache.Lock()
+	cached, ok := signatureCache.m[cacheKey]
+	signatureCache.Unlock()
+	if ok {
+		return cached
+	}
+
+	sig, err := checkSignature(sess, cfg, ver, meta)
+	if err != nil {
+		// the next refresh may succeed
+		return &signatureDetails{Status: signatureUnverified, Reason: err.Error()}
+	}
+
+	signatureCache.Lock()
+	signatureCache.m[cacheKey] = sig
+	signatureCache.Unlock()
+	return sig
+}
+
+// checkSignature verifies the signature in meta or, without one, any of
+// the latest versions of the sibling signature object.
+func checkSignature(sess *session.Session, cfg Cfg, ver string, meta map[string]*string) (*signatureDetails, error) {
+	var signatures [][]byte
+	var truncated bool
+	if s := metaValue(meta, []string{signatureKey}); s != "" {
+		sig, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return nil, fmt.Errorf("the %s metadata is not base64: %w", signatureKey, err)
+		}
+		signatures = append(signatures, sig)
+	} else {
+		var err error
+		if signatures, truncated, err = siblingSignatures(sess, cfg); err != nil {
+			return nil, err
+		}
+	}
+	if len(signatures) == 0 && !truncated {
+		return &signatureDetails{Status: signatureUnsigned}, nil
+	}
+
+	sum, err := objectChecksum(sess, cfg, ver)
+	if err != nil {
+		return nil, err
+	}
+	digest, err := hex.DecodeString(sum)
+	if err != nil {
+		return nil, err
+	}
+
+	svc, err := kmsClient(sess, cfg.KMSKeyArn)
+	if err != nil {
+		return nil, err
+	}
+	for _, sig := range signatures {
+		out, err := svc.Verify(&kms.VerifyInput{
+			KeyId:            aws.String(cfg.KMSKeyArn),
+			Message:          digest,
+			MessageType:      aws.String(kms.MessageTypeDigest),
+			Signature:        sig,
+			SigningAlgorithm: aws.String(cfg.SigningAlgorithm),
+		})
+		if err != nil {
+			if aerr, ok := err.(awserr.Error); ok {
+				switch aerr.Code() {
+				case kms.ErrCodeKMSInvalidSignatureException:
+					continue
+				default:
+					return nil, fmt.Errorf("failed to verify signature: %s", aerr.Message())
+				}
+			}
+			return nil, err
+		}
+		if aws.BoolValue(out.SignatureValid) {
+			return &signatureDetails{Status: signatureOK}, nil
+		}
+	}
+	if truncated {
+		// the deployed artifact may be signed by an older version
+		return &signatureDetails{Status: signatureUnverified, Reason: fmt.Sprintf("no signature among the latest %d versions listed verifies, older ones weren't tried", sigLookback)}, nil
+	}
+	return &signatureDetails{Status: signatureFailed}, nil
+}
+
+// siblingSignatures reads the latest versions of the signature object next
+// to the artifact, newest first, and whether there are older ones. Signatures
+// are stored raw or base64 encoded.
+func siblingSignatures(sess *session.Session, cfg Cfg) ([][]byte, bool, error) {
+	svc, err := s3Client(sess, cfg)
+	if err != nil {
+		return nil, false, err
+	}
+	key := cfg.Key + signatureSuffix
+
+	out, err := svc.ListObjectVersions(&s3.ListObjectVersionsInput{
+		Bucket:  aws.String(cfg.Bucket),
+		Prefix:  aws.String(key),
+		MaxKeys: aws.Int64(sigLookback),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			switch aerr.Code() {
+			default:
+				return nil, false, fmt.Errorf("failed to list signatures: %s", aerr.Message())
+			}
+		}
+		return nil, false, err
+	}
+
+	var signatures [][]byte
+	for _, v := range out.Versions {
+		if aws.StringValue(v.Key) != key {
+			continue
+		}
+		obj, err := svc.GetObject(&s3.GetObjectInput{
+			Bucket:    aws.String(cfg.Bucket),
+			Key:       aws.String(key),
+			VersionId: v.VersionId,
+		})
+		if err != nil {
+			if aerr, ok := err.(awserr.Error); ok {
+				switch aerr.Code() {
+				default:
+					return nil, false, fmt.Errorf("failed to read signature: %s", aerr.Message())
+				}
+			}
+			return nil, false, err
+		}
+		data, err := io.ReadAll(io.LimitReader(obj.Body, sigMaxSize))
+		obj.Body.Close()
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to read signature: %w", err)
+		}
+		if sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data))); err == nil {
+			data = sig
+		}
+		signatures = append(signatures, data)
+	}
+	return signatures, aws.BoolValue(out.IsTruncated), nil
+}
+
+// newKMS creates the clients kmsClient returns, tests replace it.
+var newKMS = func(sess *session.Session, config *aws.Config) kmsiface.KMSAPI {
+	return kms.New(sess, config)
+}
+
+// kmsClient returns a KMS client for the region of the key.
+func kmsClient(sess *session.Session, keyArn string) (kmsiface.KMSAPI, error) {
+	a, err := arn.Parse(keyArn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --kms-key-arn: %w", err)
+	}
+	return newKMS(sess, aws.NewConfig().WithRegion(a.Region)), nil
+}
+
+// signatureColumn shows whether the artifact of the stage is signed.
+var signatureColumn = column{
+	Name:  "signature",
+	Title: "Signature",
+	Value: func(_ report, d stageDetails) string {
+		if d.Signature == nil {
+			return ""
+		}
+		return d.Signature.Status
+	},
+	Display: func(_ renderOptions, _ report, d stageDetails) string {
+		if d.Signature == nil {
+			return "-"
+		}
+		switch d.Signature.Status {
+		case signatureOK:
+			return "OK"
+		case signatureFailed:
+			return "FAILED"
+		case signatureUnsigned:
+			return "not signed"
+		}
+		return d.Signature.Status
+	},
+}
+
+// withSignature appends the signature column to the default columns of
+// --verify-signature, a --columns selection places it itself.
+func (o renderOptions) withSignature(cols []column) []column {
+	if !o.VerifySignature || o.Columns != nil {
+		return cols
+	}
+	return append(cols[:len(cols):len(cols)], signatureColumn)
+}
+
+// exitIfSignatureFailed reports the stages whose artifact signature doesn't
+// verify on stderr and exits with exitSignature if there are any.
+func exitIfSignatureFailed(reports ...report) {
+	var failed bool
+	for _, r := range reports {
+		for _, details := range r.Stages {
+			if s := details.Signature; s != nil && s.Status == signatureFailed {
+				failed = true
+				fmt.Fprintf(os.Stderr, "%s: stage %s: the artifact signature doesn't verify\n", r.Pipeline, details.Name)
+			}
+		}
+	}
+	if failed {
+		os.Exit(exitSignature)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/base64"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/kms/kmsiface"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+func TestVerifySignatureReplaced(t *testing.T) {
+	sess := withS3(t, &unversionedS3{etag: `"7d793037a0760186574b0282f2f435e7"`, content: []byte("replaced")})
+	cfg := testCfg("app")
+	cfg.Bucket, cfg.Key, cfg.ChecksumMaxSize = "artifacts", "replaced.zip", 1
+	cfg.KMSKeyArn = "arn:aws:kms:eu-west-1:123456789012:key/signing"
+	meta := map[string]*string{signatureKey: aws.String(base64.StdEncoding.EncodeToString([]byte("signature")))}
+
+	sig := verifySignature(sess, cfg, `"5d41402abc4b2a76b9719d911017c592"`, meta)
+	if sig.Status != signatureUnverified || sig.Reason != errObjectReplaced.Error() {
+		t.Errorf("verifySignature = %s (%q), want %s (%q)", sig.Status, sig.Reason, signatureUnverified, errObjectReplaced)
+	}
+}
+
+// signedS3 holds the artifact like unversionedS3 along with the versions of
+// its sibling signature object, newest first.
+type signedS3 struct {
+	unversionedS3
+	sigs      []string
+	truncated bool
+}
+
+func (s *signedS3) ListObjectVersions(in *s3.ListObjectVersionsInput) (*s3.ListObjectVersionsOutput, error) {
+	out := &s3.ListObjectVersionsOutput{IsTruncated: aws.Bool(s.truncated)}
+	for i := range s.sigs {
+		out.Versions = append(out.Versions, &s3.ObjectVersion{Key: in.Prefix, VersionId: aws.String(strconv.Itoa(i))})
+	}
+	return out, nil
+}
+
+func (s *signedS3) GetObject(in *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	i, _ := strconv.Atoi(aws.StringValue(in.VersionId))
+	return &s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader(s.sigs[i]))}, nil
+}
+
+// signingKMS accepts only the signature valid. The signatures of the tests
+// aren't base64, siblingSignatures reads them raw.
+type signingKMS struct {
+	kmsiface.KMSAPI
+	valid string
+}
+
+func (k signingKMS) Verify(in *kms.VerifyInput) (*kms.VerifyOutput, error) {
+	if string(in.Signature) != k.valid {
+		return nil, awserr.New(kms.ErrCodeKMSInvalidSignatureException, "invalid signature", nil)
+	}
+	return &kms.VerifyOutput{SignatureValid: aws.Bool(true)}, nil
+}
+
+func TestVerifySignatureSibling(t *testing.T) {
+	saved := newKMS
+	newKMS = func(*session.Session, *aws.Config) kmsiface.KMSAPI { return signingKMS{valid: "sig-deployed"} }
+	t.Cleanup(func() { newKMS = saved })
+
+	etag := `"5d41402abc4b2a76b9719d911017c592"`
+	tests := []struct {
+		name      string
+		sigs      []string
+		truncated bool
+		status    string
+	}{
+		{name: "valid", sigs: []string{"sig-newer", "sig-deployed"}, status: signatureOK},
+		{name: "none valid", sigs: []string{"sig-newer", "sig-other"}, status: signatureFailed},
+		{name: "none valid of the latest", sigs: []string{"sig-newer", "sig-other"}, truncated: true, status: signatureUnverified},
+		{name: "none among the latest", truncated: true, status: signatureUnverified},
+		{name: "unsigned", status: signatureUnsigned},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sess := withS3(t, &signedS3{unversionedS3: unversionedS3{etag: etag, content: []byte("deployed")}, sigs: tt.sigs, truncated: tt.truncated})
+			cfg := testCfg("app")
+			cfg.Bucket, cfg.Key, cfg.ChecksumMaxSize = "artifacts", tt.name+".zip", 1
+			cfg.KMSKeyArn = "arn:aws:kms:eu-west-1:123456789012:key/signing"
+
+			sig := verifySignature(sess, cfg, etag, nil)
+			if sig.Status != tt.status {
+				t.Errorf("verifySignature = %s (%q), want %s", sig.Status, sig.Reason, tt.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/codepipeline"
+)
+
+// sourceStageName returns the stage of the pipeline holding its source
+// actions: the configured one if the pipeline has it, otherwise the first
+// stage with an action of the Source category.
+func sourceStageName(pipeline *codepipeline.PipelineDeclaration, configured string) (string, error) {
+	for _, stage := range pipeline.Stages {
+		if aws.StringValue(stage.Name) == configured {
+			return configured, nil
+		}
+	}
+
+	for _, stage := range pipeline.Stages {
+		for _, action := range stage.Actions {
+			if id := action.ActionTypeId; id != nil && aws.StringValue(id.Category) == codepipeline.ActionCategorySource {
+				return aws.StringValue(stage.Name), nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("pipeline %s has no stage %q nor one with a source action, set --source-stage", aws.StringValue(pipeline.Name), configured)
+}
+
+// sourceStageState returns the state of the source stage among the stage
+// states of a pipeline: the configured one if the pipeline has it,
+// otherwise the first stage, where CodePipeline requires the source actions
+// to be. nil if the pipeline has no stage at all.
+func sourceStageState(stages []*codepipeline.StageState, configured string) *codepipeline.StageState {
+	for _, stage := range stages {
+		if aws.StringValue(stage.StageName) == configured {
+			return stage
+		}
+	}
+	if len(stages) > 0 {
+		return stages[0]
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// sseCustomerAlgorithm is the only algorithm S3 supports for customer
+// provided keys.
+const sseCustomerAlgorithm = "AES256"
+
+// sseCustomerKey decodes the base64 SSE-C key of cfg, empty without one.
+func sseCustomerKey(cfg Cfg) (string, error) {
+	if cfg.SSECustomerKey == "" {
+		return "", nil
+	}
+	key, err := base64.StdEncoding.DecodeString(cfg.SSECustomerKey)
+	if err != nil {
+		return "", fmt.Errorf("--sse-customer-key is not base64: %w", err)
+	}
+	if len(key) != 32 {
+		return "", fmt.Errorf("--sse-customer-key must be a 256 bit key, got %d bits", len(key)*8)
+	}
+	return string(key), nil
+}
+
+// withSSECustomerKey sets the SSE-C headers objects encrypted with a
+// customer provided key can only be read with, if cfg has the key. The SDK
+// encodes the key and adds its MD5.
+func withSSECustomerKey(cfg Cfg, algorithm, key **string) {
+	// validated on startup
+	if k, _ := sseCustomerKey(cfg); k != "" {
+		*algorithm, *key = aws.String(sseCustomerAlgorithm), aws.String(k)
+	}
+}
+
+// kmsErrorCodes are the codes S3 passes on when KMS refuses to decrypt an
+// object.
+var kmsErrorCodes = map[string]bool{
+	"KMS.AccessDeniedException":      true,
+	"KMS.DisabledException":          true,
+	"KMS.KMSInvalidStateException":   true,
+	"KMS.NotFoundException":          true,
+	"KMS.InvalidKeyUsageException":   true,
+	"KMS.KeyUnavailableException":    true,
+	"KMS.DependencyTimeoutException": true,
+}
+
+// encryptionError explains err, returned reading the configured artifact,
+// when it is due to the encryption of the object: KMS refusing to decrypt
+// with keyID, the key the object is encrypted with if known, or a missing
+// customer provided key. nil for any other error, those take the generic
+// path.
+func encryptionError(svc s3iface.S3API, cfg Cfg, err error, keyID string) error {
+	aerr, ok := err.(awserr.Error)
+	if !ok {
+		return nil
+	}
+	object := "s3://" + cfg.Bucket + "/" + cfg.Key
+
+	switch code := aerr.Code(); {
+	case kmsErrorCodes[code] || strings.Contains(aerr.Message(), "KMS"):
+		if keyID == "" {
+			keyID = bucketKMSKey(svc, cfg.Bucket)
+		}
+		if keyID == "" {
+			return fmt.Errorf("KMS refused to decrypt %s: %s; the caller needs kms:Decrypt on the key it is encrypted with", object, aerr.Message())
+		}
+		return fmt.Errorf("KMS refused to decrypt %s: %s; the caller needs kms:Decrypt on %s", object, aerr.Message(), keyID)
+	case code == "AccessDenied" || code == "Forbidden":
+		// HEAD responses carry no error body, whether KMS is to blame can
+		// only be guessed from the bucket encryption
+		if keyID == "" {
+			keyID = bucketKMSKey(svc, cfg.Bucket)
+		}
+		if keyID == "" {
+			return nil
+		}
+		return fmt.Errorf("access denied reading %s: the bucket encrypts with KMS key %s, the caller needs kms:Decrypt on it as well as s3:GetObject", object, keyID)
+	case code == "BadRequest" && cfg.SSECustomerKey == "":
+		return fmt.Errorf("failed to read %s: it may be encrypted with a customer provided key, pass it with --sse-customer-key", object)
+	}
+	return nil
+}
+
+// bucketKMSKey returns the KMS key the bucket encrypts new objects with by
+// default, empty if it doesn't use KMS or the encryption can't be read.
+func bucketKMSKey(svc s3iface.S3API, bucket string) string {
+	out, err := svc.GetBucketEncryption(&s3.GetBucketEncryptionInput{Bucket: aws.String(bucket)})
+	if err != nil || out.ServerSideEncryptionConfiguration == nil {
+		return ""
+	}
+	for _, rule := range out.ServerSideEncryptionConfiguration.Rules {
+		def := rule.ApplyServerSideEncryptionByDefault
+		if def == nil || !strings.HasPrefix(aws.StringValue(def.SSEAlgorithm), s3.ServerSideEncryptionAwsKms) {
+			continue
+		}
+		if key := aws.StringValue(def.KMSMasterKeyID); key != "" {
+			return key
+		}
+		return "alias/aws/s3"
+	}
+	return ""
+}
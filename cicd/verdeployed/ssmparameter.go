@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ssm"
+)
+
+// parameterNotRecorded is the status of a parameter that doesn't exist,
+// the deploy step didn't record the version.
+const parameterNotRecorded = "not-recorded"
+
+// parameterCheck is the version a deploy step recorded for a stage in
+// Parameter Store, checked against the version of the stage.
+type parameterCheck struct {
+	Name   string `json:"name" yaml:"name"`
+	Status string `json:"status" yaml:"status"`
+	// Value is the recorded version, Expected the one of the stage.
+	Value        string     `json:"value,omitempty" yaml:"value,omitempty"`
+	Expected     string     `json:"expected,omitempty" yaml:"expected,omitempty"`
+	LastModified *time.Time `json:"lastModified,omitempty" yaml:"lastModified,omitempty"`
+	// Reason tells why the parameter couldn't be verified.
+	Reason string `json:"reason,omitempty" yaml:"reason,omitempty"`
+}
+
+// display renders the recorded value next to the expected one and how
+// long ago it was recorded, relative to now.
+func (p parameterCheck) display(now time.Time) string {
+	set := ""
+	if p.LastModified != nil {
+		set = ", set " + humanDuration(now.Sub(*p.LastModified)) + " ago"
+	}
+	switch p.Status {
+	case runtimeOK:
+		if set == "" {
+			return "OK " + p.Value
+		}
+		return fmt.Sprintf("OK %s (%s)", p.Value, strings.TrimPrefix(set, ", "))
+	case runtimeDrifted:
+		return fmt.Sprintf("MISMATCH %s (expected %s%s)", p.Value, p.Expected, set)
+	case parameterNotRecorded:
+		return "not recorded"
+	}
+	// the recorded version stands on its own when the stage has none
+	if p.Value != "" {
+		return fmt.Sprintf("%s (unverified%s)", p.Value, set)
+	}
+	return p.Status
+}
+
+// parseParameters parses STAGE=NAME parameter mappings, as given by
+// --ssm-parameter.
+func parseParameters(specs []string) (map[string]string, error) {
+	params := make(map[string]string)
+	for _, spec := range specs {
+		if spec == "" {
+			continue
+		}
+		stage, name, _ := strings.Cut(spec, "=")
+		if stage == "" || name == "" {
+			return nil, fmt.Errorf("invalid SSM parameter %q, want STAGE=NAME", spec)
+		}
+		params[stage] = name
+	}
+	return params, nil
+}
+
+// checkParameter reads the parameter --ssm-parameter maps the stage to and
+// compares it with the version or commit of the stage. nil if it maps
+// none. The parameter is read even when the version of the stage couldn't
+// be, it then stands on its own. Parameters that can't be read are left
+// unverified with a warning.
+func checkParameter(sess *session.Session, cfg Cfg, details stageDetails) *parameterCheck {
+	// validated on startup
+	params, _ := parseParameters(cfg.SSMParameter)
+	name, ok := params[details.Name]
+	if !ok {
+		return nil
+	}
+
+	p := &parameterCheck{Name: name}
+	if details.Version != "" && !isPlaceholder(details.Version) {
+		p.Expected = details.Version
+	}
+	out, err := ssm.New(sess).GetParameter(&ssm.GetParameterInput{
+		Name:           aws.String(name),
+		WithDecryption: aws.Bool(true),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			switch aerr.Code() {
+			case ssm.ErrCodeParameterNotFound:
+				p.Status = parameterNotRecorded
+				return p
+			default:
+				err = fmt.Errorf("failed to get parameter %s: %s", name, aerr.Message())
+			}
+		}
+		p.Status, p.Reason = runtimeUnverified, err.Error()
+		warnUnverified("SSM parameter "+name, err)
+		return p
+	}
+
+	p.Value = strings.TrimSpace(aws.StringValue(out.Parameter.Value))
+	p.LastModified = out.Parameter.LastModifiedDate
+	commit := details.Commit != "" && !isPlaceholder(details.Commit)
+	switch {
+	case p.Expected == "" && !commit:
+		p.Status, p.Reason = runtimeUnverified, "the stage has no version to compare"
+	case p.Expected != "" && sameVersion(p.Value, p.Expected), commit && sameCommit(p.Value, details.Commit):
+		p.Status = runtimeOK
+	default:
+		p.Status = runtimeDrifted
+		if p.Expected == "" {
+			p.Expected = shortCommit(details.Commit)
+		}
+	}
+	return p
+}
+
+// parameterColumn shows the version recorded in Parameter Store next to the
+// one of the stage.
+var parameterColumn = column{
+	Name:  "parameter",
+	Title: "Parameter",
+	Wide:  true,
+	Value: func(_ report, d stageDetails) string {
+		if d.Parameter == nil {
+			return ""
+		}
+		return d.Parameter.Value
+	},
+	Display: func(_ renderOptions, r report, d stageDetails) string {
+		if d.Parameter == nil {
+			return "-"
+		}
+		return d.Parameter.display(r.QueriedAt)
+	},
+}
+
+// withParameter appends the parameter column to the default columns of
+// --ssm-parameter, a --columns selection places it itself.
+func (o renderOptions) withParameter(cols []column) []column {
+	if !o.Parameter || o.Columns != nil {
+		return cols
+	}
+	return append(cols[:len(cols):len(cols)], parameterColumn)
+}
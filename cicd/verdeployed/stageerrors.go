@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// errPipelinesFailed is returned by the writers of reports missing a
+// pipeline that couldn't be queried.
+var errPipelinesFailed = errors.New("some pipelines could not be queried")
+
+// incompleteReport returns errStagesFailed when any stage of the reports
+// couldn't be looked up, errPipelinesFailed when pipelines are missing
+// from them. Writers return it after writing the report, so --output
+// keeps its previous content rather than a partial report.
+func incompleteReport(errs []error, reports ...report) error {
+	if len(errs) > 0 {
+		return errPipelinesFailed
+	}
+	for _, r := range reports {
+		if hasLookupErrors(r.Stages) {
+			return errStagesFailed
+		}
+	}
+	return nil
+}
+
+// isIncomplete reports whether err tells the report written is incomplete,
+// see incompleteReport.
+func isIncomplete(err error) bool {
+	return errors.Is(err, errStagesFailed) || errors.Is(err, errPipelinesFailed)
+}
+
+// hasLookupErrors reports whether any of the stages couldn't be looked up.
+func hasLookupErrors(stages []stageDetails) bool {
+	for _, details := range stages {
+		if details.Error != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// exitIfStagesFailed reports the stages that couldn't be looked up on
+// stderr and exits 1 if there are any. Their rows were written already,
+// with what could be told, unless the report went to --output.
+func exitIfStagesFailed(reports ...report) {
+	var failed bool
+	for _, r := range reports {
+		for _, details := range r.Stages {
+			if details.Error != "" {
+				failed = true
+				fmt.Fprintf(os.Stderr, "%s: stage %s: %s\n", r.Pipeline, details.Name, details.Error)
+			}
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
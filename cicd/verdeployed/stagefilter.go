@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/codepipeline"
+)
+
+// stageFilter selects the stages to report by their case-insensitive name.
+type stageFilter struct {
+	include []string
+	exclude []string
+}
+
+// newStageFilter parses the comma separated stage names of --stages and
+// --exclude-stages.
+func newStageFilter(include, exclude string) stageFilter {
+	return stageFilter{
+		include: parseNames(include),
+		exclude: parseNames(exclude),
+	}
+}
+
+// check fails if a named stage doesn't exist in the pipeline.
+func (f stageFilter) check(pipeline string, states []*codepipeline.StageState) error {
+	for _, name := range append(f.include[:len(f.include):len(f.include)], f.exclude...) {
+		found := false
+		for _, stage := range states {
+			if strings.EqualFold(aws.StringValue(stage.StageName), name) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("stage %q not found in pipeline %s", name, pipeline)
+		}
+	}
+	return nil
+}
+
+// skip reports whether the stage is filtered out.
+func (f stageFilter) skip(stage string) bool {
+	for _, name := range f.exclude {
+		if strings.EqualFold(name, stage) {
+			return true
+		}
+	}
+	if len(f.include) == 0 {
+		return false
+	}
+	for _, name := range f.include {
+		if strings.EqualFold(name, stage) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,1089 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/codepipeline"
+)
+
+// stageDetails holds everything verdeployed knows about a single pipeline
+// stage. Field tags define the machine readable output formats.
+type stageDetails struct {
+	Name        string `json:"stageName" yaml:"stageName"`
+	Status      string `json:"status" yaml:"status"`
+	ExecutionID string `json:"executionId" yaml:"executionId"`
+	RevisionID  string `json:"revisionId" yaml:"revisionId"`
+	Version     string `json:"version" yaml:"version"`
+	Commit      string `json:"commit" yaml:"commit"`
+	ReleaseURL  string `json:"releaseUrl" yaml:"releaseUrl"`
+	// Position tells whether Version is behind, ahead of or merely
+	// different from Newest, the newest version of the pipeline. Empty for
+	// stages running the newest one.
+	Position string `json:"position,omitempty" yaml:"position,omitempty"`
+	Newest   string `json:"newest,omitempty" yaml:"newest,omitempty"`
+	// CommitMessage, CommitAuthor and CommitDate describe the commit,
+	// only filled in when asked for.
+	CommitMessage string     `json:"commitMessage,omitempty" yaml:"commitMessage,omitempty"`
+	CommitAuthor  string     `json:"commitAuthor,omitempty" yaml:"commitAuthor,omitempty"`
+	CommitDate    *time.Time `json:"commitDate,omitempty" yaml:"commitDate,omitempty"`
+	// Image describes the image of an ECR source.
+	Image *imageDetails `json:"image,omitempty" yaml:"image,omitempty"`
+	// Build is the CodeBuild build that produced the artifact, only
+	// filled in with --show-build.
+	Build *buildDetails `json:"build,omitempty" yaml:"build,omitempty"`
+	// Containers lists the images the ECS deploy actions of the stage
+	// rolled out, only filled in with --image-definitions.
+	Containers []containerImage `json:"containers,omitempty" yaml:"containers,omitempty"`
+	// Runtime tells whether the ECS services of the stage run Version,
+	// only filled in with --verify-ecs.
+	Runtime []serviceRuntime `json:"runtime,omitempty" yaml:"runtime,omitempty"`
+	// Functions tells whether the Lambda function aliases of the stage
+	// serve Version, only filled in for stages --lambda-function maps.
+	Functions []functionRuntime `json:"functions,omitempty" yaml:"functions,omitempty"`
+	// Environments tells whether the Elastic Beanstalk environments of
+	// the stage run Version and how healthy they are, only filled in with
+	// --verify-beanstalk.
+	Environments []environmentRuntime `json:"environments,omitempty" yaml:"environments,omitempty"`
+	// Deployments describes the last deployment of the CodeDeploy
+	// deployment groups of the stage, only filled in with
+	// --verify-codedeploy.
+	Deployments []deploymentRuntime `json:"deployments,omitempty" yaml:"deployments,omitempty"`
+	// Endpoints tells what the version endpoints of the stage serve, only
+	// filled in for stages --check maps.
+	Endpoints []endpointCheck `json:"endpoints,omitempty" yaml:"endpoints,omitempty"`
+	// Parameter is the version recorded in Parameter Store for the stage,
+	// only filled in for stages --ssm-parameter maps.
+	Parameter *parameterCheck `json:"parameter,omitempty" yaml:"parameter,omitempty"`
+	// VersionSource tells where the version of an S3 artifact was read
+	// from: the object metadata (meta), its tags (tag) or the version file
+	// in the archive (archive).
+	VersionSource string `json:"versionSource,omitempty" yaml:"versionSource,omitempty"`
+	// Bucket and Key locate the S3 artifact RevisionID is a version of,
+	// empty for stages versioned by a Git commit or an image.
+	Bucket string `json:"bucket,omitempty" yaml:"bucket,omitempty"`
+	Key    string `json:"key,omitempty" yaml:"key,omitempty"`
+	// Metadata holds every metadata value of the S3 artifact, only filled
+	// in when asked for.
+	Metadata map[string]string `json:"metadata,omitempty" yaml:"metadata,omitempty"`
+	// IncompleteMetadata is set when the artifact lacks the version or
+	// commit metadata, or its version was deleted, a placeholder stands in
+	// for it.
+	IncompleteMetadata bool `json:"incompleteMetadata,omitempty" yaml:"incompleteMetadata,omitempty"`
+	// Checksum tells whether the artifact matches the checksum recorded in
+	// its metadata, only set with --verify-checksum.
+	Checksum *checksumDetails `json:"checksum,omitempty" yaml:"checksum,omitempty"`
+	// Signature tells whether the signature of the artifact verifies, only
+	// set with --verify-signature.
+	Signature *signatureDetails `json:"signature,omitempty" yaml:"signature,omitempty"`
+	// Branch is the branch of the Git source of the pipeline, or the
+	// Branch metadata of the S3 artifact.
+	Branch string `json:"branch" yaml:"branch"`
+	// Repository is the repository of the Git or ECR source the version
+	// comes from, e.g. owner/name on GitHub.
+	Repository string `json:"repository,omitempty" yaml:"repository,omitempty"`
+
+	// LastStatusChange is the most recent status change of any of the
+	// stage actions, null if none of them ever ran.
+	LastStatusChange *time.Time `json:"lastStatusChange" yaml:"lastStatusChange"`
+
+	// Stuck is set when the stage is in progress without a status change
+	// for longer than --stuck-after.
+	Stuck bool `json:"stuck,omitempty" yaml:"stuck,omitempty"`
+
+	// StatusReason tells why the latest execution of a failed or stopped
+	// stage ended, StoppedBy who stopped it manually.
+	StatusReason string `json:"statusReason,omitempty" yaml:"statusReason,omitempty"`
+	StoppedBy    string `json:"stoppedBy,omitempty" yaml:"stoppedBy,omitempty"`
+
+	// StaleDefinition is set when the pipeline definition changed after
+	// the latest execution of the stage started, or, for stages that never
+	// ran, after the latest execution of the pipeline.
+	StaleDefinition bool `json:"staleDefinition,omitempty" yaml:"staleDefinition,omitempty"`
+
+	// TransitionDisabled is set when the transition into the stage is
+	// disabled.
+	TransitionDisabled bool `json:"transitionDisabled,omitempty" yaml:"transitionDisabled,omitempty"`
+	// TransitionDisabledReason and TransitionDisabledBy tell why and by
+	// whom it was disabled.
+	TransitionDisabledReason string `json:"transitionDisabledReason,omitempty" yaml:"transitionDisabledReason,omitempty"`
+	TransitionDisabledBy     string `json:"transitionDisabledBy,omitempty" yaml:"transitionDisabledBy,omitempty"`
+
+	// Actions lists the stage actions, only filled in when asked for.
+	Actions []actionDetails `json:"actions,omitempty" yaml:"actions,omitempty"`
+
+	// Targets lists what the deploy actions of the stage deploy to.
+	Targets []deployTarget `json:"targets,omitempty" yaml:"targets,omitempty"`
+
+	// Links points at the external executions of the stage actions, e.g.
+	// CodeBuild builds.
+	Links []externalLink `json:"links,omitempty" yaml:"links,omitempty"`
+
+	// Superseded is set when a newer execution superseded the latest
+	// execution of the stage before it completed. Version and the fields
+	// next to it then describe the last execution that completed the
+	// stage.
+	Superseded *supersededDetails `json:"superseded,omitempty" yaml:"superseded,omitempty"`
+
+	// Rollback is set when the latest execution of the stage rolled it
+	// back to an earlier artifact, the one Version describes.
+	Rollback *rollbackDetails `json:"rollback,omitempty" yaml:"rollback,omitempty"`
+
+	// Approval describes the manual approval gating the stage, if any.
+	Approval *approvalDetails `json:"approval,omitempty" yaml:"approval,omitempty"`
+
+	// Errors lists the failures of the stage actions, only filled in when
+	// asked for.
+	Errors []stageError `json:"errors,omitempty" yaml:"errors,omitempty"`
+
+	// Trigger tells what started the latest execution of the stage.
+	Trigger *trigger `json:"trigger,omitempty" yaml:"trigger,omitempty"`
+
+	// Artifacts lists the source artifacts of the latest execution of the
+	// stage, only filled in for pipelines with several sources. Version,
+	// Commit and ReleaseURL above describe the artifact of Bucket and Key.
+	Artifacts []artifactDetails `json:"artifacts,omitempty" yaml:"artifacts,omitempty"`
+
+	// Timing spans the action executions of the latest execution of the
+	// stage, only filled in when asked for.
+	Timing *stageTiming `json:"timing,omitempty" yaml:"timing,omitempty"`
+
+	// Behind counts the releases started after the latest execution of
+	// the stage, only filled in when asked for.
+	Behind *behindCount `json:"behind,omitempty" yaml:"behind,omitempty"`
+
+	// DeployedAt is when the last deploy action of the latest execution
+	// of the stage succeeded, only filled in when asked for.
+	DeployedAt *time.Time `json:"deployedAt,omitempty" yaml:"deployedAt,omitempty"`
+	// DeployedFor is how many seconds ago DeployedAt was, null when the
+	// deploy time is unknown.
+	DeployedFor *int64 `json:"deployedForSeconds" yaml:"deployedForSeconds"`
+	// BuiltAt is when the S3 artifact version was uploaded.
+	BuiltAt *time.Time `json:"builtAt" yaml:"builtAt"`
+
+	// Variables holds the pipeline variables the latest execution of the
+	// stage was started with.
+	Variables map[string]string `json:"variables,omitempty" yaml:"variables,omitempty"`
+
+	// Inbound lists the executions waiting to enter the stage, oldest
+	// first.
+	Inbound []inboundExecution `json:"inbound,omitempty" yaml:"inbound,omitempty"`
+
+	// Error describes why the stage couldn't be fully resolved.
+	Error string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// neverExecuted is shown as the status of stages that never ran, e.g. just
+// added to the pipeline.
+const neverExecuted = "Never executed"
+
+// displayStatus returns the status of the stage as shown to people.
+func (d stageDetails) displayStatus() string {
+	if d.Status == "" && d.ExecutionID == "" {
+		return neverExecuted
+	}
+	return d.Status
+}
+
+// getStageDetails walks every stage of the configured pipeline and resolves
+// the artifact version deployed by its latest execution. The execution mode
+// of the pipeline is returned along with the stages.
+//
+// A failed lookup for a single stage is recorded in its Error field instead
+// of aborting the whole walk, unless cfg.FailFast is set. onStage, if not
+// nil, is called with each stage as soon as it and the ones before it are
+// resolved.
+func getStageDetails(sess *session.Session, cfg Cfg, onStage func(stageDetails)) ([]stageDetails, string, error) {
+	// =========================================================================
+	// Codepipeline state
+	pipelnsvc := codepipeline.New(sess)
+	pipelnStateInput := &codepipeline.GetPipelineStateInput{
+		Name: aws.String(cfg.PipelineName),
+	}
+
+	state, err := pipelnsvc.GetPipelineState(pipelnStateInput)
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			switch aerr.Code() {
+			default:
+				return nil, "", fmt.Errorf("failed to get pipeline state: %s", aerr.Message())
+			}
+		}
+		return nil, "", err
+	}
+
+	filter := newStageFilter(cfg.Stages, cfg.ExcludeStages)
+	if err := filter.check(cfg.PipelineName, state.StageStates); err != nil {
+		return nil, "", err
+	}
+
+	// The pipeline structure tells the action types apart, the state only
+	// carries their names.
+	pipeline, metadata, err := describePipeline(pipelnsvc, cfg.PipelineName)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// In PARALLEL and QUEUED mode several executions are in flight at once,
+	// the one on the Source stage says nothing about the other stages.
+	mode := executionMode(pipeline)
+	concurrent := mode != codepipeline.ExecutionModeSuperseded
+
+	if err := discoverArtifact(pipeline, &cfg); err != nil {
+		return nil, "", err
+	}
+	source := findVersionSource(pipeline, cfg.Bucket, cfg.Key)
+	// --artifact may move the version artifact as well
+	if loc, ok := explicitArtifactLocation(cfg, source.Artifact); ok {
+		cfg.Bucket, cfg.Key = loc.Bucket, loc.Key
+	}
+	sourceStage, err := sourceStageName(pipeline, cfg.SourceStage)
+	if err != nil {
+		return nil, "", err
+	}
+
+	execs := newExecutionCache(pipelnsvc, cfg.PipelineName)
+	locations := artifactLocations(pipeline, cfg)
+	sources := revisionSources(pipeline)
+	branch := sourceBranch(pipeline)
+
+	// the current execution as seen on the Source stage
+	var execId, revid string
+	for _, stage := range state.StageStates {
+		if aws.StringValue(stage.StageName) == sourceStage && !concurrent {
+			revid = currentRevision(stage.ActionStates, source)
+			if stage.LatestExecution != nil {
+				execId = aws.StringValue(stage.LatestExecution.PipelineExecutionId)
+			}
+		}
+	}
+
+	// skip stages the caller didn't ask about, saves the lookups below
+	var picked []*codepipeline.StageState
+	for _, stage := range state.StageStates {
+		if cfg.Stage != "" && aws.StringValue(stage.StageName) != cfg.Stage || filter.skip(aws.StringValue(stage.StageName)) {
+			continue
+		}
+		picked = append(picked, stage)
+	}
+
+	// resolve returns the details of a stage. A failed lookup is recorded
+	// in its Error field, the last one is returned as well.
+	resolve := func(stage *codepipeline.StageState) (stageDetails, error) {
+		cfg := cfg
+		expandStage(&cfg, aws.StringValue(stage.StageName))
+
+		var failure error
+		details := stageDetails{
+			Name: aws.StringValue(stage.StageName),
+		}
+		// stages that never ran have no execution to look at
+		if stage.LatestExecution != nil {
+			details.ExecutionID = aws.StringValue(stage.LatestExecution.PipelineExecutionId)
+			details.Status = aws.StringValue(stage.LatestExecution.Status)
+			details.Branch = branch
+			if details.Status == codepipeline.StageExecutionStatusStopped {
+				details.StoppedBy = getStoppedBy(stage.ActionStates)
+			}
+		}
+		details.LastStatusChange = lastStatusChange(stage.ActionStates)
+		details.Stuck = isStuck(details.Status, details.LastStatusChange, time.Now(), cfg.StuckAfter)
+		if cfg.Actions {
+			details.Actions = getActionDetails(stage.ActionStates)
+		}
+		details.Links = getExternalLinks(stage.ActionStates)
+		details.Targets = getTargets(pipeline, details.Name)
+		details.Approval = getApproval(pipeline, details.Name, stage.ActionStates)
+		details.Inbound = getInbound(execs, source, sess, cfg, stage)
+		if cfg.ShowErrors {
+			details.Errors = getStageErrors(stage.ActionStates, cfg.ErrorLength)
+		}
+		if t := stage.InboundTransitionState; t != nil && t.Enabled != nil {
+			details.TransitionDisabled = !*t.Enabled
+			if details.TransitionDisabled {
+				details.TransitionDisabledReason = aws.StringValue(t.DisabledReason)
+				details.TransitionDisabledBy = aws.StringValue(t.LastChangedBy)
+			}
+		}
+		if (cfg.Durations || cfg.DeployedAt || cfg.DeployedFor) && details.ExecutionID != "" {
+			actions, err := execs.actionExecutions(details.ExecutionID)
+			if err != nil {
+				details.Error, failure = err.Error(), err
+			}
+			if cfg.Durations {
+				details.Timing = getStageTiming(details.Name, actions)
+			}
+			if cfg.DeployedAt || cfg.DeployedFor {
+				details.DeployedAt = getDeployedAt(details.Name, actions)
+				details.DeployedFor = deployedFor(details.DeployedAt, time.Now())
+			}
+		}
+		if cfg.Behind && details.ExecutionID != "" {
+			behind, err := getBehind(execs, details.ExecutionID, cfg.Lookback)
+			if err != nil {
+				details.Error, failure = err.Error(), err
+			}
+			details.Behind = behind
+		}
+		if details.ExecutionID != "" {
+			if err := resolveStage(execs, locations, sources, source, sess, cfg, &details, execId, revid); err != nil {
+				details.Error, failure = err.Error(), err
+			}
+		}
+		// ECS stages are versioned by the images they rolled out, those of
+		// the execution that completed the stage
+		if execID := details.deployedExecution(); cfg.ImageDefinitions && execID != "" && hasECSDeploy(pipeline, details.Name) {
+			containers, err := getContainerImages(execs, sess, cfg, details.Name, execID)
+			if err != nil {
+				details.Error, failure = err.Error(), err
+			} else if len(containers) > 0 {
+				details.Containers = containers
+				details.Version = containersVersion(containers)
+			}
+		}
+		// a succeeded deploy doesn't mean the services still run it
+		if cfg.VerifyECS && details.ExecutionID != "" {
+			details.Runtime = verifyServices(sess, cfg, details)
+		}
+		if len(cfg.LambdaFunction) > 0 && details.ExecutionID != "" {
+			details.Functions = verifyFunctions(sess, cfg, details)
+		}
+		if cfg.VerifyBeanstalk && details.ExecutionID != "" {
+			details.Environments = verifyEnvironments(sess, cfg, details)
+		}
+		if cfg.VerifyCodeDeploy && details.ExecutionID != "" {
+			details.Deployments = verifyDeployments(execs, sess, cfg, details)
+		}
+		if len(cfg.Check) > 0 && details.ExecutionID != "" {
+			details.Endpoints = checkEndpoints(cfg, details)
+		}
+		// unlike the checks above, the recorded version is worth showing for
+		// stages that never ran too
+		if len(cfg.SSMParameter) > 0 {
+			details.Parameter = checkParameter(sess, cfg, details)
+		}
+		if execID := details.deployedExecution(); cfg.ShowBuild && execID != "" {
+			build, err := getBuild(execs, sess, cfg.Region, execID)
+			if err != nil {
+				details.Error, failure = err.Error(), err
+			}
+			details.Build = build
+		}
+		return details, failure
+	}
+
+	// Stages are resolved --stage-concurrency at a time but handed to
+	// onStage in pipeline order, resolved[i] is closed once stage i is.
+	stages := make([]stageDetails, len(picked))
+	errs := make([]error, len(picked))
+	resolved := make([]chan struct{}, len(picked))
+	for i := range resolved {
+		resolved[i] = make(chan struct{})
+	}
+	concurrency := cfg.StageConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var wg sync.WaitGroup
+	var abort atomic.Bool
+	go func() {
+		sem := make(chan struct{}, concurrency)
+		for i, stage := range picked {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(i int, stage *codepipeline.StageState) {
+				defer func() {
+					<-sem
+					close(resolved[i])
+					wg.Done()
+				}()
+				// with --fail-fast the stages left are not worth looking up
+				if abort.Load() {
+					return
+				}
+				stages[i], errs[i] = resolve(stage)
+			}(i, stage)
+		}
+	}()
+
+	var failure error
+	for i := range picked {
+		<-resolved[i]
+		if failure != nil {
+			continue
+		}
+		if errs[i] != nil && cfg.FailFast {
+			failure = errs[i]
+			abort.Store(true)
+			continue
+		}
+		if onStage != nil {
+			onStage(stages[i])
+		}
+	}
+	wg.Wait()
+	if failure != nil {
+		return nil, "", failure
+	}
+
+	if cfg.Stage != "" && len(stages) == 0 {
+		return nil, "", fmt.Errorf("stage %q not found in pipeline %s", cfg.Stage, cfg.PipelineName)
+	}
+
+	markPositions(stages)
+
+	if metadata != nil {
+		if err := markStale(execs, stages, metadata.Updated); err != nil {
+			return nil, "", err
+		}
+	}
+
+	return stages, mode, nil
+}
+
+// resolveStage finds the artifact revision deployed by the latest execution
+// of a stage and fills in its version metadata, trigger, variables and, for
+// pipelines with several sources, every artifact. source is where the
+// version artifact comes from, execId and revid identify the current
+// execution as seen on the Source stage.
+func resolveStage(execs *executionCache, locations map[string]s3Location, sources map[string]versionSource, source versionSource, sess *session.Session, cfg Cfg, details *stageDetails, execId, revid string) error {
+	exec, err := execs.get(details.ExecutionID)
+	if err != nil {
+		return err
+	}
+	details.Trigger = getTrigger(exec)
+	details.Variables = getVariables(exec)
+	details.Artifacts = getArtifacts(sess, cfg, locations, sources, exec.ArtifactRevisions)
+	if source.byRevision() {
+		details.Repository = source.Repository
+	}
+	if hasStatusReason(details.Status) {
+		if details.StatusReason, err = getStatusReason(execs, exec); err != nil {
+			return err
+		}
+	}
+	if details.Rollback, err = getRollback(execs, source, sess, cfg, exec); err != nil {
+		return err
+	}
+
+	// if stage is from current pipeline execution save revision Id
+	if execId == details.ExecutionID {
+		details.RevisionID = revid
+	}
+	// if stage was executed earlier - not in this run - retrieve
+	// revision id from that execution
+	if details.RevisionID == "" {
+		details.RevisionID = execs.revision(exec, source)
+	}
+	rexec := exec
+
+	// a superseded execution never finished the stage, what runs there
+	// came with the last execution that did
+	if isSuperseded(details, exec) {
+		by, deployed, err := findSuperseding(execs, details.Name, details.ExecutionID)
+		if err != nil {
+			return err
+		}
+		details.Status = codepipeline.PipelineExecutionStatusSuperseded
+		sup := &supersededDetails{By: by, DeployedExecutionID: deployed, RevisionID: details.RevisionID}
+		meta, err := readVersion(sess, cfg, source, sup.RevisionID)
+		if err != nil {
+			return err
+		}
+		sup.Version, sup.Commit = meta.Version, meta.Commit
+		details.Superseded = sup
+
+		details.RevisionID = ""
+		if deployed == "" {
+			return nil
+		}
+		dexec, err := execs.get(deployed)
+		if err != nil {
+			return err
+		}
+		details.RevisionID = execs.revision(dexec, source)
+		rexec = dexec
+	}
+
+	meta, err := readVersion(sess, cfg, source, details.RevisionID)
+	if err != nil {
+		return err
+	}
+	details.Version, details.Commit, details.ReleaseURL = meta.Version, meta.Commit, meta.ReleaseURL
+	details.CommitMessage, details.CommitAuthor, details.CommitDate = meta.Message, meta.Author, meta.Date
+	details.Image = meta.Image
+	details.VersionSource = meta.Source
+	if details.RevisionID != "" && cfg.Bucket != "" && !source.byRevision() {
+		details.Bucket, details.Key = cfg.Bucket, cfg.Key
+	}
+	details.Metadata = meta.Metadata
+	details.IncompleteMetadata = meta.Incomplete
+	details.Checksum, details.Signature = meta.Checksum, meta.Signature
+	details.BuiltAt = meta.BuiltAt
+	// Git sources have no release, their commit on the host will do
+	if details.ReleaseURL == "" {
+		details.ReleaseURL = revisionURL(rexec, details.RevisionID)
+	}
+	if meta.Branch != "" {
+		details.Branch = meta.Branch
+	}
+	return nil
+}
+
+// versionUnknown is shown as the version of stages whose revision couldn't
+// be told.
+const versionUnknown = "version unknown"
+
+// versionMeta is the version metadata of an artifact revision.
+type versionMeta struct {
+	Version    string
+	Commit     string
+	ReleaseURL string
+	// Branch is optional, only set when the artifact was uploaded with it.
+	Branch string
+	// Message, Author and Date describe the commit.
+	Message string
+	Author  string
+	Date    *time.Time
+	// Image describes the image of an ECR revision.
+	Image *imageDetails
+	// Source tells where the version of an S3 artifact was read from.
+	Source string
+	// Metadata holds every metadata value of an S3 artifact, only filled
+	// in when asked for.
+	Metadata map[string]string
+	// BuiltAt is when the S3 artifact version was uploaded.
+	BuiltAt *time.Time
+	// Incomplete is set when the version or commit is a placeholder for
+	// missing metadata or a deleted artifact version.
+	Incomplete bool
+	// Checksum and Signature are the outcomes of --verify-checksum and
+	// --verify-signature.
+	Checksum  *checksumDetails
+	Signature *signatureDetails
+}
+
+// readVersion reads the version metadata of a revision of source. Without
+// an artifact to read from it is left empty, without a revision it is
+// versionUnknown.
+func readVersion(sess *session.Session, cfg Cfg, source versionSource, revision string) (versionMeta, error) {
+	if revision == "" && (source.byRevision() || cfg.Bucket != "") {
+		return versionMeta{Version: versionUnknown}, nil
+	}
+
+	switch source.Provider {
+	case providerCodeCommit:
+		return readCommit(sess, cfg, source.Repository, revision)
+	case providerCodeStar:
+		return readGitHubCommit(cfg, source.Repository, revision)
+	case providerECR:
+		return readImage(sess, cfg, source, revision)
+	}
+
+	// no artifact to read version metadata from, leave the version empty
+	if cfg.Bucket == "" {
+		return versionMeta{}, nil
+	}
+
+	meta, from, builtAt, err := getMetadataFromRevision(sess, cfg, revision)
+	// a deleted artifact version leaves the stage degraded, not failed
+	if version, deleted, ok := unavailableVersion(err); ok {
+		return versionMeta{Version: version, Incomplete: deleted}, nil
+	}
+	if err != nil {
+		return versionMeta{}, fmt.Errorf("get metadata from file revision: %w", err)
+	}
+	// a missing key doesn't stop the stage from being reported, it only
+	// gets a placeholder; no commit is expected without a commit key
+	var incomplete bool
+	version := metaValue(meta, versionKeys(cfg))
+	if version == "" {
+		version, incomplete = noVersionMetadata, true
+	}
+	commit := metaValue(meta, commitKeys(cfg))
+	if commit == "" && len(commitKeys(cfg)) > 0 {
+		commit, incomplete = noCommitMetadata, true
+	}
+
+	var metadata map[string]string
+	if cfg.ShowMetadata {
+		metadata = metadataValues(meta)
+	}
+
+	vmeta := versionMeta{
+		Version:    version,
+		Commit:     commit,
+		ReleaseURL: aws.StringValue(meta["Release-Url"]),
+		Branch:     aws.StringValue(meta["Branch"]),
+		Source:     from,
+		Metadata:   metadata,
+		BuiltAt:    builtAt,
+		Incomplete: incomplete,
+	}
+	if cfg.VerifyChecksum {
+		vmeta.Checksum = verifyChecksum(sess, cfg, revision, meta)
+	}
+	if cfg.VerifySignature {
+		vmeta.Signature = verifySignature(sess, cfg, revision, meta)
+	}
+	provider, repo := commitRepository(cfg)
+	describeCommit(sess, cfg, &vmeta, provider, repo)
+	return vmeta, nil
+}
+
+// executionCache memoizes GetPipelineExecution of a single pipeline,
+// stages often share an execution. Stages are resolved concurrently, mu
+// guards the maps and listMu the history, held while listing so pages are
+// only fetched once.
+type executionCache struct {
+	pipelnsvc *codepipeline.CodePipeline
+	pipeline  string
+
+	mu      sync.Mutex
+	execs   map[string]*codepipeline.PipelineExecution
+	actions map[string][]*codepipeline.ActionExecutionDetail
+
+	listMu  sync.Mutex
+	history []*codepipeline.PipelineExecutionSummary
+	next    *string
+	listed  bool
+}
+
+func newExecutionCache(pipelnsvc *codepipeline.CodePipeline, pipeline string) *executionCache {
+	return &executionCache{
+		pipelnsvc: pipelnsvc,
+		pipeline:  pipeline,
+		execs:     make(map[string]*codepipeline.PipelineExecution),
+		actions:   make(map[string][]*codepipeline.ActionExecutionDetail),
+	}
+}
+
+// get returns the pipeline execution with the given id.
+func (c *executionCache) get(execID string) (*codepipeline.PipelineExecution, error) {
+	c.mu.Lock()
+	exec, ok := c.execs[execID]
+	c.mu.Unlock()
+	if ok {
+		return exec, nil
+	}
+
+	exec, err := getPipelineExecution(c.pipelnsvc, c.pipeline, execID)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.execs[execID] = exec
+	c.mu.Unlock()
+	return exec, nil
+}
+
+// historyLookback is how many past executions are searched for the ones a
+// stage relates to, e.g. the execution that superseded it.
+const historyLookback = 100
+
+// summaries returns up to the n latest executions of the pipeline, newest
+// first. Pages are only listed as far as needed and kept for later calls.
+func (c *executionCache) summaries(n int) ([]*codepipeline.PipelineExecutionSummary, error) {
+	c.listMu.Lock()
+	defer c.listMu.Unlock()
+
+	for len(c.history) < n && !c.listed {
+		page := n - len(c.history)
+		if page > 100 {
+			page = 100
+		}
+		out, err := c.pipelnsvc.ListPipelineExecutions(&codepipeline.ListPipelineExecutionsInput{
+			PipelineName: aws.String(c.pipeline),
+			MaxResults:   aws.Int64(int64(page)),
+			NextToken:    c.next,
+		})
+		if err != nil {
+			if aerr, ok := err.(awserr.Error); ok {
+				switch aerr.Code() {
+				default:
+					return nil, fmt.Errorf("failed to list pipeline executions: %s", aerr.Message())
+				}
+			}
+			return nil, err
+		}
+
+		c.history = append(c.history, out.PipelineExecutionSummaries...)
+		c.next = out.NextToken
+		c.listed = c.next == nil
+	}
+
+	if len(c.history) > n {
+		return c.history[:n], nil
+	}
+	return c.history, nil
+}
+
+// getPipelineExecution returns the execution of the named pipeline with the
+// given id.
+func getPipelineExecution(pipelnsvc *codepipeline.CodePipeline, pipeline, execID string) (*codepipeline.PipelineExecution, error) {
+	pipelineExecutionInput := &codepipeline.GetPipelineExecutionInput{
+		PipelineExecutionId: aws.String(execID),
+		PipelineName:        aws.String(pipeline),
+	}
+
+	execution, err := pipelnsvc.GetPipelineExecution(pipelineExecutionInput)
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			switch aerr.Code() {
+			default:
+				return nil, fmt.Errorf("failed to get pipeline execution: %s", aerr.Message())
+			}
+		}
+		return nil, err
+	}
+
+	return execution.PipelineExecution, nil
+}
+
+// artifactRevision returns the revision id of the version artifact used by
+// a pipeline execution, the one named after the output artifact of
+// source. Without one the last revision that looks like an S3 one is
+// taken.
+func artifactRevision(exec *codepipeline.PipelineExecution, source versionSource) string {
+	var revid string
+	for _, revision := range exec.ArtifactRevisions {
+		if source.Artifact != "" {
+			if aws.StringValue(revision.Name) == source.Artifact {
+				return aws.StringValue(revision.RevisionId)
+			}
+			continue
+		}
+		if isS3Revision(revision) {
+			revid = aws.StringValue(revision.RevisionId)
+		}
+	}
+	return revid
+}
+
+// revision returns the revision id of the version artifact used by a
+// pipeline execution. Older executions may not tell it in their artifact
+// revisions, it is then read from the execution of the source action. The
+// revision is empty if neither tells, a failed lookup leaves it to the
+// version to show it's unknown rather than failing the stage.
+func (c *executionCache) revision(exec *codepipeline.PipelineExecution, source versionSource) string {
+	if revid := artifactRevision(exec, source); revid != "" {
+		return revid
+	}
+
+	actions, err := c.actionExecutions(aws.StringValue(exec.PipelineExecutionId))
+	if err != nil {
+		return ""
+	}
+	return sourceActionRevision(actions, source)
+}
+
+// revisionVariables names the output variables of the source actions of
+// each provider holding the revision.
+var revisionVariables = map[string][]string{
+	"S3":               {"VersionId", "ETag"},
+	providerCodeCommit: {"CommitId"},
+	providerCodeStar:   {"CommitId"},
+	providerECR:        {"ImageDigest"},
+}
+
+// sourceActionRevision returns the revision the source action read in
+// actions, the action executions of a pipeline execution. Without a source
+// action from the pipeline definition the S3 one is taken.
+func sourceActionRevision(actions []*codepipeline.ActionExecutionDetail, source versionSource) string {
+	for _, action := range actions {
+		if action.Output == nil || action.Input == nil || action.Input.ActionTypeId == nil {
+			continue
+		}
+		id := action.Input.ActionTypeId
+		if aws.StringValue(id.Category) != codepipeline.ActionCategorySource {
+			continue
+		}
+		provider := aws.StringValue(id.Provider)
+		if source.found() && aws.StringValue(action.ActionName) != source.Action || !source.found() && provider != "S3" {
+			continue
+		}
+
+		for _, name := range revisionVariables[provider] {
+			if v := aws.StringValue(action.Output.OutputVariables[name]); v != "" {
+				return v
+			}
+		}
+		// source actions report the revision as their external execution
+		if r := action.Output.ExecutionResult; r != nil {
+			return aws.StringValue(r.ExternalExecutionId)
+		}
+	}
+	return ""
+}
+
+// currentRevision returns the revision the source action is at, given the
+// action states of its stage. Without a source action from the pipeline
+// definition the S3 one is recognized by its console link.
+func currentRevision(actions []*codepipeline.ActionState, source versionSource) string {
+	for _, astate := range actions {
+		if astate.CurrentRevision == nil {
+			continue
+		}
+		if source.found() {
+			if aws.StringValue(astate.ActionName) == source.Action {
+				return aws.StringValue(astate.CurrentRevision.RevisionId)
+			}
+			continue
+		}
+		if urlRe.MatchString(aws.StringValue(astate.EntityUrl)) {
+			return aws.StringValue(astate.CurrentRevision.RevisionId)
+		}
+	}
+	return ""
+}
+
+// revisionURL returns the link to the artifact revision revid of a
+// pipeline execution, e.g. the commit on GitHub, empty if it has none.
+func revisionURL(exec *codepipeline.PipelineExecution, revid string) string {
+	for _, revision := range exec.ArtifactRevisions {
+		if revid != "" && aws.StringValue(revision.RevisionId) == revid {
+			return aws.StringValue(revision.RevisionUrl)
+		}
+	}
+	return ""
+}
+
+// getStageState returns the state of a single stage of the named pipeline.
+func getStageState(ctx aws.Context, pipelnsvc *codepipeline.CodePipeline, pipeline, stage string) (*codepipeline.StageState, error) {
+	state, err := pipelnsvc.GetPipelineStateWithContext(ctx, &codepipeline.GetPipelineStateInput{
+		Name: aws.String(pipeline),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			switch aerr.Code() {
+			default:
+				return nil, fmt.Errorf("failed to get pipeline state: %s", aerr.Message())
+			}
+		}
+		return nil, err
+	}
+
+	for _, s := range state.StageStates {
+		if aws.StringValue(s.StageName) == stage {
+			return s, nil
+		}
+	}
+	return nil, fmt.Errorf("stage %q not found in pipeline %s", stage, pipeline)
+}
+
+// getPipeline returns the structure of the named pipeline.
+func getPipeline(pipelnsvc *codepipeline.CodePipeline, name string) (*codepipeline.PipelineDeclaration, error) {
+	pipeline, _, err := describePipeline(pipelnsvc, name)
+	return pipeline, err
+}
+
+// describePipeline returns the structure of the named pipeline along with
+// its metadata, e.g. when it was last updated.
+func describePipeline(pipelnsvc *codepipeline.CodePipeline, name string) (*codepipeline.PipelineDeclaration, *codepipeline.PipelineMetadata, error) {
+	out, err := pipelnsvc.GetPipeline(&codepipeline.GetPipelineInput{
+		Name: aws.String(name),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			switch aerr.Code() {
+			default:
+				return nil, nil, fmt.Errorf("failed to get pipeline: %s", aerr.Message())
+			}
+		}
+		return nil, nil, err
+	}
+	return out.Pipeline, out.Metadata, nil
+}
+
+// artifactLocation returns the bucket and key of the S3 source action of a
+// pipeline, both empty if the pipeline has none.
+func artifactLocation(pipeline *codepipeline.PipelineDeclaration) (string, string) {
+	for _, stage := range pipeline.Stages {
+		for _, action := range stage.Actions {
+			id := action.ActionTypeId
+			if id == nil || aws.StringValue(id.Category) != codepipeline.ActionCategorySource || aws.StringValue(id.Provider) != "S3" {
+				continue
+			}
+			bucket := aws.StringValue(action.Configuration["S3Bucket"])
+			key := aws.StringValue(action.Configuration["S3ObjectKey"])
+			if bucket != "" && key != "" {
+				return bucket, key
+			}
+		}
+	}
+
+	return "", ""
+}
+
+// discoverArtifact sets the bucket and key of the version artifact to those
+// of the S3 source action of the pipeline, unless a bucket is configured.
+// Pipelines sourced from Git or ECR only need no bucket, their commits or
+// images are the version. The pipeline and region placeholders of a
+// configured location are expanded.
+func discoverArtifact(pipeline *codepipeline.PipelineDeclaration, cfg *Cfg) error {
+	if cfg.Bucket != "" {
+		expandPipeline(cfg)
+		return nil
+	}
+
+	cfg.Bucket, cfg.Key = artifactLocation(pipeline)
+	if cfg.Bucket == "" && len(revisionSources(pipeline)) == 0 {
+		return fmt.Errorf("pipeline %s has no S3, Git or ECR source action to read the version from, set --bucket and --key", cfg.PipelineName)
+	}
+	return nil
+}
+
+// versionSource names the source action the version comes from and its
+// output artifact, which tell its revision apart when a pipeline has
+// several sources. Provider tells how to read the version of a revision,
+// Repository is set for Git and ECR sources, Tag for ECR ones.
+type versionSource struct {
+	Action     string
+	Artifact   string
+	Provider   string
+	Repository string
+	Tag        string
+}
+
+// found reports whether the source action is known from the pipeline
+// definition.
+func (s versionSource) found() bool {
+	return s.Action != ""
+}
+
+// byRevision reports whether the revision itself is the version, a Git
+// commit or an ECR image digest, rather than an S3 object version to read
+// the metadata of.
+func (s versionSource) byRevision() bool {
+	return isRevisionProvider(s.Provider)
+}
+
+// isRevisionProvider reports whether provider is a source action provider
+// whose revisions are the version, see versionSource.byRevision.
+func isRevisionProvider(provider string) bool {
+	switch provider {
+	case providerCodeCommit, providerCodeStar, providerECR:
+		return true
+	}
+	return false
+}
+
+// newVersionSource describes the source action.
+func newVersionSource(action *codepipeline.ActionDeclaration) versionSource {
+	src := versionSource{
+		Action:     aws.StringValue(action.Name),
+		Provider:   aws.StringValue(action.ActionTypeId.Provider),
+		Repository: aws.StringValue(action.Configuration["RepositoryName"]),
+	}
+	switch src.Provider {
+	case providerCodeStar:
+		src.Repository = aws.StringValue(action.Configuration["FullRepositoryId"])
+	case providerECR:
+		// the source action watches latest unless told otherwise
+		src.Tag = aws.StringValue(action.Configuration["ImageTag"])
+		if src.Tag == "" {
+			src.Tag = "latest"
+		}
+	}
+	if len(action.OutputArtifacts) > 0 {
+		src.Artifact = aws.StringValue(action.OutputArtifacts[0].Name)
+	}
+	return src
+}
+
+// revisionSources maps the output artifacts of the Git and ECR source
+// actions of a pipeline to their source.
+func revisionSources(pipeline *codepipeline.PipelineDeclaration) map[string]versionSource {
+	sources := make(map[string]versionSource)
+	for _, stage := range pipeline.Stages {
+		for _, action := range stage.Actions {
+			id := action.ActionTypeId
+			if id == nil || aws.StringValue(id.Category) != codepipeline.ActionCategorySource || !isRevisionProvider(aws.StringValue(id.Provider)) {
+				continue
+			}
+			src := newVersionSource(action)
+			for _, out := range action.OutputArtifacts {
+				src.Artifact = aws.StringValue(out.Name)
+				sources[src.Artifact] = src
+			}
+		}
+	}
+	return sources
+}
+
+// findVersionSource returns the source action of the pipeline the version
+// comes from: the S3 source reading bucket and key or, without a bucket,
+// the first Git or ECR source. It is empty if there is none, e.g. for a bucket
+// set by hand.
+func findVersionSource(pipeline *codepipeline.PipelineDeclaration, bucket, key string) versionSource {
+	for _, stage := range pipeline.Stages {
+		for _, action := range stage.Actions {
+			id := action.ActionTypeId
+			if id == nil || aws.StringValue(id.Category) != codepipeline.ActionCategorySource {
+				continue
+			}
+			provider := aws.StringValue(id.Provider)
+			switch {
+			case provider == "S3" && bucket != "":
+				if aws.StringValue(action.Configuration["S3Bucket"]) != bucket || aws.StringValue(action.Configuration["S3ObjectKey"]) != key {
+					continue
+				}
+			case isRevisionProvider(provider) && bucket == "":
+			default:
+				continue
+			}
+			return newVersionSource(action)
+		}
+	}
+
+	return versionSource{}
+}
+
+// sourceBranch returns the branch of the first Git source action of a
+// pipeline, CodeCommit or a CodeStar connection, empty if it has none.
+func sourceBranch(pipeline *codepipeline.PipelineDeclaration) string {
+	for _, stage := range pipeline.Stages {
+		for _, action := range stage.Actions {
+			id := action.ActionTypeId
+			if id == nil || aws.StringValue(id.Category) != codepipeline.ActionCategorySource {
+				continue
+			}
+			if branch := aws.StringValue(action.Configuration["BranchName"]); branch != "" {
+				return branch
+			}
+		}
+	}
+
+	return ""
+}
+
+// executionMode returns the execution mode of a pipeline, V1 pipelines
+// don't report one and always supersede.
+func executionMode(pipeline *codepipeline.PipelineDeclaration) string {
+	if mode := aws.StringValue(pipeline.ExecutionMode); mode != "" {
+		return mode
+	}
+	return codepipeline.ExecutionModeSuperseded
+}
+
+// lastStatusChange returns the most recent status change across the given
+// action states, or nil if none of the actions has executed.
+func lastStatusChange(actions []*codepipeline.ActionState) *time.Time {
+	var last *time.Time
+	for _, astate := range actions {
+		if astate.LatestExecution == nil || astate.LatestExecution.LastStatusChange == nil {
+			continue
+		}
+		if t := astate.LatestExecution.LastStatusChange; last == nil || t.After(*last) {
+			last = t
+		}
+	}
+	return last
+}
@@ -0,0 +1,661 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/private/protocol/json/jsonutil"
+	"github.com/aws/aws-sdk-go/service/codepipeline"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// fakeAWS serves canned CodePipeline and S3 responses to the clients of the
+// session it returns and counts the calls made.
+type fakeAWS struct {
+	t testing.TB
+	// pipeline maps CodePipeline operations, e.g. GetPipelineState, to
+	// their response given the request body.
+	pipeline map[string]func(body string) interface{}
+	// objects maps bucket/key?versionId=v to the metadata of the S3 object
+	// version.
+	objects map[string]map[string]string
+	// delay is added to every response.
+	delay time.Duration
+
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+// session returns a session whose clients talk to f. Artifact versions
+// looked up by earlier tests are forgotten.
+func (f *fakeAWS) session() *session.Session {
+	srv := httptest.NewServer(http.HandlerFunc(f.serve))
+	f.t.Cleanup(srv.Close)
+
+	forgetMetadata()
+
+	return session.Must(session.NewSession(&aws.Config{
+		Region:           aws.String("eu-west-1"),
+		Endpoint:         aws.String(srv.URL),
+		S3ForcePathStyle: aws.Bool(true),
+		Credentials:      credentials.NewStaticCredentials("id", "secret", ""),
+		MaxRetries:       aws.Int(0),
+	}))
+}
+
+// forgetMetadata empties the cache of artifact versions looked up.
+func forgetMetadata() {
+	metadataCache.Lock()
+	metadataCache.m = make(map[string]*cachedMetadata)
+	metadataCache.Unlock()
+}
+
+func (f *fakeAWS) serve(w http.ResponseWriter, r *http.Request) {
+	time.Sleep(f.delay)
+
+	// CodePipeline speaks JSON, the operation is named by a header
+	if target := r.Header.Get("X-Amz-Target"); target != "" {
+		op := strings.TrimPrefix(target, "CodePipeline_20150709.")
+		f.count(op)
+
+		respond, ok := f.pipeline[op]
+		if !ok {
+			f.t.Errorf("unexpected CodePipeline call %s", op)
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, `{"__type":"ValidationException","message":"unexpected call %s"}`, op)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			f.t.Errorf("reading %s: %v", op, err)
+		}
+		out, err := encodeOutput(respond(string(body)))
+		if err != nil {
+			f.t.Errorf("encoding %s: %v", op, err)
+		}
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		w.Write(out)
+		return
+	}
+
+	// S3 is addressed path style, /bucket/key?versionId=v
+	f.count("S3 " + r.Method)
+	object := strings.TrimPrefix(r.URL.Path, "/") + "?versionId=" + r.URL.Query().Get("versionId")
+	meta, ok := f.objects[object]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	// objects carry no tags
+	if _, tagging := r.URL.Query()["tagging"]; tagging && r.Method == http.MethodGet {
+		fmt.Fprint(w, `<Tagging><TagSet></TagSet></Tagging>`)
+		return
+	}
+	if r.Method != http.MethodHead {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	for k, v := range meta {
+		w.Header().Set("X-Amz-Meta-"+k, v)
+	}
+	w.Header().Set("Last-Modified", time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC).Format(http.TimeFormat))
+}
+
+func (f *fakeAWS) count(call string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.calls == nil {
+		f.calls = make(map[string]int)
+	}
+	f.calls[call]++
+}
+
+// called returns how many times call was made.
+func (f *fakeAWS) called(call string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[call]
+}
+
+// encodeOutput encodes the output of a CodePipeline call the way the
+// service does. encoding/json can't: the SDK structs name their fields by
+// locationName tags and CodePipeline sends timestamps as epoch seconds. The
+// SDK encoder lives in a private package, so it is only used here.
+func encodeOutput(v interface{}) ([]byte, error) {
+	return jsonutil.BuildJSON(v)
+}
+
+// testCfg returns the configuration to look up pipeline with, the defaults
+// of the flags the lookup depends on.
+func testCfg(pipeline string) Cfg {
+	return Cfg{
+		PipelineName:     pipeline,
+		Region:           "eu-west-1",
+		BucketRegion:     "eu-west-1",
+		SourceStage:      "Source",
+		VersionKey:       "Release",
+		CommitKey:        "Commit",
+		StageConcurrency: 4,
+		S3Attempts:       1,
+	}
+}
+
+// s3SourcePipeline declares a pipeline with an S3 source action reading
+// bucket/app.zip followed by stages.
+func s3SourcePipeline(name, mode string, stages ...string) *codepipeline.PipelineDeclaration {
+	p := &codepipeline.PipelineDeclaration{
+		Name: aws.String(name),
+		Stages: []*codepipeline.StageDeclaration{{
+			Name: aws.String("Source"),
+			Actions: []*codepipeline.ActionDeclaration{{
+				Name: aws.String("Artifact"),
+				ActionTypeId: &codepipeline.ActionTypeId{
+					Category: aws.String(codepipeline.ActionCategorySource),
+					Owner:    aws.String(codepipeline.ActionOwnerAws),
+					Provider: aws.String("S3"),
+					Version:  aws.String("1"),
+				},
+				Configuration: map[string]*string{
+					"S3Bucket":    aws.String("bucket"),
+					"S3ObjectKey": aws.String("app.zip"),
+				},
+				OutputArtifacts: []*codepipeline.OutputArtifact{{Name: aws.String("SourceArtifact")}},
+			}},
+		}},
+	}
+	if mode != "" {
+		p.ExecutionMode = aws.String(mode)
+	}
+	for _, name := range stages {
+		p.Stages = append(p.Stages, &codepipeline.StageDeclaration{
+			Name: aws.String(name),
+			Actions: []*codepipeline.ActionDeclaration{{
+				Name: aws.String(name),
+				ActionTypeId: &codepipeline.ActionTypeId{
+					Category: aws.String(codepipeline.ActionCategoryDeploy),
+					Owner:    aws.String(codepipeline.ActionOwnerAws),
+					Provider: aws.String("S3"),
+					Version:  aws.String("1"),
+				},
+			}},
+		})
+	}
+	return p
+}
+
+// stageState is the state of a stage whose latest execution is execID.
+func stageState(name, execID, status string) *codepipeline.StageState {
+	return &codepipeline.StageState{
+		StageName: aws.String(name),
+		LatestExecution: &codepipeline.StageExecution{
+			PipelineExecutionId: aws.String(execID),
+			Status:              aws.String(status),
+		},
+		ActionStates: []*codepipeline.ActionState{{
+			ActionName: aws.String(name),
+			LatestExecution: &codepipeline.ActionExecution{
+				Status:           aws.String(status),
+				LastStatusChange: aws.Time(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)),
+			},
+		}},
+	}
+}
+
+// executions answers GetPipelineExecution with an execution per id in
+// revisions, which read that S3 object version of the source artifact.
+func executions(revisions map[string]string) func(string) interface{} {
+	return func(body string) interface{} {
+		for execID, revision := range revisions {
+			if strings.Contains(body, `"`+execID+`"`) {
+				return &codepipeline.GetPipelineExecutionOutput{
+					PipelineExecution: &codepipeline.PipelineExecution{
+						PipelineExecutionId: aws.String(execID),
+						Status:              aws.String(codepipeline.PipelineExecutionStatusInProgress),
+						ArtifactRevisions: []*codepipeline.ArtifactRevision{{
+							Name:            aws.String("SourceArtifact"),
+							RevisionId:      aws.String(revision),
+							RevisionSummary: aws.String("Amazon S3 version id: " + revision),
+						}},
+					},
+				}
+			}
+		}
+		return &codepipeline.GetPipelineExecutionOutput{}
+	}
+}
+
+func TestGetStageDetailsConcurrentExecutions(t *testing.T) {
+	for _, mode := range []string{codepipeline.ExecutionModeParallel, codepipeline.ExecutionModeQueued} {
+		t.Run(mode, func(t *testing.T) {
+			// three executions in flight, each stage shows its own; the
+			// source action already moved on to a fourth
+			source := stageState("Source", "exec-3", codepipeline.StageExecutionStatusSucceeded)
+			source.ActionStates[0].ActionName = aws.String("Artifact")
+			source.ActionStates[0].CurrentRevision = &codepipeline.ActionRevision{RevisionId: aws.String("v4")}
+			f := &fakeAWS{
+				t: t,
+				pipeline: map[string]func(string) interface{}{
+					"GetPipelineState": func(string) interface{} {
+						return &codepipeline.GetPipelineStateOutput{StageStates: []*codepipeline.StageState{
+							source,
+							stageState("Build", "exec-2", codepipeline.StageExecutionStatusInProgress),
+							stageState("Deploy", "exec-1", codepipeline.StageExecutionStatusInProgress),
+						}}
+					},
+					"GetPipeline": func(string) interface{} {
+						return &codepipeline.GetPipelineOutput{Pipeline: s3SourcePipeline("app", mode, "Build", "Deploy")}
+					},
+					"GetPipelineExecution": executions(map[string]string{"exec-1": "v1", "exec-2": "v2", "exec-3": "v3"}),
+				},
+				objects: map[string]map[string]string{
+					"bucket/app.zip?versionId=v1": {"Release": "1.1.0"},
+					"bucket/app.zip?versionId=v2": {"Release": "1.2.0"},
+					"bucket/app.zip?versionId=v3": {"Release": "1.3.0"},
+					"bucket/app.zip?versionId=v4": {"Release": "1.4.0"},
+				},
+			}
+
+			stages, gotMode, err := getStageDetails(f.session(), testCfg("app"), nil)
+			if err != nil {
+				t.Fatalf("getStageDetails: %v", err)
+			}
+			if gotMode != mode {
+				t.Errorf("mode = %q, want %q", gotMode, mode)
+			}
+
+			want := []struct{ name, execID, revision, version string }{
+				{"Source", "exec-3", "v3", "1.3.0"},
+				{"Build", "exec-2", "v2", "1.2.0"},
+				{"Deploy", "exec-1", "v1", "1.1.0"},
+			}
+			if len(stages) != len(want) {
+				t.Fatalf("got %d stages, want %d", len(stages), len(want))
+			}
+			for i, w := range want {
+				got := stages[i]
+				if got.Name != w.name || got.ExecutionID != w.execID || got.RevisionID != w.revision || got.Version != w.version {
+					t.Errorf("stage %d = %s %s %s %s, want %s %s %s %s", i, got.Name, got.ExecutionID, got.RevisionID, got.Version, w.name, w.execID, w.revision, w.version)
+				}
+			}
+			if n := f.called("GetPipelineExecution"); n != 3 {
+				t.Errorf("GetPipelineExecution called %d times, want once per execution", n)
+			}
+		})
+	}
+}
+
+func TestCurrentRevision(t *testing.T) {
+	actions := []*codepipeline.ActionState{
+		// a Git source next to the S3 one
+		{
+			ActionName:      aws.String("Code"),
+			EntityUrl:       aws.String("https://github.com/owner/app/tree/main"),
+			CurrentRevision: &codepipeline.ActionRevision{RevisionId: aws.String("3f1c2a9")},
+		},
+		{
+			ActionName:      aws.String("Artifact"),
+			EntityUrl:       aws.String("https://console.aws.amazon.com/s3/home?region=eu-west-1#"),
+			CurrentRevision: &codepipeline.ActionRevision{RevisionId: aws.String("v3")},
+		},
+		// never ran
+		{ActionName: aws.String("Config")},
+	}
+
+	tests := []struct {
+		name   string
+		source versionSource
+		want   string
+	}{
+		{"action type", findVersionSource(s3SourcePipeline("app", ""), "bucket", "app.zip"), "v3"},
+		{"console link", versionSource{}, "v3"},
+		{"git source", versionSource{Action: "Code", Provider: providerCodeStar}, "3f1c2a9"},
+		{"never ran", versionSource{Action: "Config", Provider: "S3"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := currentRevision(actions, tt.source); got != tt.want {
+				t.Errorf("currentRevision = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSourceActionRevision(t *testing.T) {
+	source := func(name, provider string, vars map[string]string, external string) *codepipeline.ActionExecutionDetail {
+		out := &codepipeline.ActionExecutionOutput{OutputVariables: aws.StringMap(vars)}
+		if external != "" {
+			out.ExecutionResult = &codepipeline.ActionExecutionResult{ExternalExecutionId: aws.String(external)}
+		}
+		return &codepipeline.ActionExecutionDetail{
+			ActionName: aws.String(name),
+			Input: &codepipeline.ActionExecutionInput{ActionTypeId: &codepipeline.ActionTypeId{
+				Category: aws.String(codepipeline.ActionCategorySource),
+				Provider: aws.String(provider),
+			}},
+			Output: out,
+		}
+	}
+	actions := []*codepipeline.ActionExecutionDetail{
+		source("Code", providerCodeStar, map[string]string{"CommitId": "3f1c2a9"}, ""),
+		source("Artifact", "S3", map[string]string{"VersionId": "v3"}, ""),
+		source("Image", providerECR, nil, "sha256:0123"),
+	}
+
+	tests := []struct {
+		name   string
+		source versionSource
+		want   string
+	}{
+		{"action type", findVersionSource(s3SourcePipeline("app", ""), "bucket", "app.zip"), "v3"},
+		{"any S3 source", versionSource{}, "v3"},
+		{"output variable", versionSource{Action: "Code", Provider: providerCodeStar}, "3f1c2a9"},
+		{"external execution", versionSource{Action: "Image", Provider: providerECR}, "sha256:0123"},
+		{"unknown action", versionSource{Action: "Missing", Provider: "S3"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sourceActionRevision(actions, tt.source); got != tt.want {
+				t.Errorf("sourceActionRevision = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindVersionSource(t *testing.T) {
+	pipeline := s3SourcePipeline("app", "", "Deploy")
+	pipeline.Stages[0].Actions = append(pipeline.Stages[0].Actions, &codepipeline.ActionDeclaration{
+		Name: aws.String("Code"),
+		ActionTypeId: &codepipeline.ActionTypeId{
+			Category: aws.String(codepipeline.ActionCategorySource),
+			Provider: aws.String(providerCodeStar),
+		},
+		Configuration:   map[string]*string{"FullRepositoryId": aws.String("owner/app")},
+		OutputArtifacts: []*codepipeline.OutputArtifact{{Name: aws.String("CodeArtifact")}},
+	})
+
+	tests := []struct {
+		name        string
+		bucket, key string
+		want        versionSource
+	}{
+		{"S3 source", "bucket", "app.zip", versionSource{Action: "Artifact", Artifact: "SourceArtifact", Provider: "S3"}},
+		{"git source without a bucket", "", "", versionSource{Action: "Code", Artifact: "CodeArtifact", Provider: providerCodeStar, Repository: "owner/app"}},
+		{"bucket set by hand", "other", "app.zip", versionSource{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := findVersionSource(pipeline, tt.bucket, tt.key); got != tt.want {
+				t.Errorf("findVersionSource = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetStageDetailsNeverExecuted(t *testing.T) {
+	// the source action reports neither its revision nor a link, the stage
+	// just added to the pipeline never ran
+	source := stageState("Source", "exec-1", codepipeline.StageExecutionStatusSucceeded)
+	source.ActionStates[0].ActionName = aws.String("Artifact")
+	f := &fakeAWS{
+		t: t,
+		pipeline: map[string]func(string) interface{}{
+			"GetPipelineState": func(string) interface{} {
+				return &codepipeline.GetPipelineStateOutput{StageStates: []*codepipeline.StageState{
+					source,
+					{
+						StageName:    aws.String("Deploy"),
+						ActionStates: []*codepipeline.ActionState{{ActionName: aws.String("Deploy")}},
+					},
+				}}
+			},
+			"GetPipeline": func(string) interface{} {
+				return &codepipeline.GetPipelineOutput{Pipeline: s3SourcePipeline("app", "", "Deploy")}
+			},
+			"GetPipelineExecution": executions(map[string]string{"exec-1": "v1"}),
+		},
+		objects: map[string]map[string]string{
+			"bucket/app.zip?versionId=v1": {"Release": "1.1.0"},
+		},
+	}
+
+	stages, _, err := getStageDetails(f.session(), testCfg("app"), nil)
+	if err != nil {
+		t.Fatalf("getStageDetails: %v", err)
+	}
+	if len(stages) != 2 {
+		t.Fatalf("got %d stages, want 2", len(stages))
+	}
+
+	if got := stages[0]; got.RevisionID != "v1" || got.Version != "1.1.0" {
+		t.Errorf("Source runs %s %s, want v1 1.1.0 from its execution", got.RevisionID, got.Version)
+	}
+
+	never := stages[1]
+	if never.ExecutionID != "" || never.Status != "" || never.Version != "" || never.LastStatusChange != nil || never.Error != "" {
+		t.Errorf("Deploy = %+v, want a stage that never ran", never)
+	}
+	if got := never.displayStatus(); got != neverExecuted {
+		t.Errorf("Deploy status shows %q, want %q", got, neverExecuted)
+	}
+	if len(never.Links) != 0 {
+		t.Errorf("Deploy links = %+v, want none", never.Links)
+	}
+	if n := f.called("S3 HEAD"); n != 1 {
+		t.Errorf("S3 read %d times, want once for Source only", n)
+	}
+}
+
+func TestReadVersionMissingMetadata(t *testing.T) {
+	tests := []struct {
+		name       string
+		meta       map[string]string
+		version    string
+		commit     string
+		incomplete bool
+	}{
+		{"complete", map[string]string{"Release": "1.4.0", "Commit": "3f1c2a9"}, "1.4.0", "3f1c2a9", false},
+		{"no commit", map[string]string{"Release": "1.4.0"}, "1.4.0", noCommitMetadata, true},
+		{"no version", map[string]string{"Commit": "3f1c2a9"}, noVersionMetadata, "3f1c2a9", true},
+		{"neither", map[string]string{"Branch": "main"}, noVersionMetadata, noCommitMetadata, true},
+		{"no metadata", map[string]string{}, noVersionMetadata, noCommitMetadata, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &fakeAWS{t: t, objects: map[string]map[string]string{"bucket/app.zip?versionId=v1": tt.meta}}
+			cfg := testCfg("app")
+			cfg.Bucket, cfg.Key = "bucket", "app.zip"
+
+			meta, err := readVersion(f.session(), cfg, versionSource{}, "v1")
+			if err != nil {
+				t.Fatalf("readVersion: %v", err)
+			}
+			if meta.Version != tt.version || meta.Commit != tt.commit || meta.Incomplete != tt.incomplete {
+				t.Errorf("got %q %q incomplete %v, want %q %q incomplete %v", meta.Version, meta.Commit, meta.Incomplete, tt.version, tt.commit, tt.incomplete)
+			}
+		})
+	}
+}
+
+// headS3 answers HeadObject with meta, or err, counting the calls. The
+// other calls of the interface panic.
+type headS3 struct {
+	s3iface.S3API
+	meta  map[string]*string
+	err   error
+	heads atomic.Int32
+}
+
+func (h *headS3) HeadObject(*s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+	h.heads.Add(1)
+	// let the other lookups of the version pile up
+	time.Sleep(20 * time.Millisecond)
+	if h.err != nil {
+		return nil, h.err
+	}
+	return &s3.HeadObjectOutput{Metadata: h.meta, LastModified: aws.Time(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))}, nil
+}
+
+// withS3 makes s3Client return svc for the rest of the test.
+func withS3(t *testing.T, svc s3iface.S3API) *session.Session {
+	forgetMetadata()
+	saved := newS3
+	newS3 = func(*session.Session, *aws.Config) s3iface.S3API { return svc }
+	t.Cleanup(func() { newS3 = saved })
+
+	return session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("eu-west-1"),
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+	}))
+}
+
+func TestReadVersionOnce(t *testing.T) {
+	svc := &headS3{meta: map[string]*string{"Release": aws.String("1.4.0"), "Commit": aws.String("3f1c2a9")}}
+	sess := withS3(t, svc)
+	cfg := testCfg("app")
+	cfg.Bucket, cfg.Key = "bucket", "app.zip"
+
+	// stages of concurrently queried pipelines running the same version
+	var wg sync.WaitGroup
+	versions := make([]string, 8)
+	for i := range versions {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			meta, err := readVersion(sess, cfg, versionSource{}, "v1")
+			if err != nil {
+				t.Errorf("readVersion: %v", err)
+			}
+			versions[i] = meta.Version
+		}(i)
+	}
+	wg.Wait()
+
+	if n := svc.heads.Load(); n != 1 {
+		t.Errorf("HeadObject called %d times, want once", n)
+	}
+	for i, v := range versions {
+		if v != "1.4.0" {
+			t.Errorf("lookup %d got version %q, want 1.4.0", i, v)
+		}
+	}
+
+	// --watch looks the version up again, from the cache
+	if _, err := readVersion(sess, cfg, versionSource{}, "v1"); err != nil {
+		t.Fatalf("readVersion: %v", err)
+	}
+	if n := svc.heads.Load(); n != 1 {
+		t.Errorf("HeadObject called %d times after a second lookup, want once", n)
+	}
+}
+
+func TestReadVersionRetriesFailures(t *testing.T) {
+	svc := &headS3{err: awserr.New("SlowDown", "please reduce your request rate", nil)}
+	sess := withS3(t, svc)
+	cfg := testCfg("app")
+	cfg.Bucket, cfg.Key = "bucket", "app.zip"
+
+	for i := 0; i < 2; i++ {
+		if _, err := readVersion(sess, cfg, versionSource{}, "v1"); err == nil {
+			t.Fatalf("lookup %d: readVersion succeeded, want the S3 error", i)
+		}
+	}
+	if n := svc.heads.Load(); n != 2 {
+		t.Errorf("HeadObject called %d times, want failed lookups repeated", n)
+	}
+}
+
+// slowPipeline fakes a PARALLEL pipeline of n stages, each running its own
+// execution, that takes delay to answer every call.
+func slowPipeline(tb testing.TB, n int, delay time.Duration) *fakeAWS {
+	var states []*codepipeline.StageState
+	var names []string
+	revisions := make(map[string]string)
+	objects := make(map[string]map[string]string)
+	for i := 1; i <= n; i++ {
+		name, execID, revision := fmt.Sprintf("Deploy%d", i), fmt.Sprintf("exec-%d", i), fmt.Sprintf("v%d", i)
+		states = append(states, stageState(name, execID, codepipeline.StageExecutionStatusSucceeded))
+		names = append(names, name)
+		revisions[execID] = revision
+		objects["bucket/app.zip?versionId="+revision] = map[string]string{"Release": fmt.Sprintf("1.%d.0", i), "Commit": "3f1c2a9"}
+	}
+
+	return &fakeAWS{
+		t:     tb,
+		delay: delay,
+		pipeline: map[string]func(string) interface{}{
+			"GetPipelineState": func(string) interface{} {
+				return &codepipeline.GetPipelineStateOutput{StageStates: states}
+			},
+			"GetPipeline": func(string) interface{} {
+				return &codepipeline.GetPipelineOutput{Pipeline: s3SourcePipeline("app", codepipeline.ExecutionModeParallel, names...)}
+			},
+			"GetPipelineExecution": executions(revisions),
+		},
+		objects: objects,
+	}
+}
+
+func TestGetStageDetailsStageConcurrency(t *testing.T) {
+	const stages = 8
+	lookup := func(concurrency int) time.Duration {
+		cfg := testCfg("app")
+		cfg.StageConcurrency = concurrency
+		sess := slowPipeline(t, stages, 20*time.Millisecond).session()
+
+		var order []string
+		start := time.Now()
+		got, _, err := getStageDetails(sess, cfg, func(details stageDetails) {
+			order = append(order, details.Name)
+		})
+		elapsed := time.Since(start)
+		if err != nil {
+			t.Fatalf("getStageDetails: %v", err)
+		}
+
+		// handed over in pipeline order whatever order they resolve in
+		for i, details := range got {
+			if want := fmt.Sprintf("Deploy%d", i+1); details.Name != want || order[i] != want || details.Version != fmt.Sprintf("1.%d.0", i+1) {
+				t.Errorf("stage %d = %s %s, onStage got %s, want %s", i, details.Name, details.Version, order[i], want)
+			}
+		}
+		return elapsed
+	}
+
+	sequential, concurrent := lookup(1), lookup(stages)
+	// every stage waits on two calls, looked up together they take about
+	// as long as a single one
+	if concurrent > sequential/2 {
+		t.Errorf("%d stages took %v looked up together, %v one at a time", stages, concurrent, sequential)
+	}
+}
+
+func BenchmarkGetStageDetails(b *testing.B) {
+	for _, concurrency := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("concurrency=%d", concurrency), func(b *testing.B) {
+			f := slowPipeline(b, 16, time.Millisecond)
+			cfg := testCfg("app")
+			cfg.StageConcurrency = concurrency
+			for i := 0; i < b.N; i++ {
+				// every lookup starts with nothing cached
+				b.StopTimer()
+				sess := f.session()
+				b.StartTimer()
+				if _, _, err := getStageDetails(sess, cfg, nil); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/codepipeline"
+)
+
+// markStale flags the stages whose latest execution started before the
+// pipeline definition was last updated at updated. Stages that never ran
+// are flagged if the definition changed since the latest execution, they
+// were added after the last release.
+func markStale(execs *executionCache, stages []stageDetails, updated *time.Time) error {
+	if updated == nil {
+		return nil
+	}
+
+	var history []*codepipeline.PipelineExecutionSummary
+	for i := range stages {
+		details := &stages[i]
+
+		// the execution started before its last status change, no need
+		// to list executions for those
+		if details.ExecutionID != "" && details.LastStatusChange != nil && details.LastStatusChange.Before(*updated) {
+			details.StaleDefinition = true
+			continue
+		}
+
+		if history == nil {
+			var err error
+			if history, err = execs.summaries(historyLookback); err != nil {
+				return err
+			}
+		}
+		if len(history) == 0 {
+			return nil
+		}
+
+		started := history[len(history)-1].StartTime
+		if details.ExecutionID == "" {
+			started = history[0].StartTime
+		}
+		for _, summary := range history {
+			if aws.StringValue(summary.PipelineExecutionId) == details.ExecutionID {
+				started = summary.StartTime
+				break
+			}
+		}
+		details.StaleDefinition = started != nil && started.Before(*updated)
+	}
+	return nil
+}
+
+// staleBanner warns about stages reflecting an older pipeline definition,
+// empty if there are none, e.g.
+//
+//	⚠ The pipeline definition changed after the latest execution of Beta, Prod.
+//	  Canary: never executed (added after last release)
+func staleBanner(stages []stageDetails) string {
+	var ran, never []string
+	for _, details := range stages {
+		switch {
+		case !details.StaleDefinition:
+		case details.ExecutionID == "":
+			never = append(never, details.Name)
+		default:
+			ran = append(ran, details.Name)
+		}
+	}
+	if len(ran) == 0 && len(never) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	if len(ran) > 0 {
+		fmt.Fprintf(&b, "⚠ The pipeline definition changed after the latest execution of %s.\n", strings.Join(ran, ", "))
+	} else {
+		b.WriteString("⚠ The pipeline definition changed after the latest execution.\n")
+	}
+	for _, name := range never {
+		fmt.Fprintf(&b, "  %s: never executed (added after last release)\n", name)
+	}
+	return b.String()
+}
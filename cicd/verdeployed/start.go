@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/codepipeline"
+)
+
+// validStart reports whether cfg can start an execution.
+func validStart(cfg Cfg) error {
+	switch {
+	case cfg.Watch || cfg.History > 0 || cfg.Quiet:
+		return fmt.Errorf("start can't be combined with --watch, --history or --quiet")
+	case cfg.DryRun && cfg.Wait:
+		return fmt.Errorf("--dry-run and --wait are mutually exclusive")
+	}
+	return nil
+}
+
+// parsePipelineVariables parses KEY=VALUE pairs into the variables of a
+// new execution, later pairs win over earlier ones with the same key.
+func parsePipelineVariables(pairs []string) ([]*codepipeline.PipelineVariable, error) {
+	values := make(map[string]string)
+	for _, pair := range pairs {
+		if pair == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid variable %q, want KEY=VALUE", pair)
+		}
+		values[name] = value
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	vars := make([]*codepipeline.PipelineVariable, len(names))
+	for i, name := range names {
+		vars[i] = &codepipeline.PipelineVariable{
+			Name:  aws.String(name),
+			Value: aws.String(values[name]),
+		}
+	}
+	return vars, nil
+}
+
+// newRequestToken returns a random client request token. Retries of the
+// start request carry the same token, so a retried request can't start a
+// second execution.
+func newRequestToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// describeStart writes what starting the pipeline would do, for --dry-run.
+func describeStart(w io.Writer, pipelnsvc *codepipeline.CodePipeline, cfg Cfg, vars []*codepipeline.PipelineVariable, token string) error {
+	pipeline, err := getPipeline(pipelnsvc, cfg.PipelineName)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "would start pipeline %s (%s, %s)\n", cfg.PipelineName, aws.StringValue(pipeline.PipelineType), executionMode(pipeline))
+	if bucket, key := artifactLocation(pipeline); bucket != "" {
+		fmt.Fprintf(w, "  source: s3://%s/%s\n", bucket, key)
+	}
+
+	declared := make(map[string]bool)
+	for _, v := range pipeline.Variables {
+		declared[aws.StringValue(v.Name)] = true
+	}
+	for _, v := range vars {
+		note := ""
+		if !declared[aws.StringValue(v.Name)] {
+			note = " (not declared by the pipeline)"
+		}
+		fmt.Fprintf(w, "  variable: %s=%s%s\n", aws.StringValue(v.Name), aws.StringValue(v.Value), note)
+	}
+	_, err = fmt.Fprintf(w, "  client request token: %s\n", token)
+	return err
+}
+
+// startPipeline starts a new execution of the configured pipeline and
+// returns its id.
+func startPipeline(pipelnsvc *codepipeline.CodePipeline, cfg Cfg, vars []*codepipeline.PipelineVariable, token string) (string, error) {
+	input := &codepipeline.StartPipelineExecutionInput{
+		Name:               aws.String(cfg.PipelineName),
+		ClientRequestToken: aws.String(token),
+	}
+	if len(vars) > 0 {
+		input.Variables = vars
+	}
+
+	out, err := pipelnsvc.StartPipelineExecution(input)
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			switch aerr.Code() {
+			default:
+				return "", fmt.Errorf("failed to start pipeline execution: %s", aerr.Message())
+			}
+		}
+		return "", err
+	}
+
+	return aws.StringValue(out.PipelineExecutionId), nil
+}
+
+// waitForExecution polls the execution execID of the configured pipeline
+// until it finished and returns the status it finished with. Status
+// changes are reported on progress.
+func waitForExecution(ctx context.Context, sess *session.Session, cfg Cfg, execID string, progress io.Writer) (string, error) {
+	pipelnsvc := codepipeline.New(sess)
+
+	start := time.Now()
+	var status string
+	err := poll(ctx, cfg, func(ctx context.Context) (bool, error) {
+		exec, err := getPipelineExecution(pipelnsvc, cfg.PipelineName, execID)
+		if err != nil {
+			return false, err
+		}
+
+		if s := aws.StringValue(exec.Status); s != status {
+			status = s
+			fmt.Fprintf(progress, "execution %s %s (%s elapsed)\n", execID, strings.ToLower(status), humanDuration(time.Since(start)))
+		}
+		switch status {
+		case codepipeline.PipelineExecutionStatusInProgress, codepipeline.PipelineExecutionStatusStopping:
+			return false, nil
+		}
+		return true, nil
+	})
+
+	return status, err
+}
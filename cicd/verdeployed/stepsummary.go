@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// stepSummaryEnv names the file GitHub Actions renders in the job summary.
+const stepSummaryEnv = "GITHUB_STEP_SUMMARY"
+
+// statusBadge returns the emoji shown next to a stage status in the job
+// summary.
+func statusBadge(status string) string {
+	switch status {
+	case "Succeeded":
+		return "✅"
+	case "Failed":
+		return "❌"
+	case "InProgress":
+		return "⏳"
+	case "":
+		return "⚪"
+	}
+	return "⚠️"
+}
+
+// appendStepSummary appends a Markdown section describing r to the GitHub
+// Actions job summary at path. The file is shared by every step of the job,
+// so it is never truncated.
+func appendStepSummary(path string, opts renderOptions, r report) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+
+	overall := "✅"
+	if r.Summary.Failed > 0 {
+		overall = "❌"
+	}
+	fmt.Fprintf(w, "### %s %s\n\n", overall, mdEscaper.Replace(r.Pipeline))
+	fmt.Fprintf(w, "%s in %s at %s\n\n", r.Summary, r.Region, r.QueriedAt.Format("2006-01-02 15:04:05 MST"))
+
+	stages := make([]stageDetails, len(r.Stages))
+	for i, details := range r.Stages {
+		details.Status = strings.TrimSpace(statusBadge(details.Status) + " " + details.displayStatus())
+		stages[i] = details
+	}
+	if err := renderMarkdown(w, opts, stages); err != nil {
+		f.Close()
+		return err
+	}
+	fmt.Fprintln(w)
+
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/codepipeline"
+)
+
+// validStop reports whether cfg can stop an execution.
+func validStop(cfg Cfg) error {
+	switch {
+	case cfg.Reason == "":
+		return fmt.Errorf("stop requires --reason")
+	case cfg.Watch || cfg.History > 0 || cfg.Quiet:
+		return fmt.Errorf("stop can't be combined with --watch, --history or --quiet")
+	}
+	return nil
+}
+
+// currentExecution returns the id of the execution seen on the source stage
+// of the named pipeline, see sourceStageState.
+func currentExecution(pipelnsvc *codepipeline.CodePipeline, pipeline, sourceStage string) (string, error) {
+	state, err := pipelnsvc.GetPipelineState(&codepipeline.GetPipelineStateInput{
+		Name: aws.String(pipeline),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			switch aerr.Code() {
+			default:
+				return "", fmt.Errorf("failed to get pipeline state: %s", aerr.Message())
+			}
+		}
+		return "", err
+	}
+
+	stage := sourceStageState(state.StageStates, sourceStage)
+	if stage == nil || stage.LatestExecution == nil {
+		return "", fmt.Errorf("pipeline %s never ran", pipeline)
+	}
+	return aws.StringValue(stage.LatestExecution.PipelineExecutionId), nil
+}
+
+// stopExecution stops the execution execID of the configured pipeline. In
+// progress actions are left to finish unless cfg.Abandon is set.
+func stopExecution(pipelnsvc *codepipeline.CodePipeline, cfg Cfg, execID string) error {
+	_, err := pipelnsvc.StopPipelineExecution(&codepipeline.StopPipelineExecutionInput{
+		PipelineName:        aws.String(cfg.PipelineName),
+		PipelineExecutionId: aws.String(execID),
+		Abandon:             aws.Bool(cfg.Abandon),
+		Reason:              aws.String(cfg.Reason),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			switch aerr.Code() {
+			case codepipeline.ErrCodePipelineExecutionNotStoppableException:
+				return fmt.Errorf("execution %s can't be stopped: %s", execID, aerr.Message())
+			case codepipeline.ErrCodeDuplicatedStopRequestException:
+				return fmt.Errorf("execution %s is already being stopped: %s", execID, aerr.Message())
+			default:
+				return fmt.Errorf("failed to stop pipeline execution: %s", aerr.Message())
+			}
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/codepipeline"
+)
+
+// errStuck is returned by --wait and --watch when a stage stays in progress
+// without a status change for longer than --stuck-after.
+var errStuck = errors.New("stuck")
+
+// isStuck reports whether a stage in progress went without a status change
+// for longer than after. A zero after disables the check.
+func isStuck(status string, lastChange *time.Time, now time.Time, after time.Duration) bool {
+	if after <= 0 || lastChange == nil || status != codepipeline.StageExecutionStatusInProgress {
+		return false
+	}
+	return now.Sub(*lastChange) > after
+}
+
+// stuckStatus renders the status of a stuck stage, e.g.
+// "InProgress (stuck 2h14m)".
+func stuckStatus(d stageDetails, now time.Time) string {
+	return fmt.Sprintf("%s (stuck %s)", d.Status, humanDuration(now.Sub(*d.LastStatusChange)))
+}
+
+// stuckStates fails with errStuck if any of the stage states is stuck.
+func stuckStates(pipeline string, states []*codepipeline.StageState, after time.Duration) error {
+	now := time.Now()
+
+	var stuck []string
+	for _, stage := range states {
+		exec := stage.LatestExecution
+		if exec == nil {
+			continue
+		}
+		last := lastStatusChange(stage.ActionStates)
+		if isStuck(aws.StringValue(exec.Status), last, now, after) {
+			stuck = append(stuck, fmt.Sprintf("%s for %s", aws.StringValue(stage.StageName), humanDuration(now.Sub(*last))))
+		}
+	}
+	if len(stuck) == 0 {
+		return nil
+	}
+	return fmt.Errorf("pipeline %s %w: %s in progress without a change", pipeline, errStuck, strings.Join(stuck, ", "))
+}
+
+// stuckReports fails with errStuck if any stage of the reports is stuck.
+func stuckReports(reports []report) error {
+	var stuck []string
+	for _, r := range reports {
+		for _, details := range r.Stages {
+			if !details.Stuck {
+				continue
+			}
+			name := details.Name
+			if len(reports) > 1 {
+				name = r.Pipeline + "/" + name
+			}
+			stuck = append(stuck, fmt.Sprintf("%s for %s", name, humanDuration(r.QueriedAt.Sub(*details.LastStatusChange))))
+		}
+	}
+	if len(stuck) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %s in progress without a change", errStuck, strings.Join(stuck, ", "))
+}
+
+// filterStates returns the states of the named stages.
+func filterStates(states []*codepipeline.StageState, names []string) []*codepipeline.StageState {
+	var filtered []*codepipeline.StageState
+	for _, stage := range states {
+		for _, name := range names {
+			if aws.StringValue(stage.StageName) == name {
+				filtered = append(filtered, stage)
+				break
+			}
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// summary rolls up the state of all reported stages.
+type summary struct {
+	Stages int `json:"stages" yaml:"stages"`
+	Failed int `json:"failed" yaml:"failed"`
+
+	// VersionsInSync is true when every stage with version metadata runs
+	// the same version, of every artifact for pipelines with several
+	// sources.
+	VersionsInSync bool `json:"versionsInSync" yaml:"versionsInSync"`
+	// Version is the version most stages run.
+	Version string `json:"version,omitempty" yaml:"version,omitempty"`
+	// Artifacts maps every artifact of a pipeline with several sources to
+	// the version, or revision, most stages run.
+	Artifacts map[string]string `json:"artifacts,omitempty" yaml:"artifacts,omitempty"`
+	// OutOfSync maps the stages not running Version to their version. For
+	// pipelines with several sources the keys are stage/artifact.
+	OutOfSync map[string]string `json:"outOfSync,omitempty" yaml:"outOfSync,omitempty"`
+}
+
+// summarize computes the rollup of stages. Stages without version metadata
+// don't take part in the version comparison.
+func summarize(stages []stageDetails) summary {
+	s := summary{Stages: len(stages)}
+
+	for _, details := range stages {
+		if details.Status == "Failed" {
+			s.Failed++
+		}
+	}
+
+	s.Version, s.OutOfSync = majority(stages, func(d stageDetails) string { return d.Version })
+
+	if names := stageArtifactNames(stages); names != nil {
+		s.Artifacts = make(map[string]string)
+		s.OutOfSync = nil
+		for _, name := range names {
+			v, outOfSync := majority(stages, func(d stageDetails) string {
+				a, _ := d.artifact(name)
+				return a.field(driftFieldVersion)
+			})
+			s.Artifacts[name] = v
+			for stage, sv := range outOfSync {
+				if s.OutOfSync == nil {
+					s.OutOfSync = make(map[string]string)
+				}
+				s.OutOfSync[stage+"/"+name] = sv
+			}
+		}
+	}
+
+	s.VersionsInSync = len(s.OutOfSync) == 0
+
+	return s
+}
+
+// majority returns the value most stages have and the stages having another
+// one, nil when they all agree. Stages without a value, or with a
+// placeholder for one that couldn't be told, don't count.
+func majority(stages []stageDetails, value func(stageDetails) string) (string, map[string]string) {
+	var most string
+
+	count := make(map[string]int)
+	for _, details := range stages {
+		if v := value(details); v != "" && !isPlaceholder(v) {
+			count[v]++
+		}
+	}
+
+	// The most common value wins, ties go to the lexically greater one so
+	// the result doesn't depend on map ordering.
+	for v, n := range count {
+		if n > count[most] || (n == count[most] && v > most) {
+			most = v
+		}
+	}
+
+	if len(count) <= 1 {
+		return most, nil
+	}
+
+	others := make(map[string]string)
+	for _, details := range stages {
+		if v := value(details); v != "" && !isPlaceholder(v) && v != most {
+			others[details.Name] = v
+		}
+	}
+	return most, others
+}
+
+// String renders the summary as a single line, e.g.
+//
+//	4 stages, 1 failed, versions in sync: no (Prod=1.4.2, others=1.5.0)
+//
+// or, for pipelines with several sources,
+//
+//	4 stages, 0 failed, versions in sync: no (Prod/App=1.4.2, others: App=1.5.0, Config=3f1c2a9)
+func (s summary) String() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "%d stages, %d failed, versions in sync: ", s.Stages, s.Failed)
+	if s.VersionsInSync {
+		b.WriteString("yes")
+		return b.String()
+	}
+
+	names := make([]string, 0, len(s.OutOfSync))
+	for name := range s.OutOfSync {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	b.WriteString("no (")
+	for _, name := range names {
+		fmt.Fprintf(&b, "%s=%s, ", name, s.OutOfSync[name])
+	}
+	if s.Artifacts == nil {
+		fmt.Fprintf(&b, "others=%s)", s.Version)
+		return b.String()
+	}
+
+	artifacts := make([]string, 0, len(s.Artifacts))
+	for name := range s.Artifacts {
+		artifacts = append(artifacts, name)
+	}
+	sort.Strings(artifacts)
+	for i, name := range artifacts {
+		artifacts[i] = name + "=" + s.Artifacts[name]
+	}
+	fmt.Fprintf(&b, "others: %s)", strings.Join(artifacts, ", "))
+
+	return b.String()
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSummarizeIgnoresPlaceholders(t *testing.T) {
+	stages := []stageDetails{
+		{Name: "Beta", Version: "1.5.0"},
+		{Name: "Staging", Version: noVersionMetadata},
+		{Name: "Prod", Version: "1.5.0"},
+		{Name: "Canary", Version: objectDeletedVersion},
+		{Name: "New"},
+	}
+
+	s := summarize(stages)
+	if !s.VersionsInSync || s.Version != "1.5.0" || s.OutOfSync != nil {
+		t.Errorf("summary = %+v, want every stage with a version in sync on 1.5.0", s)
+	}
+
+	stages[2].Version = "1.4.0"
+	s = summarize(stages)
+	if want := map[string]string{"Prod": "1.4.0"}; s.VersionsInSync || !reflect.DeepEqual(s.OutOfSync, want) {
+		t.Errorf("summary = %+v, want only Prod out of sync", s)
+	}
+}
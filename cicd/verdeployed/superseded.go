@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/codepipeline"
+)
+
+// supersededLookback bounds the older executions searched for the last one
+// that completed a superseded stage, each costs a ListActionExecutions call.
+const supersededLookback = 10
+
+// supersededDetails describes the superseded latest execution of a stage.
+// The stage reports the version of the last execution that completed it,
+// the superseded execution keeps its own here.
+type supersededDetails struct {
+	// By is the newer execution that superseded it, empty if it is
+	// no longer in the execution history.
+	By string `json:"by,omitempty" yaml:"by,omitempty"`
+	// DeployedExecutionID is the last execution that completed the stage,
+	// the one its version comes from. Empty if none was found.
+	DeployedExecutionID string `json:"deployedExecutionId,omitempty" yaml:"deployedExecutionId,omitempty"`
+
+	RevisionID string `json:"revisionId" yaml:"revisionId"`
+	Version    string `json:"version" yaml:"version"`
+	Commit     string `json:"commit" yaml:"commit"`
+}
+
+// deployedExecution returns the execution whose artifact the stage runs,
+// the last one that completed it if its latest one was superseded. Empty
+// if none did.
+func (d stageDetails) deployedExecution() string {
+	if d.Superseded != nil {
+		return d.Superseded.DeployedExecutionID
+	}
+	return d.ExecutionID
+}
+
+// isSuperseded reports whether the stage was left unfinished by its latest
+// execution, exec, because a newer one superseded it.
+func isSuperseded(details *stageDetails, exec *codepipeline.PipelineExecution) bool {
+	return aws.StringValue(exec.Status) == codepipeline.PipelineExecutionStatusSuperseded &&
+		details.Status != codepipeline.StageExecutionStatusSucceeded
+}
+
+// findSuperseding returns the execution that superseded execID and the last
+// execution before it that completed stage, both empty if not found in the
+// execution history.
+func findSuperseding(execs *executionCache, stage, execID string) (by, deployed string, err error) {
+	history, err := execs.summaries(historyLookback)
+	if err != nil {
+		return "", "", err
+	}
+
+	for i, summary := range history {
+		if aws.StringValue(summary.PipelineExecutionId) != execID {
+			continue
+		}
+		// newest first, the execution right after it is the one before
+		if i > 0 {
+			by = aws.StringValue(history[i-1].PipelineExecutionId)
+		}
+
+		older := history[i+1:]
+		if len(older) > supersededLookback {
+			older = older[:supersededLookback]
+		}
+		for _, summary := range older {
+			id := aws.StringValue(summary.PipelineExecutionId)
+			actions, err := execs.actionExecutions(id)
+			if err != nil {
+				return "", "", err
+			}
+			if stageCompleted(stage, actions) {
+				return by, id, nil
+			}
+		}
+		return by, "", nil
+	}
+
+	return "", "", nil
+}
+
+// stageCompleted reports whether every action stage ran in actions
+// succeeded.
+func stageCompleted(stage string, actions []*codepipeline.ActionExecutionDetail) bool {
+	var ran bool
+	for _, action := range actions {
+		if aws.StringValue(action.StageName) != stage {
+			continue
+		}
+		if aws.StringValue(action.Status) != codepipeline.ActionExecutionStatusSucceeded {
+			return false
+		}
+		ran = true
+	}
+	return ran
+}
+
+// supersededStatus renders the status of a superseded stage, e.g.
+// "Superseded (by e-456)".
+func supersededStatus(s *supersededDetails) string {
+	if s.By == "" {
+		return codepipeline.PipelineExecutionStatusSuperseded
+	}
+	return fmt.Sprintf("%s (by %s)", codepipeline.PipelineExecutionStatusSuperseded, s.By)
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/codepipeline"
+)
+
+// tagLookupRetries bounds the retries of throttled tag lookups. Accounts
+// with many pipelines easily hit the CodePipeline request rate, the SDK
+// backs off between attempts.
+const tagLookupRetries = 8
+
+// parseTags parses a comma separated list of key=value pairs.
+func parseTags(spec string) (map[string]string, error) {
+	tags := make(map[string]string)
+
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(item, "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid tag %q, expected key=value", item)
+		}
+		tags[k] = v
+	}
+
+	if len(tags) == 0 {
+		return nil, fmt.Errorf("no tags given")
+	}
+	return tags, nil
+}
+
+// formatTags renders tags in the form parseTags accepts, sorted by key.
+func formatTags(tags map[string]string) string {
+	pairs := make([]string, 0, len(tags))
+	for k, v := range tags {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// pipelinesWithTags returns the names of the pipelines carrying every one
+// of tags, in the order of names. Keys and values are matched case
+// sensitively, like AWS does. Pipelines deleted since they were listed are
+// skipped.
+func pipelinesWithTags(sess *session.Session, names []string, tags map[string]string, concurrency int) ([]string, error) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	pipelnsvc := codepipeline.New(sess, aws.NewConfig().WithMaxRetries(tagLookupRetries))
+
+	matched := make([]bool, len(names))
+	errs := make([]error, len(names))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	for i, name := range names {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, name string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			pipelineTags, err := getPipelineTags(pipelnsvc, name)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			matched[i] = hasTags(pipelineTags, tags)
+		}(i, name)
+	}
+	wg.Wait()
+
+	var result []string
+	for i, name := range names {
+		if errs[i] != nil {
+			return nil, pipelineError{Pipeline: name, Err: errs[i]}
+		}
+		if matched[i] {
+			result = append(result, name)
+		}
+	}
+
+	return result, nil
+}
+
+// hasTags reports whether have contains every key and value of want.
+func hasTags(have, want map[string]string) bool {
+	for k, v := range want {
+		if hv, ok := have[k]; !ok || hv != v {
+			return false
+		}
+	}
+	return true
+}
+
+// getPipelineTags returns the tags of the named pipeline, nil if the
+// pipeline no longer exists.
+func getPipelineTags(pipelnsvc *codepipeline.CodePipeline, name string) (map[string]string, error) {
+	out, err := pipelnsvc.GetPipeline(&codepipeline.GetPipelineInput{
+		Name: aws.String(name),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			switch aerr.Code() {
+			case codepipeline.ErrCodePipelineNotFoundException:
+				return nil, nil
+			default:
+				return nil, fmt.Errorf("failed to get pipeline: %s", aerr.Message())
+			}
+		}
+		return nil, err
+	}
+
+	tags := make(map[string]string)
+	input := &codepipeline.ListTagsForResourceInput{
+		ResourceArn: out.Metadata.PipelineArn,
+	}
+	err = pipelnsvc.ListTagsForResourcePages(input, func(page *codepipeline.ListTagsForResourceOutput, _ bool) bool {
+		for _, tag := range page.Tags {
+			tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+		}
+		return true
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			switch aerr.Code() {
+			case codepipeline.ErrCodeResourceNotFoundException:
+				return nil, nil
+			default:
+				return nil, fmt.Errorf("failed to list tags: %s", aerr.Message())
+			}
+		}
+		return nil, err
+	}
+
+	return tags, nil
+}
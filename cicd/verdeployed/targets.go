@@ -0,0 +1,95 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/codepipeline"
+)
+
+// deployTarget is what a deploy action of a stage deploys to.
+type deployTarget struct {
+	Action   string `json:"actionName" yaml:"actionName"`
+	Provider string `json:"provider" yaml:"provider"`
+	// Target names the deployed resource, e.g. cluster/service for ECS.
+	Target string `json:"target" yaml:"target"`
+}
+
+// String renders the target, e.g. "ECS prod-cluster/api".
+func (t deployTarget) String() string {
+	return t.Provider + " " + t.Target
+}
+
+// getTargets returns the targets of the deploy actions of the named stage,
+// in pipeline order. Providers verdeployed doesn't know are left out.
+func getTargets(pipeline *codepipeline.PipelineDeclaration, stage string) []deployTarget {
+	var targets []deployTarget
+	for _, s := range pipeline.Stages {
+		if aws.StringValue(s.Name) != stage {
+			continue
+		}
+		for _, action := range s.Actions {
+			id := action.ActionTypeId
+			if id == nil || aws.StringValue(id.Category) != codepipeline.ActionCategoryDeploy {
+				continue
+			}
+			conf := func(key string) string { return aws.StringValue(action.Configuration[key]) }
+
+			t := deployTarget{
+				Action:   aws.StringValue(action.Name),
+				Provider: aws.StringValue(id.Provider),
+			}
+			switch t.Provider {
+			case "ECS":
+				t.Target = conf("ClusterName") + "/" + conf("ServiceName")
+			case "CloudFormation", "CloudFormationStackSet":
+				t.Target = conf("StackName")
+				if t.Target == "" {
+					t.Target = conf("StackSetName")
+				}
+			case providerCodeDeploy, providerCodeDeployToECS:
+				t.Target = conf("ApplicationName") + "/" + conf("DeploymentGroupName")
+			case "S3":
+				t.Target = conf("BucketName")
+			case providerBeanstalk:
+				t.Target = conf("ApplicationName") + "/" + conf("EnvironmentName")
+			default:
+				continue
+			}
+			targets = append(targets, t)
+		}
+	}
+	return targets
+}
+
+// targetsSummary renders the targets of a stage on a single line.
+func targetsSummary(targets []deployTarget) string {
+	s := make([]string, len(targets))
+	for i, t := range targets {
+		s[i] = t.String()
+	}
+	return strings.Join(s, "; ")
+}
+
+// targetColumn shows what the stage deploys to.
+var targetColumn = column{
+	Name:  "target",
+	Title: "Target",
+	Wide:  true,
+	Value: func(_ report, d stageDetails) string { return targetsSummary(d.Targets) },
+	Display: func(_ renderOptions, _ report, d stageDetails) string {
+		if len(d.Targets) == 0 {
+			return "-"
+		}
+		return targetsSummary(d.Targets)
+	},
+}
+
+// withTargets appends the target column to the default columns of
+// --show-targets, a --columns selection places it itself.
+func (o renderOptions) withTargets(cols []column) []column {
+	if !o.ShowTargets || o.Columns != nil {
+		return cols
+	}
+	return append(cols[:len(cols):len(cols)], targetColumn)
+}
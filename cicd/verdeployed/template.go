@@ -0,0 +1,31 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"text/template"
+)
+
+// templateFuncs are the helpers available to user supplied templates in
+// addition to the text/template builtins.
+var templateFuncs = template.FuncMap{
+	"shortCommit": shortCommit,
+	"upper":       strings.ToUpper,
+	"join":        strings.Join,
+}
+
+// parseTemplate parses a user supplied output template. The template is
+// executed against a report value, e.g.
+//
+//	{{range .Stages}}{{.Name}}={{.Version}} {{end}}
+//
+// Parse errors carry the template name and line so they can be reported
+// before any AWS call is made.
+func parseTemplate(text string) (*template.Template, error) {
+	return template.New("template").Funcs(templateFuncs).Parse(text)
+}
+
+// renderTemplate executes a user supplied template against the report.
+func renderTemplate(w io.Writer, tmpl *template.Template, r report) error {
+	return tmpl.Execute(w, r)
+}
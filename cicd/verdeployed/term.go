@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Supported values of the Color config option.
+const (
+	colorAuto   = "auto"
+	colorAlways = "always"
+	colorNever  = "never"
+)
+
+// ANSI SGR sequences used to highlight stage statuses.
+const (
+	ansiReset   = "\x1b[0m"
+	ansiRed     = "\x1b[31m"
+	ansiGreen   = "\x1b[32m"
+	ansiYellow  = "\x1b[33m"
+	ansiDim     = "\x1b[2m"
+	ansiReverse = "\x1b[7m"
+)
+
+// isTerminal reports whether f is connected to a terminal.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+// useColor resolves the Color config option. In auto mode colors are only
+// used when writing to a terminal and never when NO_COLOR is set, see
+// https://no-color.org.
+func useColor(mode string, terminal bool) (bool, error) {
+	switch mode {
+	case colorAlways:
+		return true, nil
+	case colorNever:
+		return false, nil
+	case colorAuto:
+		if os.Getenv("NO_COLOR") != "" {
+			return false, nil
+		}
+		return terminal, nil
+	}
+	return false, fmt.Errorf("unsupported color mode %q", mode)
+}
+
+// statusColor returns the ANSI sequence used for the status of a stage or
+// action, or an empty string if the status is not highlighted. Those that
+// never ran are dimmed.
+func statusColor(status string, ran bool) string {
+	if !ran {
+		return ansiDim
+	}
+
+	switch status {
+	case "Succeeded":
+		return ansiGreen
+	case "Failed":
+		return ansiRed
+	case "InProgress":
+		return ansiYellow
+	case "Superseded":
+		return ansiDim
+	}
+	return ""
+}
+
+// supportsHyperlinks guesses whether the terminal renders OSC 8 hyperlinks.
+// Terminals lacking support may print the escape sequences verbatim, so
+// only terminals known to handle them are trusted.
+func supportsHyperlinks() bool {
+	if os.Getenv("TERM") == "dumb" {
+		return false
+	}
+
+	switch os.Getenv("TERM_PROGRAM") {
+	case "iTerm.app", "WezTerm", "vscode", "ghostty":
+		return true
+	}
+
+	for _, env := range []string{"WT_SESSION", "KITTY_WINDOW_ID", "VTE_VERSION", "KONSOLE_VERSION"} {
+		if os.Getenv(env) != "" {
+			return true
+		}
+	}
+
+	return strings.Contains(os.Getenv("TERM"), "kitty")
+}
+
+// hyperlink wraps text in an OSC 8 hyperlink to url.
+func hyperlink(url, text string) string {
+	return "\x1b]8;;" + url + "\x1b\\" + text + "\x1b]8;;\x1b\\"
+}
+
+// confirm asks question on the terminal and reports whether it was
+// answered yes. Without a terminal to ask on nothing is confirmed.
+func confirm(question string) (bool, error) {
+	if !isTerminal(os.Stdin) {
+		return false, fmt.Errorf("stdin is not a terminal to confirm on, pass --yes to go ahead without confirmation")
+	}
+
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true, nil
+	}
+	return false, nil
+}
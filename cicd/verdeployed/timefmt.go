@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Keywords accepted by the TimeFormat config option besides Go layouts.
+const (
+	timeRFC3339  = "rfc3339"
+	timeUnix     = "unix"
+	timeRelative = "relative"
+)
+
+// timeFormat controls how the human readable formats render timestamps.
+// Machine readable formats always use RFC3339 in UTC.
+type timeFormat struct {
+	// layout is a Go time layout or one of the unix and relative keywords.
+	// Empty keeps the default of each column.
+	layout   string
+	location *time.Location
+}
+
+// parseTimeFormat validates the TimeFormat and Timezone config options.
+func parseTimeFormat(layout, zone string) (timeFormat, error) {
+	tf := timeFormat{location: time.UTC}
+
+	switch strings.ToLower(zone) {
+	case "", "utc":
+	case "local":
+		tf.location = time.Local
+	default:
+		loc, err := time.LoadLocation(zone)
+		if err != nil {
+			return timeFormat{}, fmt.Errorf("invalid timezone %q: %w", zone, err)
+		}
+		tf.location = loc
+	}
+
+	switch strings.ToLower(layout) {
+	case "":
+	case timeRFC3339:
+		tf.layout = time.RFC3339
+	case timeUnix, timeRelative:
+		tf.layout = strings.ToLower(layout)
+	default:
+		// A layout without any reference element formats to itself.
+		ref := time.Date(2006, time.January, 2, 15, 4, 5, 0, time.UTC)
+		if ref.Format(layout) == layout {
+			return timeFormat{}, fmt.Errorf("invalid time format %q: no reference time elements, see https://pkg.go.dev/time#pkg-constants", layout)
+		}
+		tf.layout = layout
+	}
+
+	return tf, nil
+}
+
+// format renders t, relative to now if so configured. relative selects the
+// default used when no layout was configured. A nil time renders as "-".
+func (tf timeFormat) format(t *time.Time, now time.Time, relative bool) string {
+	if t == nil {
+		return "-"
+	}
+
+	layout := tf.layout
+	if layout == "" {
+		layout = time.RFC3339
+		if relative {
+			layout = timeRelative
+		}
+	}
+
+	switch layout {
+	case timeRelative:
+		return humanDuration(now.Sub(*t))
+	case timeUnix:
+		return strconv.FormatInt(t.Unix(), 10)
+	}
+
+	loc := tf.location
+	if loc == nil {
+		loc = time.UTC
+	}
+	return t.In(loc).Format(layout)
+}
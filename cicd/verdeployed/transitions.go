@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/codepipeline"
+)
+
+// validFreeze reports whether cfg names the stage to freeze or unfreeze.
+func validFreeze(cmd string, cfg Cfg) error {
+	switch {
+	case cfg.Stage == "":
+		return fmt.Errorf("%s requires --stage", cmd)
+	case cmd == cmdFreeze && cfg.Reason == "":
+		return fmt.Errorf("freeze requires --reason")
+	case cfg.Watch || cfg.History > 0 || cfg.Quiet:
+		return fmt.Errorf("%s can't be combined with --watch, --history or --quiet", cmd)
+	}
+	return nil
+}
+
+// setTransition disables or enables the transition into cfg.Stage. The
+// stage is looked up first, the API doesn't tell a typo from a stage that
+// doesn't exist.
+func setTransition(pipelnsvc *codepipeline.CodePipeline, cfg Cfg, enable bool) error {
+	if _, err := getStageState(aws.BackgroundContext(), pipelnsvc, cfg.PipelineName, cfg.Stage); err != nil {
+		return err
+	}
+
+	var err error
+	if enable {
+		_, err = pipelnsvc.EnableStageTransition(&codepipeline.EnableStageTransitionInput{
+			PipelineName:   aws.String(cfg.PipelineName),
+			StageName:      aws.String(cfg.Stage),
+			TransitionType: aws.String(codepipeline.StageTransitionTypeInbound),
+		})
+	} else {
+		_, err = pipelnsvc.DisableStageTransition(&codepipeline.DisableStageTransitionInput{
+			PipelineName:   aws.String(cfg.PipelineName),
+			StageName:      aws.String(cfg.Stage),
+			TransitionType: aws.String(codepipeline.StageTransitionTypeInbound),
+			Reason:         aws.String(cfg.Reason),
+		})
+	}
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			switch aerr.Code() {
+			default:
+				return fmt.Errorf("failed to change stage transition: %s", aerr.Message())
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+// hasDisabledTransition reports whether the transition into any of the
+// stages is disabled.
+func hasDisabledTransition(stages []stageDetails) bool {
+	for _, details := range stages {
+		if details.TransitionDisabled {
+			return true
+		}
+	}
+	return false
+}
+
+// transitionSummary describes a disabled transition on a single line, e.g.
+//
+//	transition disabled by alice: change freeze
+func transitionSummary(details stageDetails) string {
+	s := "transition disabled"
+	if details.TransitionDisabledBy != "" {
+		s += " by " + principalName(details.TransitionDisabledBy)
+	}
+	if details.TransitionDisabledReason != "" {
+		s += ": " + details.TransitionDisabledReason
+	}
+	return s
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/codepipeline"
+)
+
+// trigger tells what started a pipeline execution.
+type trigger struct {
+	// Type is one of the CodePipeline trigger types, e.g.
+	// StartPipelineExecution or CloudWatchEvent.
+	Type string `json:"type" yaml:"type"`
+	// Detail identifies the trigger, e.g. the IAM principal of a manual
+	// start or the ARN of the EventBridge rule.
+	Detail string `json:"detail,omitempty" yaml:"detail,omitempty"`
+}
+
+// getTrigger returns the trigger of a pipeline execution, nil if unknown.
+func getTrigger(exec *codepipeline.PipelineExecution) *trigger {
+	if exec.Trigger == nil || exec.Trigger.TriggerType == nil {
+		return nil
+	}
+	return &trigger{
+		Type:   aws.StringValue(exec.Trigger.TriggerType),
+		Detail: aws.StringValue(exec.Trigger.TriggerDetail),
+	}
+}
+
+// String renders the trigger type and the last path element of its detail,
+// e.g. "StartPipelineExecution (alice)". ARNs are too long for a table.
+func (t *trigger) String() string {
+	if t == nil {
+		return ""
+	}
+	if t.Detail == "" {
+		return t.Type
+	}
+	return t.Type + " (" + principalName(t.Detail) + ")"
+}
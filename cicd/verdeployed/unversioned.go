@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/codepipeline"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// etagRe matches the ETag CodePipeline tracks as the revision of objects in
+// buckets without versioning, the MD5 of the object with a part count for
+// multipart uploads.
+var etagRe = regexp.MustCompile(`^"?[0-9a-f]{32}(-[0-9]+)?"?$`)
+
+// objectReplacedVersion is shown as the version of a revision whose object
+// was overwritten since, its metadata describes another artifact.
+const objectReplacedVersion = "unknown (object replaced)"
+
+// errObjectReplaced is returned when the object of an unversioned bucket no
+// longer is the deployed revision.
+var errObjectReplaced = errors.New("object replaced since it was deployed")
+
+// isETag reports whether revision is an ETag rather than an object version.
+func isETag(revision string) bool {
+	return etagRe.MatchString(revision)
+}
+
+// isS3Revision reports whether revision is of an S3 object, tracked by its
+// version or, without versioning, its ETag.
+func isS3Revision(revision *codepipeline.ArtifactRevision) bool {
+	return revRe.MatchString(aws.StringValue(revision.RevisionSummary)) || isETag(aws.StringValue(revision.RevisionId))
+}
+
+// isVersioningError reports whether err tells the version id isn't one,
+// as happens when looking up an ETag in a bucket without versioning.
+func isVersioningError(err error) bool {
+	if aerr, ok := err.(awserr.Error); ok {
+		return aerr.Code() == "InvalidArgument"
+	}
+	return false
+}
+
+// getCurrentMetadata returns the metadata of the current object at the
+// configured key, as long as it still is the revision etag. Without
+// versioning there is no way to read the metadata of an overwritten
+// object, errObjectReplaced tells it apart.
+func getCurrentMetadata(svc s3iface.S3API, cfg Cfg, etag string) (map[string]*string, *time.Time, error) {
+	warnUnversioned(cfg.Bucket)
+
+	input := &s3.HeadObjectInput{
+		Bucket: aws.String(cfg.Bucket),
+		Key:    aws.String(cfg.Key),
+	}
+	withSSECustomerKey(cfg, &input.SSECustomerAlgorithm, &input.SSECustomerKey)
+
+	result, err := svc.HeadObject(input)
+	if err != nil {
+		if err := encryptionError(svc, cfg, err, ""); err != nil {
+			return make(map[string]*string), nil, err
+		}
+		if aerr, ok := err.(awserr.Error); ok {
+			switch aerr.Code() {
+			default:
+				return make(map[string]*string), nil, fmt.Errorf("failed to retrieve version metadata: %s", aerr.Message())
+			}
+		}
+		return make(map[string]*string), nil, err
+	}
+
+	if strings.Trim(aws.StringValue(result.ETag), `"`) != strings.Trim(etag, `"`) {
+		return make(map[string]*string), nil, errObjectReplaced
+	}
+	return result.Metadata, result.LastModified, nil
+}
+
+// warnedBuckets remembers the buckets warned about, once is enough.
+var warnedBuckets sync.Map
+
+// warnUnversioned suggests enabling versioning on bucket, once per bucket.
+func warnUnversioned(bucket string) {
+	if _, warned := warnedBuckets.LoadOrStore(bucket, true); warned {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "warning: bucket %s has no versioning, the version of replaced artifacts can't be told; enable versioning on it\n", bucket)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/codepipeline"
+)
+
+// getVariables returns the resolved pipeline variables of an execution, nil
+// for V1 pipelines and executions without any.
+func getVariables(exec *codepipeline.PipelineExecution) map[string]string {
+	if len(exec.Variables) == 0 {
+		return nil
+	}
+
+	vars := make(map[string]string, len(exec.Variables))
+	for _, v := range exec.Variables {
+		vars[aws.StringValue(v.Name)] = aws.StringValue(v.ResolvedValue)
+	}
+	return vars
+}
+
+// parseNames splits a comma separated list of names, e.g. of variables.
+func parseNames(spec string) []string {
+	var names []string
+	for _, name := range strings.Split(spec, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// variableNames returns the sorted names of every variable set on any stage
+// of the reports.
+func variableNames(reports ...report) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, r := range reports {
+		for _, details := range r.Stages {
+			for name := range details.Variables {
+				if !seen[name] {
+					seen[name] = true
+					names = append(names, name)
+				}
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// variableColumn returns the column showing the named variable. Stages
+// whose execution didn't set it are left empty.
+func variableColumn(name string) column {
+	return column{
+		Name:  name,
+		Title: name,
+		Wide:  true,
+		Value: func(_ report, d stageDetails) string { return d.Variables[name] },
+	}
+}
+
+// withVariables appends a column per shown variable to cols.
+func (o renderOptions) withVariables(cols []column) []column {
+	for _, name := range o.Variables {
+		cols = append(cols[:len(cols):len(cols)], variableColumn(name))
+	}
+	return cols
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/codepipeline"
+)
+
+// waitInterval is the time between two polls of --wait and wait-for, up to
+// a quarter more is added so concurrent CI jobs don't poll in lockstep.
+const waitInterval = 10 * time.Second
+
+// errWaitTimeout is returned when the pipeline didn't settle in time.
+var errWaitTimeout = errors.New("timed out")
+
+// waitForPipeline polls the state of the configured pipeline until none of
+// the stages of its current execution is in progress, or any stage at all
+// for pipelines running executions in parallel. The stages in progress are
+// reported on progress whenever they change.
+func waitForPipeline(ctx context.Context, sess *session.Session, cfg Cfg, progress io.Writer) error {
+	pipelnsvc := codepipeline.New(sess)
+
+	pipeline, err := getPipeline(pipelnsvc, cfg.PipelineName)
+	if err != nil {
+		return err
+	}
+	concurrent := executionMode(pipeline) != codepipeline.ExecutionModeSuperseded
+
+	start := time.Now()
+	var last string
+	return poll(ctx, cfg, func(ctx context.Context) (bool, error) {
+		state, err := pipelnsvc.GetPipelineStateWithContext(ctx, &codepipeline.GetPipelineStateInput{
+			Name: aws.String(cfg.PipelineName),
+		})
+		if err != nil {
+			if aerr, ok := err.(awserr.Error); ok {
+				switch aerr.Code() {
+				default:
+					return false, fmt.Errorf("failed to get pipeline state: %s", aerr.Message())
+				}
+			}
+			return false, err
+		}
+
+		running := runningStages(state.StageStates, cfg.SourceStage, concurrent)
+		if len(running) == 0 {
+			return true, nil
+		}
+		if err := stuckStates(cfg.PipelineName, filterStates(state.StageStates, running), cfg.StuckAfter); err != nil {
+			return false, err
+		}
+		if msg := strings.Join(running, ", "); msg != last {
+			fmt.Fprintf(progress, "waiting for %s: %s in progress (%s elapsed)\n", cfg.PipelineName, msg, humanDuration(time.Since(start)))
+			last = msg
+		}
+		return false, nil
+	})
+}
+
+// poll calls check every waitInterval until it reports done or fails.
+// cfg.Timeout bounds the wait, zero waits forever.
+func poll(ctx context.Context, cfg Cfg, check func(ctx context.Context) (bool, error)) error {
+	if cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.Timeout)
+		defer cancel()
+	}
+
+	for {
+		done, err := check(ctx)
+		if ctx.Err() != nil {
+			return waitError(ctx, cfg)
+		}
+		if done || err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return waitError(ctx, cfg)
+		case <-time.After(waitInterval + time.Duration(rand.Int63n(int64(waitInterval/4)))):
+		}
+	}
+}
+
+// exitIfWaitFailed reports a failed wait on stderr and exits with the code
+// matching the failure.
+func exitIfWaitFailed(err error) {
+	switch {
+	case err == nil:
+		return
+	case errors.Is(err, errWaitTimeout):
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitTimeout)
+	case errors.Is(err, errDeployFailed), errors.Is(err, errStuck):
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitUnhealthy)
+	case errors.Is(err, context.Canceled):
+		fmt.Fprintln(os.Stderr, "interrupted")
+		os.Exit(exitInterrupted)
+	}
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
+
+// waitError tells a timeout apart from an interrupt.
+func waitError(ctx context.Context, cfg Cfg) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%w after %s waiting for pipeline %s", errWaitTimeout, cfg.Timeout, cfg.PipelineName)
+	}
+	return ctx.Err()
+}
+
+// runningStages returns the names of the stages in progress. Unless all
+// executions count, only stages of the execution seen on the source stage
+// are considered, older executions still draining don't hold the wait up.
+func runningStages(stages []*codepipeline.StageState, sourceStage string, all bool) []string {
+	var current string
+	if stage := sourceStageState(stages, sourceStage); stage != nil && stage.LatestExecution != nil {
+		current = aws.StringValue(stage.LatestExecution.PipelineExecutionId)
+	}
+
+	var running []string
+	for _, stage := range stages {
+		exec := stage.LatestExecution
+		if exec == nil || aws.StringValue(exec.Status) != codepipeline.StageExecutionStatusInProgress {
+			continue
+		}
+		if !all && current != "" && aws.StringValue(exec.PipelineExecutionId) != current {
+			continue
+		}
+		running = append(running, aws.StringValue(stage.StageName))
+	}
+	return running
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// errDeployFailed is returned by waitForRelease when the stage failed
+// deploying the awaited release.
+var errDeployFailed = errors.New("deployment failed")
+
+// validWaitFor reports whether cfg names what wait-for waits for.
+func validWaitFor(cfg Cfg) error {
+	switch {
+	case cfg.Stage == "":
+		return fmt.Errorf("wait-for requires --stage")
+	case (cfg.Commit == "") == (cfg.Release == ""):
+		return fmt.Errorf("wait-for requires exactly one of --commit or --version")
+	case cfg.Watch || cfg.Wait || cfg.History > 0:
+		return fmt.Errorf("wait-for can't be combined with --watch, --wait or --history")
+	}
+	return nil
+}
+
+// releaseMatches reports whether the stage runs the release cfg waits for.
+// Commits match on a prefix, so an abbreviated SHA will do.
+func releaseMatches(cfg Cfg, details stageDetails) bool {
+	if cfg.Commit != "" {
+		return details.Commit != "" && strings.HasPrefix(strings.ToLower(details.Commit), strings.ToLower(cfg.Commit))
+	}
+	return details.Version == cfg.Release
+}
+
+// waitForRelease polls cfg.Stage until its latest execution succeeded
+// deploying the awaited commit or version. Where the stage is at is
+// reported on progress whenever it changes.
+func waitForRelease(ctx context.Context, sess *session.Session, cfg Cfg, progress io.Writer) error {
+	var last string
+	return poll(ctx, cfg, func(context.Context) (bool, error) {
+		stages, _, err := getStageDetails(sess, cfg, nil)
+		if err != nil {
+			return false, err
+		}
+		// getStageDetails guarantees the requested stage is the only one
+		details := stages[0]
+		if details.Error != "" {
+			return false, errors.New(details.Error)
+		}
+
+		if releaseMatches(cfg, details) {
+			switch details.Status {
+			case "Succeeded":
+				return true, nil
+			case "Failed", "Stopped":
+				return false, fmt.Errorf("%w: %s %s deploying %s", errDeployFailed, details.Name, strings.ToLower(details.Status), stageRelease(details))
+			}
+		}
+
+		if details.Stuck {
+			return false, fmt.Errorf("%w: %s in progress without a change since %s", errStuck, details.Name, formatTime(details.LastStatusChange))
+		}
+
+		msg := fmt.Sprintf("%s currently at %s, execution %s %s", details.Name, stageRelease(details), details.ExecutionID, details.Status)
+		if msg != last {
+			fmt.Fprintln(progress, msg)
+			last = msg
+		}
+		return false, nil
+	})
+}
+
+// stageRelease names what a stage runs for progress messages, its version
+// and abbreviated commit as far as known.
+func stageRelease(details stageDetails) string {
+	commit := shortCommit(details.Commit)
+	switch {
+	case details.Version != "" && commit != "":
+		return details.Version + " (" + commit + ")"
+	case details.Version != "":
+		return details.Version
+	case commit != "":
+		return commit
+	}
+	return "an unknown version"
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// clearScreen moves the cursor home and clears the terminal, as watch(1)
+// does before every refresh.
+const clearScreen = "\x1b[H\x1b[2J"
+
+// validWatch reports whether cfg can be watched.
+func validWatch(cfg Cfg) error {
+	switch {
+	case cfg.WatchInterval <= 0:
+		return fmt.Errorf("--watch-interval must be positive")
+	case cfg.Format != formatTable || cfg.Template != "":
+		return fmt.Errorf("--watch is only supported by the table format")
+	case cfg.Quiet || cfg.History > 0 || cfg.Output != "":
+		return fmt.Errorf("--watch can't be combined with --quiet, --history or --output")
+	}
+	return nil
+}
+
+// watchOptions controls a watch loop.
+type watchOptions struct {
+	Interval time.Duration
+	// UntilDone stops watching once no stage is in progress.
+	UntilDone bool
+	// Redraw replaces the previous snapshot on the terminal instead of
+	// appending the next one.
+	Redraw bool
+}
+
+// watch queries and draws the reports every interval until interrupted.
+// Rows whose status changed since the previous refresh are passed to draw.
+// Failed queries are reported on stderr and retried on the next refresh.
+func watch(w io.Writer, wo watchOptions, query func() ([]report, []error), draw func(w io.Writer, changed map[string]bool, reports []report) error) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var previous map[string]string
+	for {
+		reports, errs := query()
+
+		statuses := make(map[string]string)
+		changed := make(map[string]bool)
+		for _, r := range reports {
+			for _, details := range r.Stages {
+				key := stageKey(r.Pipeline, details.Name)
+				statuses[key] = details.Status
+				if previous != nil && previous[key] != details.Status {
+					changed[key] = true
+				}
+			}
+		}
+
+		var buf bytes.Buffer
+		switch {
+		case wo.Redraw:
+			buf.WriteString(clearScreen)
+		case previous != nil:
+			// snapshots are appended, keep them apart
+			buf.WriteString("\n")
+		}
+		previous = statuses
+
+		fmt.Fprintf(&buf, "Every %s: %s\n\n", wo.Interval, time.Now().Format(time.RFC3339))
+		if err := draw(&buf, changed, reports); err != nil {
+			return err
+		}
+		if _, err := buf.WriteTo(w); err != nil {
+			return err
+		}
+		for _, err := range errs {
+			fmt.Fprintln(os.Stderr, err)
+		}
+
+		if wo.UntilDone && len(errs) == 0 && !inProgress(reports) {
+			return nil
+		}
+		// a hung stage would keep --until-done going forever
+		if err := stuckReports(reports); wo.UntilDone && err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(wo.Interval):
+		}
+	}
+}
+
+// stageKey identifies a stage across the reports of a watch.
+func stageKey(pipeline, stage string) string {
+	return pipeline + "\x00" + stage
+}
+
+// inProgress reports whether any stage of the reports is in progress.
+func inProgress(reports []report) bool {
+	for _, r := range reports {
+		for _, details := range r.Stages {
+			if details.Status == "InProgress" {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -4,7 +4,8 @@ go 1.20
 
 require (
 	github.com/ardanlabs/conf/v3 v3.1.5
-	github.com/aws/aws-sdk-go v1.44.262
+	github.com/aws/aws-sdk-go v1.55.5
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require github.com/jmespath/go-jmespath v0.4.0 // indirect